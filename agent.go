@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/agent"
+	"github.com/steezeburger/storage-shower/internal/scan"
+	"github.com/steezeburger/storage-shower/internal/schedule"
+	"github.com/steezeburger/storage-shower/pkg/utils"
+)
+
+// Default time between scans of the paths given to the agent command
+const defaultAgentInterval = 6 * time.Hour
+
+// runAgent runs the agent command, which scans paths on this machine and
+// uploads the results to a central server, and returns the process exit
+// code. Without paths it runs the schedules of the config file.
+func runAgent(args []string) int {
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	var configPath, serverURL, token, host string
+	var interval time.Duration
+	var once, image, gitHistory bool
+	flags.BoolVar(&debugMode, "debug", false, "Enable debug mode")
+	flags.StringVar(&configPath, "config", os.Getenv("STORAGE_SHOWER_CONFIG"),
+		"Path to the config file (env STORAGE_SHOWER_CONFIG, default ~/.config/storage-shower/config.json)")
+	flags.StringVar(&serverURL, "server", os.Getenv("STORAGE_SHOWER_SERVER"),
+		"URL of the storage-shower server to upload results to (env STORAGE_SHOWER_SERVER)")
+	flags.StringVar(&token, "token", "",
+		"Ingest token of the server (env STORAGE_SHOWER_INGEST_TOKEN, default ingestToken of the config file)")
+	flags.StringVar(&host, "host", "",
+		"Name the results are stored under on the server (default the hostname)")
+	flags.DurationVar(&interval, "interval", defaultAgentInterval,
+		"Time between scans of the paths given as arguments")
+	flags.BoolVar(&once, "once", false, "Scan and upload each path once, then exit")
+	flags.BoolVar(&image, "image", false, "Read the paths as container images")
+	flags.BoolVar(&gitHistory, "git-history", false, "Read the paths as git repositories and size their history")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: storage-shower agent --server URL [flags] [path ...]\n\n"+
+			"Scans the paths, or the schedules of the config file without paths, and\n"+
+			"uploads each result to the server's history under this host.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	cfg, _ := loadConfig(configPath)
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if token == "" {
+		token = cfg.IngestToken
+	}
+	scan.DebugMode = debugMode
+
+	a, err := agent.New(agent.Options{Server: serverURL, Token: token, Host: host})
+	if err != nil {
+		log.Printf("Cannot start agent: %v", err)
+		return exitScanFailed
+	}
+
+	schedules := cfg.Schedules
+	if flags.NArg() > 0 {
+		schedules = nil
+		for _, path := range flags.Args() {
+			schedules = append(schedules, schedule.Schedule{
+				Path:       path,
+				Interval:   utils.Duration(interval),
+				Image:      image,
+				GitHistory: gitHistory,
+			})
+		}
+	}
+	if len(schedules) == 0 {
+		log.Printf("Nothing to scan: pass paths or configure schedules")
+		return exitScanFailed
+	}
+	if err := schedule.Validate(schedules); err != nil {
+		log.Printf("Invalid schedule: %v", err)
+		return exitScanFailed
+	}
+
+	// The local history belongs to the server, if one runs here
+	configureCategories(cfg)
+	options := func(s schedule.Schedule) scan.Options {
+		return scan.Options{
+			IgnoreHidden:   s.IgnoreHidden,
+			Excludes:       append(append([]string{}, cfg.Excludes...), s.Excludes...),
+			Workers:        cfg.Workers,
+			SniffContent:   cfg.SniffContent,
+			ReadTimeout:    time.Duration(cfg.ReadTimeout),
+			ExpandArchives: cfg.ExpandArchives,
+			Image:          s.Image,
+			GitHistory:     s.GitHistory,
+		}
+	}
+
+	// Stopping the agent cancels the scan in progress
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		scan.CancelScan()
+	}()
+
+	log.Printf("Agent uploading to %s as %s", serverURL, a.Host())
+	if once {
+		failed := 0
+		for _, s := range schedules {
+			if err := a.Scan(ctx, s.Path, options(s)); err != nil {
+				log.Printf("Scan of %s failed: %v", s.Path, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return exitScanFailed
+		}
+		return 0
+	}
+
+	a.Run(ctx, schedules, options)
+	log.Printf("Agent stopped")
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	scan.WaitForScan(waitCtx)
+	return 0
+}
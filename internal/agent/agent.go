@@ -0,0 +1,222 @@
+// Package agent runs scans on one machine and uploads the results to a
+// central storage-shower server, which keeps them in its history by host.
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+	"github.com/steezeburger/storage-shower/internal/schedule"
+)
+
+// IngestPath is the route of the server's ingest API
+const IngestPath = "/api/ingest"
+
+// Number of times an upload is tried before giving up until the next scan
+const maxAttempts = 4
+
+// Time waited after the first failed upload, growing with each attempt
+var retryDelay = 5 * time.Second
+
+// Report is a scan result uploaded by an agent. It's sent as gzip
+// compressed JSON.
+type Report struct {
+	// Name of the machine that ran the scan
+	Host string `json:"host"`
+	// When the scan finished, how long it took, how many items it read and
+	// how many it couldn't
+	Record scan.ScanRecord `json:"record"`
+	// The scan result, trimmed by the server when it stores it
+	Result fileinfo.FileInfo `json:"result"`
+}
+
+// Options configures an agent
+type Options struct {
+	// Base URL of the server, e.g. "https://storage.example.com:8080"
+	Server string
+	// Ingest token the server requires from agents
+	Token string
+	// Name the results are stored under; the hostname if empty
+	Host string
+	// Client sending uploads; http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Agent scans directories and uploads the results
+type Agent struct {
+	ingestURL string
+	token     string
+	host      string
+	client    *http.Client
+}
+
+// statusError is an upload the server rejected
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server responded with %d: %s", e.code, e.message)
+}
+
+// New creates an agent uploading to the server described by opts
+func New(opts Options) (*Agent, error) {
+	u, err := url.Parse(strings.TrimSuffix(opts.Server, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("server must be an http or https URL, got %q", opts.Server)
+	}
+	if opts.Token == "" {
+		return nil, errors.New("an ingest token is required")
+	}
+	host := opts.Host
+	if host == "" {
+		if host, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("cannot determine host name: %v", err)
+		}
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Agent{
+		ingestURL: u.String() + IngestPath,
+		token:     opts.Token,
+		host:      host,
+		client:    client,
+	}, nil
+}
+
+// Host returns the name the agent's results are stored under
+func (a *Agent) Host() string {
+	return a.host
+}
+
+// Scan scans path with opts and uploads the result. The result isn't saved
+// or recorded in the local history, which a server on the same machine may
+// be using.
+func (a *Agent) Scan(ctx context.Context, path string, opts scan.Options) error {
+	startedAt := time.Now()
+	opts.Unsaved = true
+	root, err := scan.ScanDirectory(path, opts)
+	if err != nil {
+		return err
+	}
+	// Stopping the agent cancels the scan, whose partial result isn't sent
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	status := scan.GetScanStatus()
+	return a.Upload(ctx, Report{
+		Host: a.host,
+		Record: scan.ScanRecord{
+			Path:      root.Path,
+			Timestamp: time.Now(),
+			Size:      root.Size,
+			Duration:  time.Since(startedAt).Seconds(),
+			Items:     status.ScannedItems,
+			Errors:    root.ErrorCount,
+		},
+		// The server would trim the rest away, so don't upload it
+		Result: scan.TrimResult(&root),
+	})
+}
+
+// Upload sends a report to the server, retrying when the server can't be
+// reached or fails. Reports the server rejects aren't retried.
+func (a *Agent) Upload(ctx context.Context, report Report) error {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	if err := json.NewEncoder(gz).Encode(report); err != nil {
+		return fmt.Errorf("error encoding report: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("error compressing report: %v", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := a.post(ctx, body.Bytes())
+		if err == nil {
+			log.Printf("Uploaded scan of %s (%s compressed)", report.Result.Path, fileinfo.FormatBytes(int64(body.Len())))
+			return nil
+		}
+		var rejected *statusError
+		if errors.As(err, &rejected) && rejected.code < http.StatusInternalServerError {
+			return err
+		}
+		if attempt == maxAttempts {
+			return fmt.Errorf("upload failed after %d attempts: %v", attempt, err)
+		}
+
+		log.Printf("Warning: Upload of %s failed, retrying: %v", report.Result.Path, err)
+		timer := time.NewTimer(retryDelay * time.Duration(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends a compressed report to the ingest API
+func (a *Agent) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.ingestURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &statusError{code: resp.StatusCode, message: strings.TrimSpace(string(message))}
+	}
+	return nil
+}
+
+// Run scans the paths of schedules right away and then on their schedules
+// until ctx is canceled, uploading each result. options returns the scan
+// options for a schedule.
+func (a *Agent) Run(ctx context.Context, schedules []schedule.Schedule, options func(schedule.Schedule) scan.Options) {
+	run := func(s schedule.Schedule) error {
+		if !scan.TryBeginScan(s.Path) {
+			return schedule.ErrBusy
+		}
+		return a.Scan(ctx, s.Path, options(s))
+	}
+
+	for _, s := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := run(s); err != nil {
+			log.Printf("Warning: Scan of %s failed: %v", s.Path, err)
+		}
+	}
+
+	scheduler := schedule.New(run)
+	scheduler.Update(schedules)
+	scheduler.Start()
+	<-ctx.Done()
+	scheduler.Stop()
+}
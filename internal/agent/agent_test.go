@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+)
+
+// ingestServer fakes the ingest API, failing the first failures uploads
+// with status, and records the reports it accepts
+type ingestServer struct {
+	t        *testing.T
+	status   int
+	failures int
+
+	mutex    sync.Mutex
+	attempts int
+	reports  []Report
+}
+
+func (s *ingestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attempts++
+
+	if r.URL.Path != IngestPath || r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.attempts <= s.failures {
+		http.Error(w, "try again", s.status)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		s.t.Errorf("Content-Encoding = %q, want gzip", r.Header.Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		s.t.Errorf("Body isn't gzip compressed: %v", err)
+		return
+	}
+	var report Report
+	if err := json.NewDecoder(gz).Decode(&report); err != nil {
+		s.t.Errorf("Invalid report: %v", err)
+		return
+	}
+	s.reports = append(s.reports, report)
+}
+
+func newIngestServer(t *testing.T, status, failures int) (*ingestServer, string) {
+	t.Helper()
+	retryDelay = time.Millisecond
+	t.Cleanup(func() { retryDelay = 5 * time.Second })
+	s := &ingestServer{t: t, status: status, failures: failures}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts.URL
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		valid bool
+	}{
+		{"valid", Options{Server: "http://central:8080/", Token: "secret"}, true},
+		{"no scheme", Options{Server: "central:8080", Token: "secret"}, false},
+		{"no token", Options{Server: "http://central:8080"}, false},
+	}
+	for _, test := range tests {
+		if _, err := New(test.opts); (err == nil) != test.valid {
+			t.Errorf("%s: New() error = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+
+	a, _ := New(Options{Server: "http://central:8080/", Token: "secret"})
+	if a.ingestURL != "http://central:8080"+IngestPath || a.Host() == "" {
+		t.Errorf("New() = %s as %q, want the ingest URL and the hostname", a.ingestURL, a.Host())
+	}
+}
+
+func TestUpload(t *testing.T) {
+	report := Report{Host: "build-7", Result: fileinfo.FileInfo{Path: "/data", Size: 100}}
+
+	tests := []struct {
+		name     string
+		token    string
+		status   int
+		failures int
+		valid    bool
+		attempts int
+	}{
+		{"accepted", "secret", 0, 0, true, 1},
+		{"retried", "secret", http.StatusServiceUnavailable, 2, true, 3},
+		{"gives up", "secret", http.StatusInternalServerError, maxAttempts, false, maxAttempts},
+		{"rejected", "wrong", 0, 0, false, 1},
+	}
+	for _, test := range tests {
+		s, url := newIngestServer(t, test.status, test.failures)
+		a, err := New(Options{Server: url, Token: test.token})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		err = a.Upload(context.Background(), report)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: Upload() error = %v, want valid %v", test.name, err, test.valid)
+		}
+		if s.attempts != test.attempts {
+			t.Errorf("%s: %d attempts, want %d", test.name, s.attempts, test.attempts)
+		}
+		if test.valid && (len(s.reports) != 1 || s.reports[0].Result.Size != 100) {
+			t.Errorf("%s: server received %+v, want the report", test.name, s.reports)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "artifact.bin"), make([]byte, 3000), 0644)
+	// Small files this deep are trimmed from stored results
+	deep := filepath.Join(dir, "a", "b", "c", "d", "e", "f", "g")
+	os.MkdirAll(deep, 0755)
+	os.WriteFile(filepath.Join(deep, "small.txt"), make([]byte, 10), 0644)
+
+	s, url := newIngestServer(t, 0, 0)
+	a, err := New(Options{Server: url, Token: "secret", Host: "build-7"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := a.Scan(context.Background(), dir, scan.Options{}); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	if len(s.reports) != 1 {
+		t.Fatalf("Server received %d reports, want 1", len(s.reports))
+	}
+	report := s.reports[0]
+	if report.Host != "build-7" || report.Result.Size != 3010 || report.Record.Path != report.Result.Path {
+		t.Errorf("Report = %s on %s with %d bytes, want 3010 bytes from build-7",
+			report.Record.Path, report.Host, report.Result.Size)
+	}
+	if report.Record.Timestamp.IsZero() || report.Record.Items == 0 {
+		t.Errorf("Record = %+v, want the time and items of the scan", report.Record)
+	}
+	if fileinfo.FindNode(&report.Result, filepath.Join(deep, "small.txt")) != nil {
+		t.Errorf("Report includes %s, want the result trimmed like stored ones", filepath.Join(deep, "small.txt"))
+	}
+
+	// The local history and result files are left alone
+	if history := scan.History(); len(history) != 0 {
+		t.Errorf("History = %+v, want no records", history)
+	}
+	if files, _ := filepath.Glob(filepath.Join(os.TempDir(), "storage-shower-*.json")); len(files) != 0 {
+		t.Errorf("Result files %v written, want none", files)
+	}
+}
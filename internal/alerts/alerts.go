@@ -0,0 +1,208 @@
+package alerts
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+	"github.com/steezeburger/storage-shower/pkg/utils"
+)
+
+// Rule sets limits on the directories matching a path pattern
+type Rule struct {
+	// Name shown in violations; defaults to the path pattern
+	Name string `json:"name,omitempty"`
+	// Glob pattern matched against directory paths, e.g. "/home/*"
+	Path string `json:"path"`
+	// Largest allowed size in bytes
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+	// Largest allowed growth in bytes within GrowthInterval
+	MaxGrowth      int64          `json:"maxGrowth,omitempty"`
+	GrowthInterval utils.Duration `json:"growthInterval,omitempty"`
+	// Largest allowed number of files
+	MaxFiles int64 `json:"maxFiles,omitempty"`
+}
+
+// Kinds of violations
+const (
+	KindSize   = "size"
+	KindGrowth = "growth"
+	KindFiles  = "files"
+)
+
+// Violation is a directory exceeding a limit of a rule
+type Violation struct {
+	Rule    string `json:"rule"`
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+	Value   int64  `json:"value"`
+	Limit   int64  `json:"limit"`
+	Message string `json:"message"`
+}
+
+// Report is the outcome of checking the rules against one scan
+type Report struct {
+	ScanPath   string      `json:"scanPath"`
+	CheckedAt  time.Time   `json:"checkedAt"`
+	Violations []Violation `json:"violations"`
+}
+
+// Latest report for each scanned root
+var (
+	reports      = make(map[string]Report)
+	reportsMutex sync.Mutex
+)
+
+// name returns the name of a rule shown in violations
+func (r Rule) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Path
+}
+
+// ValidateRules checks that rules have a valid pattern and at least one limit
+func ValidateRules(rules []Rule) error {
+	for _, rule := range rules {
+		if rule.Path == "" {
+			return fmt.Errorf("alert rule %q needs a path", rule.Name)
+		}
+		if _, err := filepath.Match(rule.Path, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q in alert rule: %v", rule.Path, err)
+		}
+		if rule.MaxBytes <= 0 && rule.MaxGrowth <= 0 && rule.MaxFiles <= 0 {
+			return fmt.Errorf("alert rule %q sets no limit", rule.name())
+		}
+		if rule.MaxGrowth > 0 && rule.GrowthInterval <= 0 {
+			return fmt.Errorf("alert rule %q sets maxGrowth without a growthInterval", rule.name())
+		}
+	}
+	return nil
+}
+
+// BaselineFunc returns the oldest earlier result of the same scan that
+// finished after since, or false if there's none
+type BaselineFunc func(since time.Time) (fileinfo.FileInfo, bool)
+
+// Evaluate checks the directories of a scan result against rules.
+// Growth is measured against the result returned by baseline.
+func Evaluate(rules []Rule, result *fileinfo.FileInfo, baseline BaselineFunc, now time.Time) []Violation {
+	violations := []Violation{}
+
+	// Baselines by interval, loaded once per scan
+	baselines := make(map[utils.Duration]*fileinfo.FileInfo)
+	baselineFor := func(interval utils.Duration) *fileinfo.FileInfo {
+		if b, ok := baselines[interval]; ok {
+			return b
+		}
+		var b *fileinfo.FileInfo
+		if baseline != nil {
+			if previous, ok := baseline(now.Add(-time.Duration(interval))); ok {
+				b = &previous
+			}
+		}
+		baselines[interval] = b
+		return b
+	}
+
+	var walk func(node *fileinfo.FileInfo)
+	walk = func(node *fileinfo.FileInfo) {
+		if !node.IsDir {
+			return
+		}
+		for _, rule := range rules {
+			if matched, _ := filepath.Match(rule.Path, node.Path); !matched {
+				continue
+			}
+			violations = append(violations, checkRule(rule, node, baselineFor)...)
+		}
+		for i := range node.Children {
+			walk(&node.Children[i])
+		}
+	}
+	walk(result)
+
+	return violations
+}
+
+// checkRule returns the limits of rule that node exceeds
+func checkRule(rule Rule, node *fileinfo.FileInfo, baselineFor func(utils.Duration) *fileinfo.FileInfo) []Violation {
+	var violations []Violation
+	add := func(kind string, value, limit int64, message string) {
+		violations = append(violations, Violation{
+			Rule:    rule.name(),
+			Path:    node.Path,
+			Kind:    kind,
+			Value:   value,
+			Limit:   limit,
+			Message: message,
+		})
+	}
+
+	if rule.MaxBytes > 0 && node.Size > rule.MaxBytes {
+		add(KindSize, node.Size, rule.MaxBytes, fmt.Sprintf("%s uses %s, over the limit of %s",
+			node.Path, fileinfo.FormatBytes(node.Size), fileinfo.FormatBytes(rule.MaxBytes)))
+	}
+
+	if rule.MaxFiles > 0 && node.FileCount > rule.MaxFiles {
+		add(KindFiles, node.FileCount, rule.MaxFiles, fmt.Sprintf("%s holds %d files, over the limit of %d",
+			node.Path, node.FileCount, rule.MaxFiles))
+	}
+
+	if rule.MaxGrowth > 0 {
+		if baseline := baselineFor(rule.GrowthInterval); baseline != nil {
+			if previous := fileinfo.FindNode(baseline, node.Path); previous != nil {
+				growth := node.Size - previous.Size
+				if growth > rule.MaxGrowth {
+					add(KindGrowth, growth, rule.MaxGrowth, fmt.Sprintf("%s grew by %s within %v, over the limit of %s",
+						node.Path, fileinfo.FormatBytes(growth), time.Duration(rule.GrowthInterval),
+						fileinfo.FormatBytes(rule.MaxGrowth)))
+				}
+			}
+		}
+	}
+
+	return violations
+}
+
+// Check evaluates rules against a finished scan, using earlier scans of the
+// same root started before startedAt as growth baselines, and records the
+// report as the latest for that root
+func Check(rules []Rule, result *fileinfo.FileInfo, startedAt time.Time) Report {
+	now := time.Now()
+	baseline := func(since time.Time) (fileinfo.FileInfo, bool) {
+		previous, _, ok := scan.OldestScanSince(result.Path, since, startedAt)
+		return previous, ok
+	}
+
+	report := Report{
+		ScanPath:   result.Path,
+		CheckedAt:  now,
+		Violations: Evaluate(rules, result, baseline, now),
+	}
+
+	reportsMutex.Lock()
+	reports[report.ScanPath] = report
+	reportsMutex.Unlock()
+
+	return report
+}
+
+// Reports returns the latest report for each scanned root, newest first
+func Reports() []Report {
+	reportsMutex.Lock()
+	defer reportsMutex.Unlock()
+
+	list := make([]Report, 0, len(reports))
+	for _, report := range reports {
+		list = append(list, report)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CheckedAt.After(list[j].CheckedAt)
+	})
+	return list
+}
@@ -0,0 +1,180 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/pkg/utils"
+)
+
+func testResult() fileinfo.FileInfo {
+	return fileinfo.FileInfo{
+		Name:      "home",
+		Path:      "/home",
+		IsDir:     true,
+		Size:      3000,
+		FileCount: 30,
+		Children: []fileinfo.FileInfo{
+			{Name: "alice", Path: "/home/alice", IsDir: true, Size: 2500, FileCount: 5},
+			{Name: "bob", Path: "/home/bob", IsDir: true, Size: 500, FileCount: 25},
+			{Name: "notes", Path: "/home/notes", Size: 10},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	result := testResult()
+	previous := testResult()
+	previous.Children[1].Size = 100
+
+	var since time.Time
+	baseline := func(s time.Time) (fileinfo.FileInfo, bool) {
+		since = s
+		return previous, true
+	}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		expected []string
+	}{
+		{"size", Rule{Path: "/home/*", MaxBytes: 1000}, []string{"/home/alice size"}},
+		{"files", Rule{Path: "/home/*", MaxFiles: 10}, []string{"/home/bob files"}},
+		{"growth", Rule{Path: "/home/*", MaxGrowth: 200, GrowthInterval: utils.Duration(24 * time.Hour)},
+			[]string{"/home/bob growth"}},
+		{"root", Rule{Path: "/home", MaxBytes: 2000}, []string{"/home size"}},
+		{"within limits", Rule{Path: "/home/*", MaxBytes: 5000, MaxFiles: 100}, nil},
+	}
+
+	for _, test := range tests {
+		violations := Evaluate([]Rule{test.rule}, &result, baseline, now)
+		var got []string
+		for _, v := range violations {
+			got = append(got, v.Path+" "+v.Kind)
+			if v.Rule != test.rule.Path {
+				t.Errorf("%s: rule name = %q, want the path pattern", test.name, v.Rule)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: violations = %v, want %v", test.name, got, test.expected)
+		}
+	}
+
+	if want := now.Add(-24 * time.Hour); !since.Equal(want) {
+		t.Errorf("Baseline requested since %v, want %v", since, want)
+	}
+}
+
+func TestEvaluate_NoBaseline(t *testing.T) {
+	result := testResult()
+	rule := Rule{Path: "/home/*", MaxGrowth: 1, GrowthInterval: utils.Duration(time.Hour)}
+	noBaseline := func(time.Time) (fileinfo.FileInfo, bool) {
+		return fileinfo.FileInfo{}, false
+	}
+
+	if violations := Evaluate([]Rule{rule}, &result, noBaseline, time.Now()); len(violations) != 0 {
+		t.Errorf("Growth without a baseline should not be reported, got %v", violations)
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		valid bool
+	}{
+		{"valid", []Rule{{Path: "/data/*", MaxBytes: 1}}, true},
+		{"missing path", []Rule{{MaxBytes: 1}}, false},
+		{"bad pattern", []Rule{{Path: "/data/[", MaxBytes: 1}}, false},
+		{"no limit", []Rule{{Path: "/data"}}, false},
+		{"growth without interval", []Rule{{Path: "/data", MaxGrowth: 1}}, false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateRules(test.rules); (err == nil) != test.valid {
+			t.Errorf("%s: ValidateRules() error = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestHooks_Webhook(t *testing.T) {
+	received := make(chan Report, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Webhook got %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		var report Report
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		received <- report
+	}))
+	defer webhook.Close()
+
+	report := Report{
+		ScanPath:   "/home",
+		CheckedAt:  time.Now(),
+		Violations: []Violation{{Rule: "quota", Path: "/home/alice", Kind: KindSize, Value: 2, Limit: 1}},
+	}
+	if err := (Hooks{Webhook: webhook.URL}).Notify(report); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	got := <-received
+	if got.ScanPath != "/home" || len(got.Violations) != 1 || got.Violations[0].Path != "/home/alice" {
+		t.Errorf("Webhook received %+v", got)
+	}
+
+	// Reports without violations aren't sent
+	if err := (Hooks{Webhook: webhook.URL}).Notify(Report{ScanPath: "/home"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	select {
+	case got := <-received:
+		t.Errorf("Webhook received a report without violations: %+v", got)
+	default:
+	}
+}
+
+func TestHooks_WebhookError(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer webhook.Close()
+
+	report := Report{Violations: []Violation{{Path: "/home"}}}
+	if err := (Hooks{Webhook: webhook.URL}).Notify(report); err == nil {
+		t.Error("Notify should fail when the webhook responds with an error")
+	}
+}
+
+func TestHooks_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test command uses sh")
+	}
+
+	out := filepath.Join(t.TempDir(), "report.json")
+	report := Report{ScanPath: "/home", Violations: []Violation{{Path: "/home/alice"}, {Path: "/home/bob"}}}
+	command := `cat > "` + out + `" && test "$STORAGE_SHOWER_VIOLATIONS" = 2`
+	if err := (Hooks{Command: command}).Notify(report); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Command did not run: %v", err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil || len(got.Violations) != 2 {
+		t.Errorf("Command received %s", data)
+	}
+}
@@ -0,0 +1,100 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// How long a webhook or command may take
+const hookTimeout = 30 * time.Second
+
+// Hooks are the notifications sent when a scan violates rules
+type Hooks struct {
+	// URL receiving the report as a JSON POST
+	Webhook string
+	// Shell command run with the report as JSON on stdin
+	Command string
+}
+
+// Notify sends a report with violations to the configured hooks. Failures
+// are logged and returned.
+func (h Hooks) Notify(report Report) error {
+	if len(report.Violations) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert report: %v", err)
+	}
+
+	var firstErr error
+	if h.Webhook != "" {
+		if err := postWebhook(h.Webhook, data); err != nil {
+			log.Printf("Warning: Alert webhook failed: %v", err)
+			firstErr = err
+		}
+	}
+	if h.Command != "" {
+		if err := runCommand(h.Command, data, len(report.Violations)); err != nil {
+			log.Printf("Warning: Alert command failed: %v", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// postWebhook posts a JSON report to url
+func postWebhook(url string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// runCommand runs a shell command with a JSON report on stdin
+func runCommand(command string, data []byte, violations int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), "STORAGE_SHOWER_VIOLATIONS="+strconv.Itoa(violations))
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// Package archive lists the members of zip and tar archives from their
+// headers, so scans can show what takes up the space inside them.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// Archive formats
+const (
+	Zip    = "zip"
+	Tar    = "tar"
+	TarGz  = "tar.gz"
+	TarBz2 = "tar.bz2"
+)
+
+// MaxMembers is the number of members listed per archive, so an archive of
+// millions of small files doesn't blow up the scan result
+const MaxMembers = 50000
+
+// ErrTooManyMembers stops listing an archive with more than MaxMembers
+var ErrTooManyMembers = fmt.Errorf("archive has more than %d members", MaxMembers)
+
+// File name suffixes of each format. tar.xz and tar.zst aren't listed
+// since the standard library can't decompress them.
+var suffixes = []struct {
+	suffix, format string
+}{
+	{".zip", Zip},
+	{".jar", Zip},
+	{".tar", Tar},
+	{".tar.gz", TarGz},
+	{".tgz", TarGz},
+	{".tar.bz2", TarBz2},
+	{".tbz2", TarBz2},
+	{".tbz", TarBz2},
+}
+
+// Member is a file or directory stored in an archive
+type Member struct {
+	// Slash-separated path in the archive
+	Name  string
+	IsDir bool
+	// Size of the member's content
+	Size int64
+	// Bytes the member takes up in the archive including its headers. For
+	// compressed tarballs it's estimated from how far the compressed stream
+	// advanced while reading it.
+	CompressedSize int64
+	Mode           fs.FileMode
+	ModTime        time.Time
+}
+
+// Format returns the format of an archive by its file name, or "" if it
+// isn't a supported archive
+func Format(name string) string {
+	lower := strings.ToLower(name)
+	for _, s := range suffixes {
+		if strings.HasSuffix(lower, s.suffix) && len(lower) > len(s.suffix) {
+			return s.format
+		}
+	}
+	return ""
+}
+
+// Read calls visit with each member of the archive in file, reading only
+// its headers; compressed tarballs are decompressed without keeping the
+// content. Zip archives need a file implementing io.ReaderAt. An error from
+// visit stops reading and is returned.
+func Read(file fs.File, format string, visit func(Member) error) error {
+	switch format {
+	case Zip:
+		return readZip(file, visit)
+	case Tar, TarGz, TarBz2:
+		return readTar(file, format, visit)
+	}
+	return fmt.Errorf("unsupported archive format %q", format)
+}
+
+// readZip lists a zip archive from its central directory
+func readZip(file fs.File, visit func(Member) error) error {
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		return errors.New("zip archive can't be read at random offsets")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	reader, err := zip.NewReader(readerAt, info.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range reader.File {
+		err := visit(Member{
+			Name:           f.Name,
+			IsDir:          f.FileInfo().IsDir(),
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			Mode:           f.Mode(),
+			ModTime:        f.Modified,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTar lists a tar archive, decompressing it if needed
+func readTar(file fs.File, format string, visit func(Member) error) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Count the bytes read from the file, keeping it seekable so the tar
+	// reader skips member content without reading it
+	counter := &countingReader{r: file}
+	var stream io.Reader = counter
+	if seeker, ok := file.(io.Seeker); ok && format == Tar {
+		stream = &countingSeeker{counter, seeker}
+	}
+	switch format {
+	case TarGz:
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		stream = gz
+	case TarBz2:
+		stream = bzip2.NewReader(stream)
+	}
+
+	// A member takes up the archive from where the previous one ended to the
+	// end of the next header, so the members add up to the whole archive.
+	// Decompressors read ahead, which moves bytes to earlier members.
+	reader := tar.NewReader(stream)
+	var pending *Member
+	var offset int64
+	for {
+		header, err := reader.Next()
+		if pending != nil {
+			end := counter.n
+			if err == io.EOF {
+				end = info.Size()
+			}
+			pending.CompressedSize = max(end-offset, 0)
+			offset = end
+			if visitErr := visit(*pending); visitErr != nil {
+				return visitErr
+			}
+			pending = nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+		default:
+			// Devices, FIFOs and such take no space
+			continue
+		}
+		pending = &Member{
+			Name:    header.Name,
+			IsDir:   header.Typeflag == tar.TypeDir,
+			Size:    header.Size,
+			Mode:    header.FileInfo().Mode(),
+			ModTime: header.ModTime,
+		}
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingSeeker is a countingReader whose offset follows seeks
+type countingSeeker struct {
+	*countingReader
+	s io.Seeker
+}
+
+func (c *countingSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := c.s.Seek(offset, whence)
+	if err == nil {
+		c.n = pos
+	}
+	return pos, err
+}
@@ -0,0 +1,200 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+var fixtureTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// Content of the archives written by the tests
+var fixtureFiles = []struct {
+	name string
+	size int
+}{
+	{"release/bin/tool", 100000},
+	{"release/README", 10},
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"bundle.zip", Zip},
+		{"app.JAR", Zip},
+		{"backup.tar", Tar},
+		{"release-1.2.tar.gz", TarGz},
+		{"release.tgz", TarGz},
+		{"data.tar.bz2", TarBz2},
+		{"data.tar.xz", ""},
+		{"notes.gz", ""},
+		{".zip", ""},
+		{"photo.jpg", ""},
+	}
+
+	for _, test := range tests {
+		if got := Format(test.name); got != test.expected {
+			t.Errorf("Format(%q) = %q, want %q", test.name, got, test.expected)
+		}
+	}
+}
+
+// writeZip writes the fixture files into a zip archive
+func writeZip(t *testing.T, w io.Writer) {
+	t.Helper()
+	zw := zip.NewWriter(w)
+	for _, file := range fixtureFiles {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: fixtureTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(make([]byte, file.size))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTar writes the fixture files and their directory into a tar archive
+func writeTar(t *testing.T, w io.Writer) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	tw.WriteHeader(&tar.Header{Name: "release/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: fixtureTime})
+	for _, file := range fixtureFiles {
+		header := &tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(file.size), ModTime: fixtureTime}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(make([]byte, file.size))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, fill func(io.Writer)) string {
+		var buf bytes.Buffer
+		fill(&buf)
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	archives := map[string]string{
+		Zip: write("release.zip", func(w io.Writer) { writeZip(t, w) }),
+		Tar: write("release.tar", func(w io.Writer) { writeTar(t, w) }),
+		TarGz: write("release.tar.gz", func(w io.Writer) {
+			gz := gzip.NewWriter(w)
+			writeTar(t, gz)
+			gz.Close()
+		}),
+		TarBz2: filepath.Join("testdata", "release.tar.bz2"),
+	}
+
+	for format, path := range archives {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := file.Stat()
+
+		sizes := make(map[string]int64)
+		var compressed int64
+		err = Read(file, format, func(member Member) error {
+			if !member.IsDir {
+				sizes[member.Name] = member.Size
+			}
+			if !member.ModTime.Equal(fixtureTime) {
+				t.Errorf("%s: %s modified %v, want %v", format, member.Name, member.ModTime, fixtureTime)
+			}
+			compressed += member.CompressedSize
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: Read() error = %v", format, err)
+			continue
+		}
+
+		for _, expected := range fixtureFiles {
+			if sizes[expected.name] != int64(expected.size) {
+				t.Errorf("%s: %s has %d bytes, want %d", format, expected.name, sizes[expected.name], expected.size)
+			}
+		}
+		if compressed <= 0 || compressed > info.Size() {
+			t.Errorf("%s: members take up %d bytes of a %d byte archive", format, compressed, info.Size())
+		}
+	}
+}
+
+func TestRead_StopsOnVisitError(t *testing.T) {
+	var buf bytes.Buffer
+	writeTar(t, &buf)
+	path := filepath.Join(t.TempDir(), "release.tar")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	visited := 0
+	err = Read(file, Tar, func(Member) error {
+		visited++
+		return ErrTooManyMembers
+	})
+	if !errors.Is(err, ErrTooManyMembers) || visited != 1 {
+		t.Errorf("Read() = %v after %d members, want ErrTooManyMembers after 1", err, visited)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	entry := fileinfo.FileInfo{Name: "bundle.zip", Path: "/data/bundle.zip", Size: 500}
+	Expand(&entry, Zip, []Member{
+		{Name: "app/lib/core.so", Size: 2000, CompressedSize: 300},
+		{Name: "./app/main.py", Size: 100, CompressedSize: 40},
+		{Name: "../../escape.txt", Size: 7, CompressedSize: 7},
+		{Name: "app/", IsDir: true},
+		{Name: "app/main.py", Size: 120, CompressedSize: 50},
+	})
+
+	if entry.Archive != Zip || entry.Size != 500 {
+		t.Errorf("Archive entry = %q with %d bytes, want zip keeping its 500 bytes", entry.Archive, entry.Size)
+	}
+	if entry.UncompressedSize != 2127 || entry.FileCount != 3 || entry.DirCount != 2 {
+		t.Errorf("Archive has %d bytes uncompressed in %d files and %d dirs, want 2127, 3, 2",
+			entry.UncompressedSize, entry.FileCount, entry.DirCount)
+	}
+
+	app := fileinfo.FindNode(&entry, "/data/bundle.zip/app")
+	if app == nil || !app.IsDir || app.Size != 350 || app.UncompressedSize != 2120 {
+		t.Fatalf("app = %+v, want a directory of 350 bytes, 2120 uncompressed", app)
+	}
+	if lib := fileinfo.FindNode(&entry, "/data/bundle.zip/app/lib"); lib == nil || !lib.IsDir || lib.FileCount != 1 {
+		t.Errorf("Implicit directory app/lib = %+v, want a directory with one file", lib)
+	}
+	main := fileinfo.FindNode(&entry, "/data/bundle.zip/app/main.py")
+	if main == nil || main.Size != 50 || main.UncompressedSize != 120 || main.Extension != "py" {
+		t.Errorf("app/main.py = %+v, want the later member of 50 bytes, 120 uncompressed", main)
+	}
+	if escape := fileinfo.FindNode(&entry, "/data/bundle.zip/escape.txt"); escape == nil {
+		t.Error("Member named with .. should stay inside the archive")
+	}
+}
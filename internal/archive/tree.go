@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/logger"
+)
+
+// node is a member while the tree of an archive is built
+type node struct {
+	member   Member
+	children map[string]*node
+}
+
+// Expand lists members of the archive entry as its children, in virtual
+// directories below the archive's path. Members are sized by the bytes
+// they take up in the archive, with their content size in
+// UncompressedSize; the entry keeps its size on disk.
+func Expand(entry *fileinfo.FileInfo, format string, members []Member) {
+	root := &node{children: make(map[string]*node)}
+	for _, member := range members {
+		// Keep names inside the archive; later members replace earlier ones
+		name := strings.TrimPrefix(path.Clean("/"+member.Name), "/")
+		if name == "" {
+			continue
+		}
+		member.Name = name
+
+		parent := root
+		parts := strings.Split(name, "/")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := parent.children[part]
+			if !ok || !child.member.IsDir {
+				child = &node{member: Member{IsDir: true}, children: make(map[string]*node)}
+				parent.children[part] = child
+			}
+			parent = child
+		}
+		last := parts[len(parts)-1]
+		if existing, ok := parent.children[last]; ok && existing.member.IsDir && member.IsDir {
+			existing.member = member
+			continue
+		}
+		child := &node{member: member}
+		if member.IsDir {
+			child.children = make(map[string]*node)
+		}
+		parent.children[last] = child
+	}
+
+	// Let FixDirectorySizes total the virtual directories like real ones
+	tree := fileinfo.FileInfo{Name: entry.Name, Path: entry.Path, IsDir: true}
+	dirMap := map[string]*fileinfo.FileInfo{}
+	tree.Children = buildChildren(root, entry.Path, dirMap)
+	fileinfo.FixDirectorySizes(&tree, dirMap, logger.NewNoOpLogger())
+	fileinfo.SumUncompressed(&tree)
+
+	entry.Archive = format
+	entry.Children = tree.Children
+	entry.UncompressedSize = tree.UncompressedSize
+	entry.FileTypes = tree.FileTypes
+	entry.Extensions = tree.Extensions
+	entry.FileCount = tree.FileCount
+	entry.DirCount = tree.DirCount
+	entry.ItemCount = tree.ItemCount
+}
+
+// buildChildren converts the members below n into file infos sorted by
+// name, registering directories in dirMap
+func buildChildren(n *node, dirPath string, dirMap map[string]*fileinfo.FileInfo) []fileinfo.FileInfo {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	children := make([]fileinfo.FileInfo, 0, len(names))
+	for _, name := range names {
+		member := n.children[name].member
+		child := fileinfo.FileInfo{
+			Name:  name,
+			Path:  filepath.Join(dirPath, name),
+			IsDir: member.IsDir,
+			Mode:  member.Mode,
+		}
+		if !member.ModTime.IsZero() {
+			child.ModTime = member.ModTime.Unix()
+		}
+		if !member.IsDir {
+			child.Size = member.CompressedSize
+			child.UncompressedSize = member.Size
+			if ext := filepath.Ext(name); ext != "" {
+				child.Extension = ext[1:]
+			}
+		}
+		children = append(children, child)
+	}
+
+	// Register directories once the slice no longer moves
+	for i := range children {
+		if children[i].IsDir {
+			dirMap[children[i].Path] = &children[i]
+			children[i].Children = buildChildren(n.children[children[i].Name], children[i].Path, dirMap)
+		}
+	}
+	return children
+}
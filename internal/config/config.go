@@ -0,0 +1,336 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/alerts"
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+	"github.com/steezeburger/storage-shower/internal/schedule"
+	"github.com/steezeburger/storage-shower/pkg/utils"
+)
+
+// Settings are the options that can be changed while the server is running
+type Settings struct {
+	// Directories offered as the default scan target in the UI
+	ScanRoots []string `json:"scanRoots"`
+	// Glob patterns of files and directories to skip while scanning
+	Excludes []string `json:"excludes"`
+	// Number of previous scans of each directory to keep in history
+	HistoryRetention int `json:"historyRetention"`
+	// Retention policies for the scans of matching directories, replacing
+	// HistoryRetention for them
+	Retention []scan.RetentionPolicy `json:"retention,omitempty"`
+	// Number of directories read concurrently during a scan
+	Workers int `json:"workers"`
+	// Detect the type of files with unknown extensions from their content
+	SniffContent bool `json:"sniffContent"`
+	// List the members of zip and tar archives in scan results
+	ExpandArchives bool `json:"expandArchives"`
+	// Time a directory read may go without progress before the scan skips
+	// the directory as timed out; 0 waits forever
+	ReadTimeout utils.Duration `json:"readTimeout"`
+	// File type categories replacing or extending the built-in ones
+	Categories []fileinfo.Category `json:"categories,omitempty"`
+	// Extra extension mappings by file type category, e.g. {"video": ["braw"]}
+	FileTypes map[string][]string `json:"fileTypes,omitempty"`
+	// Limits checked after each scan
+	AlertRules []alerts.Rule `json:"alertRules,omitempty"`
+	// URL receiving alert reports with violations as a JSON POST
+	AlertWebhook string `json:"alertWebhook,omitempty"`
+	// Depth below each scanned root down to which /metrics reports
+	// directory sizes
+	MetricsDepth int `json:"metricsDepth"`
+	// Scans run on cron or interval schedules while the server is running
+	Schedules []schedule.Schedule `json:"schedules,omitempty"`
+}
+
+// Config holds all storage-shower options
+type Config struct {
+	// Address to bind to
+	Addr string `json:"addr"`
+	// TCP port to listen on; 0 picks a free port
+	Port int `json:"port"`
+	// Unix domain socket to listen on instead of TCP
+	Socket string `json:"socket,omitempty"`
+	// Open the UI in the default browser on startup
+	OpenBrowser bool `json:"openBrowser"`
+	// Access token required on /api routes
+	Token string `json:"token,omitempty"`
+	// Token agents upload scan results with, and the one the agent command
+	// sends; the server accepts no uploads without one
+	IngestToken string `json:"ingestToken,omitempty"`
+	// Shell command run with alert reports on stdin. Only settable in the
+	// config file so the API can't be used to run commands.
+	AlertCommand string `json:"alertCommand,omitempty"`
+
+	Settings
+}
+
+// Default returns the built-in configuration
+func Default() Config {
+	return Config{
+		Addr: "localhost",
+		Port: 8080,
+		Settings: Settings{
+			ScanRoots:        []string{},
+			Excludes:         []string{},
+			HistoryRetention: 10,
+			Workers:          4,
+			ReadTimeout:      utils.Duration(time.Minute),
+			MetricsDepth:     2,
+		},
+	}
+}
+
+// DefaultPath returns the default config file location,
+// $XDG_CONFIG_HOME/storage-shower/config.json or ~/.config/storage-shower/config.json
+func DefaultPath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "storage-shower", "config.json"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config", "storage-shower", "config.json"), nil
+}
+
+// LoadFile overlays the options found in the JSON file at path onto c.
+// A missing file is not an error.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// ApplyEnv overlays options set through STORAGE_SHOWER_* environment
+// variables onto c. Invalid values are logged and ignored.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) {
+	if value, ok := lookup("STORAGE_SHOWER_ADDR"); ok {
+		c.Addr = value
+	}
+	if value, ok := lookup("STORAGE_SHOWER_SOCKET"); ok {
+		c.Socket = value
+	}
+	if value, ok := lookup("STORAGE_SHOWER_TOKEN"); ok {
+		c.Token = value
+	}
+	if value, ok := lookup("STORAGE_SHOWER_INGEST_TOKEN"); ok {
+		c.IngestToken = value
+	}
+	envInt(lookup, "STORAGE_SHOWER_PORT", &c.Port)
+	envInt(lookup, "STORAGE_SHOWER_WORKERS", &c.Workers)
+	envInt(lookup, "STORAGE_SHOWER_HISTORY_RETENTION", &c.HistoryRetention)
+
+	if value, ok := lookup("STORAGE_SHOWER_READ_TIMEOUT"); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Warning: Ignoring invalid STORAGE_SHOWER_READ_TIMEOUT=%q: %v", value, err)
+		} else {
+			c.ReadTimeout = utils.Duration(d)
+		}
+	}
+
+	if value, ok := lookup("STORAGE_SHOWER_OPEN"); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("Warning: Ignoring invalid STORAGE_SHOWER_OPEN=%q: %v", value, err)
+		} else {
+			c.OpenBrowser = b
+		}
+	}
+}
+
+// envInt sets *dst from an integer environment variable if it's valid
+func envInt(lookup func(string) (string, bool), key string, dst *int) {
+	value, ok := lookup(key)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: Ignoring invalid %s=%q: %v", key, value, err)
+		return
+	}
+	*dst = n
+}
+
+// Validate checks that the options are usable
+func (c *Config) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+	return c.Settings.Validate()
+}
+
+// Validate checks that the runtime settings are usable
+func (s *Settings) Validate() error {
+	if s.HistoryRetention < 1 {
+		return fmt.Errorf("historyRetention must be at least 1, got %d", s.HistoryRetention)
+	}
+	if s.Workers < 1 {
+		return fmt.Errorf("workers must be at least 1, got %d", s.Workers)
+	}
+	if s.ReadTimeout < 0 {
+		return fmt.Errorf("readTimeout must not be negative, got %v", time.Duration(s.ReadTimeout))
+	}
+	if s.MetricsDepth < 0 {
+		return fmt.Errorf("metricsDepth must not be negative, got %d", s.MetricsDepth)
+	}
+	for _, pattern := range s.Excludes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+		}
+	}
+	if s.AlertWebhook != "" {
+		u, err := url.Parse(s.AlertWebhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("alertWebhook must be an http or https URL, got %q", s.AlertWebhook)
+		}
+	}
+	if err := alerts.ValidateRules(s.AlertRules); err != nil {
+		return err
+	}
+	if err := schedule.Validate(s.Schedules); err != nil {
+		return err
+	}
+	if err := scan.ValidateRetention(s.Retention); err != nil {
+		return err
+	}
+	return fileinfo.ValidateCategories(s.Categories)
+}
+
+// Store holds the effective configuration and persists setting changes
+type Store struct {
+	mutex  sync.Mutex
+	path   string
+	config Config
+}
+
+// NewStore creates a store for the effective configuration cfg, which was
+// loaded from the file at path (empty if settings shouldn't be persisted)
+func NewStore(path string, cfg Config) *Store {
+	return &Store{path: path, config: cfg}
+}
+
+// Path returns the config file location
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns a copy of the effective configuration
+func (s *Store) Get() Config {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.config
+}
+
+// UpdateSettings validates and applies new runtime settings and writes them
+// to the config file. Only the settings that differ from the effective ones
+// are written, so options that only the file sets are preserved and flag or
+// environment overrides aren't written back.
+func (s *Store) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.path != "" {
+		// Start from what's on disk so only the changed settings are written
+		fileConfig := Default()
+		if err := fileConfig.LoadFile(s.path); err != nil {
+			return err
+		}
+		fileSettings, err := overlayChanges(fileConfig.Settings, s.config.Settings, settings)
+		if err != nil {
+			return err
+		}
+		fileConfig.Settings = fileSettings
+
+		data, err := json.MarshalIndent(fileConfig, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %v", err)
+		}
+		if err := os.WriteFile(s.path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write config file: %v", err)
+		}
+	}
+
+	s.config.Settings = settings
+	return nil
+}
+
+// overlayChanges returns base with the settings that differ between old and
+// updated replaced by their updated values
+func overlayChanges(base, old, updated Settings) (Settings, error) {
+	fields := func(settings Settings) (map[string]json.RawMessage, error) {
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal settings: %v", err)
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal settings: %v", err)
+		}
+		return m, nil
+	}
+	merged, err := fields(base)
+	if err != nil {
+		return Settings{}, err
+	}
+	oldFields, err := fields(old)
+	if err != nil {
+		return Settings{}, err
+	}
+	newFields, err := fields(updated)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	for key, value := range newFields {
+		if !bytes.Equal(value, oldFields[key]) {
+			merged[key] = value
+		}
+	}
+	// Omitted empty settings that were cleared
+	for key := range oldFields {
+		if _, ok := newFields[key]; !ok {
+			delete(merged, key)
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return Settings{}, fmt.Errorf("failed to marshal settings: %v", err)
+	}
+	var result Settings
+	if err := json.Unmarshal(data, &result); err != nil {
+		return Settings{}, fmt.Errorf("failed to unmarshal settings: %v", err)
+	}
+	return result, nil
+}
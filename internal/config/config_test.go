@@ -0,0 +1,196 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/alerts"
+	"github.com/steezeburger/storage-shower/internal/schedule"
+	"github.com/steezeburger/storage-shower/pkg/utils"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"port": 9090, "excludes": ["*.tmp"], "fileTypes": {"video": ["braw"]}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	if cfg.Port != 9090 {
+		t.Errorf("Port = %d, want 9090", cfg.Port)
+	}
+	if cfg.Addr != "localhost" {
+		t.Errorf("Unset options should keep defaults, got addr %q", cfg.Addr)
+	}
+	if len(cfg.Excludes) != 1 || cfg.Excludes[0] != "*.tmp" {
+		t.Errorf("Excludes = %v, want [*.tmp]", cfg.Excludes)
+	}
+	if len(cfg.FileTypes["video"]) != 1 {
+		t.Errorf("FileTypes = %v, want video mapping", cfg.FileTypes)
+	}
+}
+
+func TestLoadFile_Missing(t *testing.T) {
+	cfg := Default()
+	if err := cfg.LoadFile(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Missing file should not be an error, got %v", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"STORAGE_SHOWER_ADDR":         "0.0.0.0",
+		"STORAGE_SHOWER_PORT":         "not-a-number",
+		"STORAGE_SHOWER_WORKERS":      "8",
+		"STORAGE_SHOWER_OPEN":         "true",
+		"STORAGE_SHOWER_READ_TIMEOUT": "15s",
+		"STORAGE_SHOWER_INGEST_TOKEN": "agents",
+	}
+	lookup := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	cfg := Default()
+	cfg.Port = 9090 // as if set by the config file
+	cfg.ApplyEnv(lookup)
+
+	if cfg.Addr != "0.0.0.0" {
+		t.Errorf("Addr = %q, want 0.0.0.0", cfg.Addr)
+	}
+	if cfg.Port != 9090 {
+		t.Errorf("Invalid env value should be ignored, got port %d", cfg.Port)
+	}
+	if cfg.Workers != 8 {
+		t.Errorf("Workers = %d, want 8", cfg.Workers)
+	}
+	if !cfg.OpenBrowser {
+		t.Error("OpenBrowser should be enabled")
+	}
+	if cfg.ReadTimeout != utils.Duration(15*time.Second) {
+		t.Errorf("ReadTimeout = %v, want 15s", time.Duration(cfg.ReadTimeout))
+	}
+	if cfg.IngestToken != "agents" {
+		t.Errorf("IngestToken = %q, want agents", cfg.IngestToken)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		valid  bool
+	}{
+		{"defaults", func(c *Config) {}, true},
+		{"negative port", func(c *Config) { c.Port = -1 }, false},
+		{"zero workers", func(c *Config) { c.Workers = 0 }, false},
+		{"zero retention", func(c *Config) { c.HistoryRetention = 0 }, false},
+		{"no read timeout", func(c *Config) { c.ReadTimeout = 0 }, true},
+		{"negative read timeout", func(c *Config) { c.ReadTimeout = -1 }, false},
+		{"bad pattern", func(c *Config) { c.Excludes = []string{"["} }, false},
+		{"alert rule", func(c *Config) { c.AlertRules = []alerts.Rule{{Path: "/data", MaxBytes: 1}} }, true},
+		{"alert rule without limit", func(c *Config) { c.AlertRules = []alerts.Rule{{Path: "/data"}} }, false},
+		{"webhook", func(c *Config) { c.AlertWebhook = "https://hooks.example.com/disk" }, true},
+		{"webhook without scheme", func(c *Config) { c.AlertWebhook = "hooks.example.com" }, false},
+		{"schedule", func(c *Config) { c.Schedules = []schedule.Schedule{{Path: "/data", Cron: "@daily"}} }, true},
+		{"schedule without timing", func(c *Config) { c.Schedules = []schedule.Schedule{{Path: "/data"}} }, false},
+	}
+
+	for _, test := range tests {
+		cfg := Default()
+		test.modify(&cfg)
+		err := cfg.Validate()
+		if (err == nil) != test.valid {
+			t.Errorf("%s: Validate() = %v, want valid=%v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestStore_UpdateSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"port": 9090}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The effective port comes from a flag and must not be written back
+	effective := Default()
+	effective.Port = 7070
+	store := NewStore(path, effective)
+
+	settings := store.Get().Settings
+	settings.ScanRoots = []string{"/data"}
+	if err := store.UpdateSettings(settings); err != nil {
+		t.Fatalf("UpdateSettings failed: %v", err)
+	}
+
+	loaded := Default()
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if loaded.Port != 9090 {
+		t.Errorf("File port = %d, want 9090", loaded.Port)
+	}
+	if len(loaded.ScanRoots) != 1 || loaded.ScanRoots[0] != "/data" {
+		t.Errorf("File scan roots = %v, want [/data]", loaded.ScanRoots)
+	}
+	if store.Get().Port != 7070 {
+		t.Errorf("Effective port = %d, want 7070", store.Get().Port)
+	}
+}
+
+func TestStore_UpdateSettings_KeepsOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"workers": 2, "historyRetention": 5}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	effective := Default()
+	if err := effective.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	effective.ApplyEnv(func(key string) (string, bool) {
+		switch key {
+		case "STORAGE_SHOWER_WORKERS":
+			return "16", true
+		case "STORAGE_SHOWER_HISTORY_RETENTION":
+			return "30", true
+		}
+		return "", false
+	})
+	store := NewStore(path, effective)
+
+	// Only the excludes and retention change; the workers override stays
+	settings := store.Get().Settings
+	settings.Excludes = []string{"*.tmp"}
+	settings.HistoryRetention = 20
+	if err := store.UpdateSettings(settings); err != nil {
+		t.Fatalf("UpdateSettings failed: %v", err)
+	}
+
+	loaded := Default()
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if loaded.Workers != 2 {
+		t.Errorf("File workers = %d, want 2", loaded.Workers)
+	}
+	if loaded.HistoryRetention != 20 {
+		t.Errorf("File history retention = %d, want 20", loaded.HistoryRetention)
+	}
+	if len(loaded.Excludes) != 1 || loaded.Excludes[0] != "*.tmp" {
+		t.Errorf("File excludes = %v, want [*.tmp]", loaded.Excludes)
+	}
+	if store.Get().Workers != 16 {
+		t.Errorf("Effective workers = %d, want 16", store.Get().Workers)
+	}
+}
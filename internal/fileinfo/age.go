@@ -0,0 +1,168 @@
+package fileinfo
+
+import (
+	"sort"
+	"time"
+)
+
+// Day is the unit of file ages
+const Day = 24 * time.Hour
+
+// AgeField selects the timestamp that file ages are computed from
+type AgeField string
+
+// Timestamps file ages can be computed from
+const (
+	AgeModified AgeField = "modified"
+	AgeAccessed AgeField = "accessed"
+)
+
+// AgeBucket is a range of file ages in a histogram
+type AgeBucket struct {
+	Label string `json:"label"`
+	// Files younger than this many days fall into the bucket; 0 for the
+	// oldest bucket, which has no upper bound
+	MaxDays int   `json:"maxDays"`
+	Bytes   int64 `json:"bytes"`
+	Files   int64 `json:"files"`
+}
+
+// ageBucketBounds are the upper bounds of the histogram buckets
+var ageBucketBounds = []struct {
+	label   string
+	maxDays int
+}{
+	{"< 1 week", 7},
+	{"< 1 month", 30},
+	{"< 3 months", 90},
+	{"< 6 months", 180},
+	{"< 1 year", 365},
+	{"< 2 years", 730},
+	{"< 5 years", 1825},
+	{"5+ years", 0},
+}
+
+// AgeHistogram buckets the bytes and files in the tree rooted at node by
+// age at now. Bytes of directories trimmed from the result are counted at
+// the age of their newest file. Files without the timestamp are skipped.
+func AgeHistogram(node *FileInfo, field AgeField, now time.Time) []AgeBucket {
+	buckets := make([]AgeBucket, len(ageBucketBounds))
+	for i, bound := range ageBucketBounds {
+		buckets[i] = AgeBucket{Label: bound.label, MaxDays: bound.maxDays}
+	}
+
+	var add func(n *FileInfo)
+	add = func(n *FileInfo) {
+		if !n.IsDir {
+			if i := ageBucket(fileTime(n, field), now); i >= 0 {
+				buckets[i].Bytes += n.Size
+				buckets[i].Files++
+			}
+			return
+		}
+
+		// Attribute what the result no longer lists to the newest file
+		var listedSize, listedFiles int64
+		for i := range n.Children {
+			child := &n.Children[i]
+			add(child)
+			listedSize += child.Size
+			if child.IsDir {
+				listedFiles += child.FileCount
+			} else {
+				listedFiles++
+			}
+		}
+		if rest := n.Size - listedSize; rest > 0 {
+			if i := ageBucket(newestTime(n, field), now); i >= 0 {
+				buckets[i].Bytes += rest
+				buckets[i].Files += max(n.FileCount-listedFiles, 0)
+			}
+		}
+	}
+	add(node)
+
+	return buckets
+}
+
+// ageBucket returns the index of the bucket for a Unix timestamp, or -1 if
+// the timestamp is unknown
+func ageBucket(timestamp int64, now time.Time) int {
+	if timestamp == 0 {
+		return -1
+	}
+	age := now.Sub(time.Unix(timestamp, 0))
+	for i, bound := range ageBucketBounds {
+		if bound.maxDays == 0 || age < time.Duration(bound.maxDays)*Day {
+			return i
+		}
+	}
+	return len(ageBucketBounds) - 1
+}
+
+// fileTime returns the timestamp of a file selected by field
+func fileTime(n *FileInfo, field AgeField) int64 {
+	if field == AgeAccessed {
+		return n.AccessTime
+	}
+	return n.ModTime
+}
+
+// newestTime returns the newest timestamp selected by field in the tree
+// rooted at n
+func newestTime(n *FileInfo, field AgeField) int64 {
+	if !n.IsDir {
+		return fileTime(n, field)
+	}
+	if field == AgeAccessed {
+		return n.NewestAccessTime
+	}
+	return n.NewestModTime
+}
+
+// StaleSubtree is a directory tree in which no file is newer than a threshold
+type StaleSubtree struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Files int64  `json:"files"`
+	// Newest timestamp in the tree, in Unix seconds
+	Newest  int64 `json:"newest"`
+	AgeDays int   `json:"ageDays"`
+}
+
+// FindStaleSubtrees returns the largest directory trees under root that
+// hold at least minSize bytes and in which nothing is younger than minAge,
+// biggest first. Nested stale directories are reported only through their
+// stale ancestor.
+func FindStaleSubtrees(root *FileInfo, field AgeField, minAge time.Duration, minSize int64, now time.Time) []StaleSubtree {
+	cutoff := now.Add(-minAge).Unix()
+	var stale []StaleSubtree
+
+	var walk func(n *FileInfo)
+	walk = func(n *FileInfo) {
+		if !n.IsDir {
+			return
+		}
+		if newest := newestTime(n, field); newest != 0 && newest < cutoff {
+			if n.Size >= minSize {
+				stale = append(stale, StaleSubtree{
+					Path:    n.Path,
+					Size:    n.Size,
+					Files:   n.FileCount,
+					Newest:  newest,
+					AgeDays: int(now.Sub(time.Unix(newest, 0)) / Day),
+				})
+			}
+			return
+		}
+		for i := range n.Children {
+			walk(&n.Children[i])
+		}
+	}
+	walk(root)
+
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].Size > stale[j].Size
+	})
+	return stale
+}
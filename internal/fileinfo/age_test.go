@@ -0,0 +1,87 @@
+package fileinfo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAgeHistogram(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) int64 {
+		return now.Add(-time.Duration(days) * Day).Unix()
+	}
+
+	root := FileInfo{
+		Name:      "root",
+		Path:      "/test/root",
+		IsDir:     true,
+		Size:      1000,
+		FileCount: 4,
+		Children: []FileInfo{
+			{Name: "new", Path: "/test/root/new", Size: 100, ModTime: daysAgo(1), AccessTime: daysAgo(1)},
+			{Name: "old", Path: "/test/root/old", Size: 200, ModTime: daysAgo(400), AccessTime: daysAgo(2)},
+			{Name: "unknown", Path: "/test/root/unknown", Size: 50},
+			// A directory whose files were trimmed from the result
+			{Name: "archive", Path: "/test/root/archive", IsDir: true, Size: 650, FileCount: 1,
+				NewestModTime: daysAgo(3000), NewestAccessTime: daysAgo(3000)},
+		},
+	}
+
+	buckets := AgeHistogram(&root, AgeModified, now)
+	got := make(map[string]int64)
+	for _, bucket := range buckets {
+		if bucket.Bytes > 0 {
+			got[bucket.Label] = bucket.Bytes
+		}
+	}
+	want := map[string]int64{"< 1 week": 100, "< 2 years": 200, "5+ years": 650}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Modified histogram = %v, want %v", got, want)
+	}
+
+	buckets = AgeHistogram(&root, AgeAccessed, now)
+	if buckets[0].Bytes != 300 || buckets[0].Files != 2 {
+		t.Errorf("Accessed < 1 week = %d bytes in %d files, want 300 in 2", buckets[0].Bytes, buckets[0].Files)
+	}
+}
+
+func TestFindStaleSubtrees(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) int64 {
+		return now.Add(-time.Duration(days) * Day).Unix()
+	}
+
+	root := FileInfo{
+		Name:          "root",
+		Path:          "/test/root",
+		IsDir:         true,
+		Size:          3000,
+		NewestModTime: daysAgo(1),
+		Children: []FileInfo{
+			{Name: "active", Path: "/test/root/active", IsDir: true, Size: 1000, NewestModTime: daysAgo(1)},
+			{
+				Name: "old", Path: "/test/root/old", IsDir: true, Size: 1500, NewestModTime: daysAgo(500),
+				Children: []FileInfo{
+					{Name: "older", Path: "/test/root/old/older", IsDir: true, Size: 1200, NewestModTime: daysAgo(900)},
+				},
+			},
+			{Name: "small", Path: "/test/root/small", IsDir: true, Size: 10, NewestModTime: daysAgo(800)},
+			{Name: "empty", Path: "/test/root/empty", IsDir: true},
+		},
+	}
+
+	stale := FindStaleSubtrees(&root, AgeModified, 365*Day, 100, now)
+	if len(stale) != 1 {
+		t.Fatalf("Found %d stale subtrees, want 1: %v", len(stale), stale)
+	}
+	if stale[0].Path != "/test/root/old" || stale[0].AgeDays != 500 {
+		t.Errorf("Stale subtree = %s aged %d days, want /test/root/old aged 500", stale[0].Path, stale[0].AgeDays)
+	}
+
+	// A longer threshold finds the nested directory
+	stale = FindStaleSubtrees(&root, AgeModified, 700*Day, 100, now)
+	if len(stale) != 1 || stale[0].Path != "/test/root/old/older" {
+		t.Errorf("Stale subtrees = %v, want /test/root/old/older", stale)
+	}
+}
@@ -0,0 +1,288 @@
+package fileinfo
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OtherCategory is the category of files no other category claims
+const OtherCategory = "other"
+
+// Category is a named group of file types shown with its own color
+type Category struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+	// Extensions without the leading dot, matched case-insensitively
+	Extensions []string `json:"extensions"`
+	// Glob patterns matched against the file name, e.g. "Makefile" or "*.tar.*"
+	Globs []string `json:"globs,omitempty"`
+}
+
+// DefaultCategories returns the built-in file type categories
+func DefaultCategories() []Category {
+	return []Category{
+		{
+			Name:       "image",
+			Color:      "#e74c3c",
+			Extensions: []string{"jpg", "jpeg", "png", "gif", "bmp", "tiff", "webp", "svg", "ico", "heic", "heif", "raw", "cr2", "nef", "psd"},
+		},
+		{
+			Name:       "video",
+			Color:      "#9b59b6",
+			Extensions: []string{"mp4", "avi", "mov", "wmv", "flv", "mkv", "webm", "m4v", "mpg", "mpeg", "3gp", "mts", "m2ts"},
+		},
+		{
+			Name:       "audio",
+			Color:      "#2ecc71",
+			Extensions: []string{"mp3", "wav", "ogg", "flac", "aac", "wma", "m4a", "opus", "aiff"},
+		},
+		{
+			Name:  "document",
+			Color: "#f39c12",
+			Extensions: []string{
+				"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx",
+				"txt", "rtf", "odt", "ods", "odp", "md", "csv",
+				"pages", "numbers", "key", "html", "htm", "xml", "json",
+			},
+		},
+		{
+			Name:       "archive",
+			Color:      "#f1c40f",
+			Extensions: []string{"zip", "rar", "7z", "tar", "gz", "tgz", "bz2", "xz", "zst", "lz4"},
+			Globs:      []string{"*.tar.*"},
+		},
+		{
+			Name:  "code",
+			Color: "#1abc9c",
+			Extensions: []string{
+				"go", "js", "mjs", "ts", "jsx", "tsx", "py", "rb", "java", "kt", "scala",
+				"c", "h", "cc", "cpp", "hpp", "cs", "rs", "swift", "m", "php", "pl", "lua",
+				"sh", "bash", "zsh", "css", "scss", "vue", "sql", "yaml", "yml", "toml",
+			},
+			Globs: []string{"Makefile", "Dockerfile", "*.mk"},
+		},
+		{
+			Name:       "binary",
+			Color:      "#34495e",
+			Extensions: []string{"exe", "dll", "so", "dylib", "o", "a", "lib", "bin", "class", "jar", "wasm", "pyc"},
+			Globs:      []string{"*.so.*"},
+		},
+		{
+			Name:       "disk-image",
+			Color:      "#a04000",
+			Extensions: []string{"iso", "dmg", "img", "qcow2", "vmdk", "vdi", "vhd", "vhdx"},
+		},
+		{
+			Name:       "database",
+			Color:      "#ff6f91",
+			Extensions: []string{"db", "sqlite", "sqlite3", "mdb", "accdb", "ibd", "mdf", "ldf", "dbf", "parquet", "rdb"},
+		},
+		{
+			Name:       "model",
+			Color:      "#6c3483",
+			Extensions: []string{"safetensors", "ckpt", "pt", "pth", "onnx", "gguf", "ggml", "h5", "tflite", "mlmodel"},
+		},
+		{
+			Name:  OtherCategory,
+			Color: "#95a5a6",
+		},
+	}
+}
+
+// registry resolves files to categories
+type registry struct {
+	categories []Category
+	byExt      map[string]string
+	globs      []categoryGlob
+}
+
+// categoryGlob is a file name pattern belonging to a category
+type categoryGlob struct {
+	pattern  string
+	category string
+}
+
+// Active category registry
+var (
+	activeRegistry      = newRegistry(DefaultCategories(), nil, nil)
+	activeRegistryMutex sync.RWMutex
+)
+
+// newRegistry builds a registry from the default categories, custom
+// categories that replace or extend them, and extra extension mappings.
+// Custom categories and mappings take precedence over the defaults.
+func newRegistry(defaults, custom []Category, mappings map[string][]string) *registry {
+	r := &registry{byExt: make(map[string]string)}
+
+	// Merge custom categories by name, keeping the default order
+	customByName := make(map[string]bool)
+	for _, c := range custom {
+		customByName[c.Name] = true
+	}
+	for _, d := range defaults {
+		if !customByName[d.Name] {
+			r.categories = append(r.categories, d)
+			continue
+		}
+		for _, c := range custom {
+			if c.Name == d.Name {
+				r.categories = append(r.categories, c)
+			}
+		}
+	}
+	for _, c := range custom {
+		if !r.has(c.Name) {
+			r.categories = append(r.categories, c)
+		}
+	}
+	if !r.has(OtherCategory) {
+		r.categories = append(r.categories, Category{Name: OtherCategory, Color: "#95a5a6"})
+	}
+
+	// The first category to claim an extension or glob wins, so index the
+	// custom ones before the defaults
+	index := func(c Category) {
+		for _, ext := range c.Extensions {
+			ext = normalizeExtension(ext)
+			if _, taken := r.byExt[ext]; !taken {
+				r.byExt[ext] = c.Name
+			}
+		}
+		for _, glob := range c.Globs {
+			r.globs = append(r.globs, categoryGlob{pattern: glob, category: c.Name})
+		}
+	}
+	for _, c := range r.categories {
+		if customByName[c.Name] {
+			index(c)
+		}
+	}
+	for _, c := range r.categories {
+		if !customByName[c.Name] {
+			index(c)
+		}
+	}
+
+	// Extra mappings override everything, adding categories as needed. They
+	// go in name order so the legend is stable and the last name mapping an
+	// extension wins.
+	names := make([]string, 0, len(mappings))
+	for name := range mappings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		extensions := mappings[name]
+		if !r.has(name) {
+			r.categories = append(r.categories, Category{Name: name, Color: "#7f8c8d"})
+		}
+		for i := range r.categories {
+			if r.categories[i].Name == name {
+				r.categories[i].Extensions = append(append([]string{}, r.categories[i].Extensions...), extensions...)
+			}
+		}
+		for _, ext := range extensions {
+			r.byExt[normalizeExtension(ext)] = name
+		}
+	}
+
+	return r
+}
+
+// has reports whether the registry contains a category
+func (r *registry) has(name string) bool {
+	for _, c := range r.categories {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// classify returns the category of a file by extension, then by name globs
+func (r *registry) classify(name, extension string) string {
+	if extension != "" {
+		ext := normalizeExtension(extension)
+		if category, ok := r.byExt[ext]; ok {
+			return category
+		}
+		// Handle compound extensions like tar.gz by their last part
+		if i := strings.LastIndex(ext, "."); i >= 0 {
+			if category, ok := r.byExt[ext[i+1:]]; ok {
+				return category
+			}
+		}
+	}
+
+	if name != "" {
+		for _, glob := range r.globs {
+			if matched, _ := filepath.Match(glob.pattern, name); matched {
+				return glob.category
+			}
+		}
+	}
+
+	return OtherCategory
+}
+
+// normalizeExtension lowercases an extension and strips a leading dot
+func normalizeExtension(ext string) string {
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
+}
+
+// ValidateCategories checks custom categories for missing names and bad globs
+func ValidateCategories(categories []Category) error {
+	seen := make(map[string]bool)
+	for _, c := range categories {
+		if c.Name == "" {
+			return fmt.Errorf("category name is required")
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("duplicate category %q", c.Name)
+		}
+		seen[c.Name] = true
+		for _, glob := range c.Globs {
+			if _, err := filepath.Match(glob, ""); err != nil {
+				return fmt.Errorf("invalid glob %q in category %q: %v", glob, c.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigureCategories replaces the active registry with the default
+// categories merged with custom ones and extra extension mappings
+func ConfigureCategories(custom []Category, mappings map[string][]string) error {
+	if err := ValidateCategories(custom); err != nil {
+		return err
+	}
+
+	r := newRegistry(DefaultCategories(), custom, mappings)
+
+	activeRegistryMutex.Lock()
+	activeRegistry = r
+	activeRegistryMutex.Unlock()
+	return nil
+}
+
+// Categories returns the active file type categories
+func Categories() []Category {
+	activeRegistryMutex.RLock()
+	defer activeRegistryMutex.RUnlock()
+	return append([]Category{}, activeRegistry.categories...)
+}
+
+// ClassifyFile returns the category of a file from its name and extension
+func ClassifyFile(name, extension string) string {
+	activeRegistryMutex.RLock()
+	defer activeRegistryMutex.RUnlock()
+	return activeRegistry.classify(name, extension)
+}
+
+// GetFileType categorizes a file based on its extension
+func GetFileType(extension string) string {
+	return ClassifyFile("", extension)
+}
@@ -0,0 +1,150 @@
+package fileinfo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/steezeburger/storage-shower/internal/logger"
+)
+
+func TestClassifyFile_Globs(t *testing.T) {
+	tests := []struct {
+		name      string
+		extension string
+		expected  string
+	}{
+		{"Makefile", "", "code"},
+		{"Dockerfile", "", "code"},
+		{"libfoo.so.1", "1", "binary"},
+		{"backup.tar.zst", "zst", "archive"},
+		{"data", "", "other"},
+	}
+
+	for _, test := range tests {
+		result := ClassifyFile(test.name, test.extension)
+		if result != test.expected {
+			t.Errorf("ClassifyFile(%q, %q) = %s, want %s", test.name, test.extension, result, test.expected)
+		}
+	}
+}
+
+func TestNewRegistry_CustomCategories(t *testing.T) {
+	custom := []Category{
+		// Replaces the built-in video category
+		{Name: "video", Color: "#000000", Extensions: []string{"braw"}},
+		// New category claiming an extension from a built-in one
+		{Name: "firmware", Color: "#ffffff", Extensions: []string{"bin"}, Globs: []string{"fw-*"}},
+	}
+	mappings := map[string][]string{
+		"model": {".GGUF2"},
+		"logs":  {"log"},
+	}
+
+	r := newRegistry(DefaultCategories(), custom, mappings)
+
+	tests := []struct {
+		name      string
+		extension string
+		expected  string
+	}{
+		{"clip.braw", "braw", "video"},
+		{"clip.mp4", "mp4", "other"}, // no longer listed in the replaced category
+		{"boot.bin", "bin", "firmware"},
+		{"fw-router", "", "firmware"},
+		{"weights.gguf2", "gguf2", "model"},
+		{"app.log", "log", "logs"},
+	}
+
+	for _, test := range tests {
+		result := r.classify(test.name, test.extension)
+		if result != test.expected {
+			t.Errorf("classify(%q, %q) = %s, want %s", test.name, test.extension, result, test.expected)
+		}
+	}
+
+	// Replaced categories keep their position, new ones are appended and
+	// "other" is always present
+	if !r.has("logs") || !r.has(OtherCategory) {
+		t.Errorf("Expected logs and other categories, got %v", r.categories)
+	}
+	for _, c := range r.categories {
+		if c.Name == "video" && c.Color != "#000000" {
+			t.Errorf("Video color = %s, want custom color", c.Color)
+		}
+	}
+}
+
+func TestNewRegistry_MappingOrder(t *testing.T) {
+	mappings := map[string][]string{
+		"zeta":  {"dat"},
+		"alpha": {"dat", "raw"},
+		"mid":   {"raw"},
+	}
+
+	// Map iteration order varies, so build the registry a few times
+	for i := 0; i < 20; i++ {
+		r := newRegistry(DefaultCategories(), nil, mappings)
+
+		var added []string
+		for _, c := range r.categories {
+			if _, ok := mappings[c.Name]; ok {
+				added = append(added, c.Name)
+			}
+		}
+		if want := []string{"alpha", "mid", "zeta"}; !reflect.DeepEqual(added, want) {
+			t.Fatalf("Mapped categories in order %v, want %v", added, want)
+		}
+		if got := r.classify("a.dat", "dat"); got != "zeta" {
+			t.Fatalf("classify(a.dat) = %s, want zeta", got)
+		}
+		if got := r.classify("a.raw", "raw"); got != "mid" {
+			t.Fatalf("classify(a.raw) = %s, want mid", got)
+		}
+	}
+}
+
+func TestValidateCategories(t *testing.T) {
+	tests := []struct {
+		name       string
+		categories []Category
+		valid      bool
+	}{
+		{"empty", nil, true},
+		{"valid", []Category{{Name: "logs", Extensions: []string{"log"}}}, true},
+		{"missing name", []Category{{Extensions: []string{"log"}}}, false},
+		{"duplicate", []Category{{Name: "a"}, {Name: "a"}}, false},
+		{"bad glob", []Category{{Name: "a", Globs: []string{"["}}}, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateCategories(test.categories)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: ValidateCategories() = %v, want valid=%v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestFixDirectorySizes_FileTypes(t *testing.T) {
+	root := FileInfo{
+		Name:  "root",
+		Path:  "/test/root",
+		IsDir: true,
+		Children: []FileInfo{
+			{Name: "main.go", Path: "/test/root/main.go", Size: 10, Extension: "go"},
+			{Name: "photo.jpg", Path: "/test/root/photo.jpg", Size: 20, Extension: "jpg"},
+			{Name: "data", Path: "/test/root/data", Size: 30},
+		},
+	}
+
+	FixDirectorySizes(&root, map[string]*FileInfo{}, logger.NewNoOpLogger())
+
+	expected := FileTypeStats{"code": 10, "image": 20, "other": 30}
+	for category, size := range expected {
+		if root.FileTypes[category] != size {
+			t.Errorf("FileTypes[%s] = %d, want %d", category, root.FileTypes[category], size)
+		}
+	}
+	if root.Children[0].Type != "code" {
+		t.Errorf("Child type = %q, want code", root.Children[0].Type)
+	}
+}
@@ -0,0 +1,48 @@
+package fileinfo
+
+// BrokenLink is a symbolic link whose target doesn't exist
+type BrokenLink struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+// CleanupReport lists the items in a scan result that hold no data
+type CleanupReport struct {
+	// Directories containing nothing but other empty directories; nested
+	// ones are only listed through their topmost empty ancestor
+	EmptyDirs   []string     `json:"emptyDirs"`
+	EmptyFiles  []string     `json:"emptyFiles"`
+	BrokenLinks []BrokenLink `json:"brokenLinks"`
+}
+
+// FindCleanupCandidates returns the empty directories, zero-byte files and
+// broken symbolic links under root, excluding root itself. Small files
+// trimmed from deep levels of a stored result aren't listed, and neither are
+// directories that couldn't be fully read, since they may hold files.
+func FindCleanupCandidates(root *FileInfo) CleanupReport {
+	report := CleanupReport{
+		EmptyDirs:   []string{},
+		EmptyFiles:  []string{},
+		BrokenLinks: []BrokenLink{},
+	}
+
+	var walk func(n *FileInfo)
+	walk = func(n *FileInfo) {
+		for i := range n.Children {
+			child := &n.Children[i]
+			switch {
+			case child.BrokenLink:
+				report.BrokenLinks = append(report.BrokenLinks, BrokenLink{Path: child.Path, Target: child.LinkTarget})
+			case child.IsDir && child.FileCount == 0 && child.Size == 0 && !child.Incomplete && !child.TimedOut:
+				report.EmptyDirs = append(report.EmptyDirs, child.Path)
+			case child.IsDir:
+				walk(child)
+			case child.Size == 0 && child.Mode.IsRegular():
+				report.EmptyFiles = append(report.EmptyFiles, child.Path)
+			}
+		}
+	}
+	walk(root)
+
+	return report
+}
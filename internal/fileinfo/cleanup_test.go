@@ -0,0 +1,100 @@
+package fileinfo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/steezeburger/storage-shower/internal/logger"
+)
+
+func TestFindCleanupCandidates(t *testing.T) {
+	nested := FileInfo{Name: "nested", Path: "/test/root/empty/nested", IsDir: true}
+	empty := FileInfo{
+		Name:     "empty",
+		Path:     "/test/root/empty",
+		IsDir:    true,
+		Children: []FileInfo{{Name: "nested", Path: "/test/root/empty/nested", IsDir: true}},
+	}
+	data := FileInfo{
+		Name:  "data",
+		Path:  "/test/root/data",
+		IsDir: true,
+		Children: []FileInfo{
+			{Name: "placeholder", Path: "/test/root/data/placeholder"},
+			{Name: "file", Path: "/test/root/data/file", Size: 10},
+			{Name: "link", Path: "/test/root/data/link", LinkTarget: "../gone", BrokenLink: true},
+		},
+	}
+	root := FileInfo{
+		Name:  "root",
+		Path:  "/test/root",
+		IsDir: true,
+		Children: []FileInfo{
+			{Name: "empty", Path: "/test/root/empty", IsDir: true},
+			{Name: "data", Path: "/test/root/data", IsDir: true},
+		},
+	}
+	dirMap := map[string]*FileInfo{
+		"/test/root/empty":        &empty,
+		"/test/root/empty/nested": &nested,
+		"/test/root/data":         &data,
+	}
+	FixDirectorySizes(&root, dirMap, logger.NewNoOpLogger())
+	root.Children[0] = empty
+	root.Children[1] = data
+
+	report := FindCleanupCandidates(&root)
+	want := CleanupReport{
+		EmptyDirs:   []string{"/test/root/empty"},
+		EmptyFiles:  []string{"/test/root/data/placeholder"},
+		BrokenLinks: []BrokenLink{{Path: "/test/root/data/link", Target: "../gone"}},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("FindCleanupCandidates = %+v, want %+v", report, want)
+	}
+}
+
+func TestFindCleanupCandidates_Unread(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  FileInfo
+		want []string
+	}{
+		{
+			name: "complete",
+			dir:  FileInfo{Name: "dir", Path: "/test/root/dir", IsDir: true},
+			want: []string{"/test/root/dir"},
+		},
+		{
+			name: "incomplete",
+			dir:  FileInfo{Name: "dir", Path: "/test/root/dir", IsDir: true, Incomplete: true},
+			want: []string{},
+		},
+		{
+			name: "timed out",
+			dir:  FileInfo{Name: "dir", Path: "/test/root/dir", IsDir: true, Incomplete: true, TimedOut: true},
+			want: []string{},
+		},
+		{
+			name: "empty child of an incomplete directory",
+			dir: FileInfo{
+				Name:       "dir",
+				Path:       "/test/root/dir",
+				IsDir:      true,
+				Incomplete: true,
+				Children:   []FileInfo{{Name: "empty", Path: "/test/root/dir/empty", IsDir: true}},
+			},
+			want: []string{"/test/root/dir/empty"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := FileInfo{Name: "root", Path: "/test/root", IsDir: true, Children: []FileInfo{tt.dir}}
+			report := FindCleanupCandidates(&root)
+			if !reflect.DeepEqual(report.EmptyDirs, tt.want) {
+				t.Errorf("EmptyDirs = %v, want %v", report.EmptyDirs, tt.want)
+			}
+		})
+	}
+}
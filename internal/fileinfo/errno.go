@@ -0,0 +1,17 @@
+//go:build !plan9
+
+package fileinfo
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errnoOf returns the system error number wrapped in err, or 0
+func errnoOf(err error) int {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return int(errno)
+	}
+	return 0
+}
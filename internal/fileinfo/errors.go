@@ -0,0 +1,50 @@
+package fileinfo
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Maximum number of errors kept in a scan result
+const MaxScanErrors = 1000
+
+// ScanError is an entry a scan couldn't read
+type ScanError struct {
+	Path string `json:"path"`
+	// Operation that failed, e.g. "readdir" or "lstat"
+	Op string `json:"op"`
+	// System error number, where the platform reports one
+	Errno   int    `json:"errno,omitempty"`
+	Message string `json:"message"`
+	// Size of the path in the previous scan of the same root, which this
+	// scan possibly missed
+	MissingBytes int64 `json:"missingBytes,omitempty"`
+}
+
+// NewScanError describes an error reading path
+func NewScanError(path, op string, err error) ScanError {
+	scanErr := ScanError{Path: path, Op: op, Message: err.Error()}
+
+	// Report the underlying error without the path the message repeats
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		scanErr.Message = pathErr.Err.Error()
+	}
+	scanErr.Errno = errnoOf(err)
+	return scanErr
+}
+
+// EstimateMissingBytes sets the bytes each error possibly hid from the size
+// of its path in a previous result of the same root, and returns their total
+func EstimateMissingBytes(scanErrors []ScanError, previous *FileInfo) int64 {
+	var total int64
+	for i := range scanErrors {
+		node := FindNode(previous, scanErrors[i].Path)
+		if node == nil {
+			continue
+		}
+		scanErrors[i].MissingBytes = node.Size
+		total += node.Size
+	}
+	return total
+}
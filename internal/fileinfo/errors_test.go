@@ -0,0 +1,69 @@
+package fileinfo
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/steezeburger/storage-shower/internal/logger"
+)
+
+func TestNewScanError(t *testing.T) {
+	err := &fs.PathError{Op: "open", Path: "/data/private", Err: fs.ErrPermission}
+	scanErr := NewScanError("/data/private", "readdir", err)
+
+	if scanErr.Path != "/data/private" || scanErr.Op != "readdir" {
+		t.Errorf("NewScanError() = %+v", scanErr)
+	}
+	if scanErr.Message != fs.ErrPermission.Error() {
+		t.Errorf("Message = %q, want %q", scanErr.Message, fs.ErrPermission.Error())
+	}
+
+	// Plan 9 reports errors as strings without numbers
+	if runtime.GOOS != "plan9" {
+		_, statErr := os.Lstat("/definitely/missing/path")
+		if got := NewScanError("/definitely/missing/path", "lstat", statErr); got.Errno == 0 {
+			t.Errorf("NewScanError() = %+v, want the system error number", got)
+		}
+	}
+
+	if got := NewScanError("/x", "lstat", errors.New("boom")); got.Message != "boom" || got.Errno != 0 {
+		t.Errorf("Plain error = %+v", got)
+	}
+}
+
+func TestEstimateMissingBytes(t *testing.T) {
+	previous, dirMap := testTree()
+	FixDirectorySizes(&previous, dirMap, logger.NewNoOpLogger())
+
+	scanErrors := []ScanError{
+		{Path: "/test/root/clips", Op: "readdir"},
+		{Path: "/test/root/README", Op: "lstat"},
+		{Path: "/test/root/new", Op: "readdir"},
+	}
+	if total := EstimateMissingBytes(scanErrors, &previous); total != 560 {
+		t.Errorf("EstimateMissingBytes() = %d, want 560", total)
+	}
+	if scanErrors[0].MissingBytes != 550 || scanErrors[1].MissingBytes != 10 || scanErrors[2].MissingBytes != 0 {
+		t.Errorf("Missing bytes per error = %+v", scanErrors)
+	}
+}
+
+func TestFixDirectorySizes_Incomplete(t *testing.T) {
+	root, dirMap := testTree()
+	dirMap["/test/root/clips"].Incomplete = true
+	FixDirectorySizes(&root, dirMap, logger.NewNoOpLogger())
+
+	if !root.Incomplete || !root.Children[0].Incomplete {
+		t.Errorf("Incomplete directory should mark its ancestors, got root %v, clips %v",
+			root.Incomplete, root.Children[0].Incomplete)
+	}
+
+	complete, dirMap := testTree()
+	FixDirectorySizes(&complete, dirMap, logger.NewNoOpLogger())
+	if complete.Incomplete {
+		t.Error("Tree without errors marked incomplete")
+	}
+}
@@ -0,0 +1,90 @@
+package fileinfo
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExtensionStat holds the bytes and number of files with one extension
+type ExtensionStat struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// ExtensionStats holds the stats of each lowercased extension in a
+// directory tree; files without an extension are counted under ""
+type ExtensionStats map[string]ExtensionStat
+
+// Add adds the stats of every extension in other to s
+func (s ExtensionStats) Add(other ExtensionStats) {
+	for ext, stat := range other {
+		s.addFiles(ext, stat.Bytes, stat.Files)
+	}
+}
+
+// addFiles adds files with the given extension and total size to s
+func (s ExtensionStats) addFiles(ext string, bytes, files int64) {
+	stat := s[ext]
+	stat.Bytes += bytes
+	stat.Files += files
+	s[ext] = stat
+}
+
+// ExtensionCount is the stat of one extension in a ranking
+type ExtensionCount struct {
+	Extension string `json:"extension"`
+	ExtensionStat
+}
+
+// Top returns the n extensions using the most bytes, largest first.
+// A non-positive n returns all of them.
+func (s ExtensionStats) Top(n int) []ExtensionCount {
+	counts := make([]ExtensionCount, 0, len(s))
+	for ext, stat := range s {
+		counts = append(counts, ExtensionCount{Extension: ext, ExtensionStat: stat})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Bytes != counts[j].Bytes {
+			return counts[i].Bytes > counts[j].Bytes
+		}
+		return counts[i].Extension < counts[j].Extension
+	})
+
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// FindNode returns the node with the given path in the tree rooted at root,
+// or nil if there's none
+func FindNode(root *FileInfo, path string) *FileInfo {
+	path = filepath.Clean(path)
+	if filepath.Clean(root.Path) == path {
+		return root
+	}
+
+	for i := range root.Children {
+		child := &root.Children[i]
+		childPath := filepath.Clean(child.Path)
+		if childPath == path {
+			return child
+		}
+		// Only descend into the directory or archive containing path
+		if (child.IsDir || child.Archive != "") && strings.HasPrefix(path, childPath+string(filepath.Separator)) {
+			return FindNode(child, path)
+		}
+	}
+	return nil
+}
+
+// StripExtensionStats removes the per-extension stats from every node in
+// the tree rooted at node
+func StripExtensionStats(node *FileInfo) {
+	node.Extensions = nil
+	for i := range node.Children {
+		StripExtensionStats(&node.Children[i])
+	}
+}
@@ -0,0 +1,101 @@
+package fileinfo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/steezeburger/storage-shower/internal/logger"
+)
+
+func testTree() (FileInfo, map[string]*FileInfo) {
+	sub := FileInfo{
+		Name:  "clips",
+		Path:  "/test/root/clips",
+		IsDir: true,
+		Children: []FileInfo{
+			{Name: "a.mov", Path: "/test/root/clips/a.mov", Size: 300, Extension: "mov"},
+			{Name: "b.MOV", Path: "/test/root/clips/b.MOV", Size: 200, Extension: "MOV"},
+			{Name: "c.mp4", Path: "/test/root/clips/c.mp4", Size: 50, Extension: "mp4"},
+		},
+	}
+	root := FileInfo{
+		Name:  "root",
+		Path:  "/test/root",
+		IsDir: true,
+		Children: []FileInfo{
+			{Name: "clips", Path: "/test/root/clips", IsDir: true},
+			{Name: "d.mp4", Path: "/test/root/d.mp4", Size: 100, Extension: "mp4"},
+			{Name: "README", Path: "/test/root/README", Size: 10},
+		},
+	}
+	return root, map[string]*FileInfo{"/test/root/clips": &sub}
+}
+
+func TestFixDirectorySizes_Extensions(t *testing.T) {
+	root, dirMap := testTree()
+	FixDirectorySizes(&root, dirMap, logger.NewNoOpLogger())
+
+	expected := ExtensionStats{
+		"mov": {Bytes: 500, Files: 2},
+		"mp4": {Bytes: 150, Files: 2},
+		"":    {Bytes: 10, Files: 1},
+	}
+	if !reflect.DeepEqual(root.Extensions, expected) {
+		t.Errorf("Extensions = %v, want %v", root.Extensions, expected)
+	}
+	if root.Children[0].Extensions["mov"].Files != 2 {
+		t.Errorf("Child extensions = %v, want 2 mov files", root.Children[0].Extensions)
+	}
+}
+
+func TestExtensionStats_Top(t *testing.T) {
+	stats := ExtensionStats{
+		"mov": {Bytes: 500, Files: 2},
+		"mp4": {Bytes: 150, Files: 2},
+		"txt": {Bytes: 150, Files: 9},
+		"":    {Bytes: 10, Files: 1},
+	}
+
+	top := stats.Top(3)
+	var got []string
+	for _, count := range top {
+		got = append(got, count.Extension)
+	}
+	if want := []string{"mov", "mp4", "txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Top(3) = %v, want %v", got, want)
+	}
+
+	if all := stats.Top(0); len(all) != 4 {
+		t.Errorf("Top(0) returned %d extensions, want 4", len(all))
+	}
+}
+
+func TestFindNode(t *testing.T) {
+	root, dirMap := testTree()
+	FixDirectorySizes(&root, dirMap, logger.NewNoOpLogger())
+	root.Children[0] = *dirMap["/test/root/clips"]
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/test/root", "root"},
+		{"/test/root/", "root"},
+		{"/test/root/clips", "clips"},
+		{"/test/root/clips/b.MOV", "b.MOV"},
+		{"/test/root/d.mp4", "d.mp4"},
+		{"/test/root/missing", ""},
+		{"/test/rootless", ""},
+	}
+
+	for _, test := range tests {
+		node := FindNode(&root, test.path)
+		got := ""
+		if node != nil {
+			got = node.Name
+		}
+		if got != test.expected {
+			t.Errorf("FindNode(%q) = %q, want %q", test.path, got, test.expected)
+		}
+	}
+}
@@ -2,31 +2,88 @@ package fileinfo
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/steezeburger/storage-shower/internal/logger"
 )
 
-// FileTypeStats represents statistics about file types in a directory
-type FileTypeStats struct {
-	Image    int64 `json:"image"`
-	Video    int64 `json:"video"`
-	Audio    int64 `json:"audio"`
-	Document int64 `json:"document"`
-	Archive  int64 `json:"archive"`
-	Other    int64 `json:"other"`
+// FileTypeStats holds the bytes of each file type category in a directory
+type FileTypeStats map[string]int64
+
+// Add adds the bytes of every category in other to s
+func (s FileTypeStats) Add(other FileTypeStats) {
+	for category, size := range other {
+		s[category] += size
+	}
 }
 
 // FileInfo represents information about a file or directory
 type FileInfo struct {
-	Name      string         `json:"name"`
-	Path      string         `json:"path"`
-	Size      int64          `json:"size"`
-	IsDir     bool           `json:"isDir"`
-	Children  []FileInfo     `json:"children,omitempty"`
-	Extension string         `json:"extension,omitempty"`
-	FileTypes *FileTypeStats `json:"fileTypes,omitempty"`
+	Name      string        `json:"name"`
+	Path      string        `json:"path"`
+	Size      int64         `json:"size"`
+	IsDir     bool          `json:"isDir"`
+	Children  []FileInfo    `json:"children,omitempty"`
+	Extension string        `json:"extension,omitempty"`
+	Type      string        `json:"type,omitempty"`
+	MIMEType  string        `json:"mimeType,omitempty"`
+	FileTypes FileTypeStats `json:"fileTypes,omitempty"`
+	// Per-extension stats of the directory tree
+	Extensions ExtensionStats `json:"extensions,omitempty"`
+	// Number of files, directories and both in the directory tree
+	FileCount int64 `json:"fileCount,omitempty"`
+	DirCount  int64 `json:"dirCount,omitempty"`
+	ItemCount int64 `json:"itemCount,omitempty"`
+	// Modification, access and status change times in Unix seconds
+	ModTime    int64 `json:"modTime,omitempty"`
+	AccessTime int64 `json:"accessTime,omitempty"`
+	ChangeTime int64 `json:"changeTime,omitempty"`
+	// Newest modification and access times of the files in the directory tree
+	NewestModTime    int64 `json:"newestModTime,omitempty"`
+	NewestAccessTime int64 `json:"newestAccessTime,omitempty"`
+	// Format of an archive whose members are listed as its children, and
+	// the content size of an archive, its members and virtual directories,
+	// whose Size is the bytes they take up in the archive
+	Archive          string `json:"archive,omitempty"`
+	UncompressedSize int64  `json:"uncompressedSize,omitempty"`
+	// Git objects counted into the entry, such as the versions of a path in
+	// the history of a repository
+	Objects int64 `json:"objects,omitempty"`
+	// Bytes allocated on disk for a file, which differ from Size for sparse
+	// and compressed files; 0 where the platform doesn't report it
+	DiskUsage int64 `json:"diskUsage,omitempty"`
+	// Ownership, where the platform reports it; names fall back to the IDs
+	UID   uint32 `json:"uid,omitempty"`
+	GID   uint32 `json:"gid,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Type and permission bits
+	Mode os.FileMode `json:"mode,omitempty"`
+	// Target of a symbolic link, and whether it points nowhere
+	LinkTarget string `json:"linkTarget,omitempty"`
+	BrokenLink bool   `json:"brokenLink,omitempty"`
+	// Bytes per owning user and group in the directory tree
+	Owners OwnerStats `json:"owners,omitempty"`
+	Groups OwnerStats `json:"groups,omitempty"`
+	// Container image layer, numbered from 1 for the base layer, that last
+	// wrote the entry, and the bytes per layer in the directory tree
+	Layer      int        `json:"layer,omitempty"`
+	LayerSizes LayerStats `json:"layerSizes,omitempty"`
+	// Some entries of the directory tree couldn't be read, so its totals may
+	// be too low
+	Incomplete bool `json:"incomplete,omitempty"`
+	// Reading the directory took longer than the read timeout, so its
+	// contents are missing
+	TimedOut bool `json:"timedOut,omitempty"`
+	// Errors of the whole scan, set on the root only. Errors holds up to
+	// MaxScanErrors of them, ErrorCount counts all.
+	Errors       []ScanError `json:"errors,omitempty"`
+	ErrorCount   int         `json:"errorCount,omitempty"`
+	MissingBytes int64       `json:"missingBytes,omitempty"`
+	// Image whose merged file system was scanned, set on the root only
+	Image *ImageInfo `json:"image,omitempty"`
 }
 
 // FixDirectorySizes updates directory sizes based on their children
@@ -38,7 +95,13 @@ func FixDirectorySizes(dir *FileInfo, dirMap map[string]*FileInfo, log logger.Lo
 	log.Debug("Fixing directory size for: %s", dir.Path)
 
 	var totalSize int64 = 0
-	fileTypeStats := &FileTypeStats{}
+	fileTypeStats := FileTypeStats{}
+	extensionStats := ExtensionStats{}
+	ownerStats := OwnerStats{}
+	groupStats := OwnerStats{}
+	layerStats := LayerStats{}
+	var fileCount, dirCount, newestModTime, newestAccessTime int64
+	incomplete := dir.Incomplete
 
 	for i := range dir.Children {
 		log.Debug("  Child %d: %s (initial size: %d, isDir: %v)",
@@ -46,6 +109,8 @@ func FixDirectorySizes(dir *FileInfo, dirMap map[string]*FileInfo, log logger.Lo
 
 		childSize := dir.Children[i].Size
 		if dir.Children[i].IsDir {
+			dirCount++
+
 			// Recursively fix child directory sizes
 			childPath := dir.Children[i].Path
 			// Normalize the child path for consistent lookup
@@ -61,52 +126,101 @@ func FixDirectorySizes(dir *FileInfo, dirMap map[string]*FileInfo, log logger.Lo
 				// Update the size in our children array too
 				dir.Children[i].Size = childSize
 				dir.Children[i].FileTypes = childDir.FileTypes
+				dir.Children[i].Extensions = childDir.Extensions
+				dir.Children[i].FileCount = childDir.FileCount
+				dir.Children[i].DirCount = childDir.DirCount
+				dir.Children[i].ItemCount = childDir.ItemCount
+				dir.Children[i].NewestModTime = childDir.NewestModTime
+				dir.Children[i].NewestAccessTime = childDir.NewestAccessTime
+				dir.Children[i].Owners = childDir.Owners
+				dir.Children[i].Groups = childDir.Groups
+				dir.Children[i].LayerSizes = childDir.LayerSizes
+				dir.Children[i].Incomplete = childDir.Incomplete
+				dir.Children[i].TimedOut = childDir.TimedOut
 				log.Debug("  Updated child size to: %d", childSize)
 
 				// Aggregate file type stats from child directory
-				if childDir.FileTypes != nil {
-					fileTypeStats.Image += childDir.FileTypes.Image
-					fileTypeStats.Video += childDir.FileTypes.Video
-					fileTypeStats.Audio += childDir.FileTypes.Audio
-					fileTypeStats.Document += childDir.FileTypes.Document
-					fileTypeStats.Archive += childDir.FileTypes.Archive
-					fileTypeStats.Other += childDir.FileTypes.Other
-				}
+				fileTypeStats.Add(childDir.FileTypes)
+				extensionStats.Add(childDir.Extensions)
+				fileCount += childDir.FileCount
+				dirCount += childDir.DirCount
+				newestModTime = max(newestModTime, childDir.NewestModTime)
+				newestAccessTime = max(newestAccessTime, childDir.NewestAccessTime)
+				ownerStats.Add(childDir.Owners)
+				groupStats.Add(childDir.Groups)
+				layerStats.Add(childDir.LayerSizes)
+				incomplete = incomplete || childDir.Incomplete
 			} else {
 				log.Debug("  WARNING: Child directory not found in dirMap: %s", childPath)
 			}
 		} else {
 			// For files, add their size to the appropriate file type category
-			fileType := GetFileType(dir.Children[i].Extension)
-			switch fileType {
-			case "image":
-				fileTypeStats.Image += childSize
-			case "video":
-				fileTypeStats.Video += childSize
-			case "audio":
-				fileTypeStats.Audio += childSize
-			case "document":
-				fileTypeStats.Document += childSize
-			case "archive":
-				fileTypeStats.Archive += childSize
-			default:
-				fileTypeStats.Other += childSize
+			fileCount++
+			newestModTime = max(newestModTime, dir.Children[i].ModTime)
+			newestAccessTime = max(newestAccessTime, dir.Children[i].AccessTime)
+			fileType := classifyEntry(&dir.Children[i])
+			dir.Children[i].Type = fileType
+			fileTypeStats[fileType] += childSize
+			extensionStats.addFiles(normalizeExtension(dir.Children[i].Extension), childSize, 1)
+			if owner := dir.Children[i].Owner; owner != "" {
+				ownerStats[owner] += childSize
+			}
+			if group := dir.Children[i].Group; group != "" {
+				groupStats[group] += childSize
+			}
+			if layer := dir.Children[i].Layer; layer > 0 {
+				layerStats[layer] += childSize
 			}
 		}
 		totalSize += childSize
 	}
 
 	log.Debug("  Total size for %s: %d bytes", dir.Path, totalSize)
-	log.Debug("  File type stats: Image: %d, Video: %d, Audio: %d, Document: %d, Archive: %d, Other: %d",
-		fileTypeStats.Image, fileTypeStats.Video, fileTypeStats.Audio,
-		fileTypeStats.Document, fileTypeStats.Archive, fileTypeStats.Other)
+	log.Debug("  File type stats: %v", fileTypeStats)
 
 	// Set this directory's size and file type stats
 	dir.Size = totalSize
 	dir.FileTypes = fileTypeStats
+	dir.Extensions = extensionStats
+	dir.FileCount = fileCount
+	dir.DirCount = dirCount
+	dir.ItemCount = fileCount + dirCount
+	dir.NewestModTime = newestModTime
+	dir.NewestAccessTime = newestAccessTime
+	dir.Owners = ownerStats
+	dir.Groups = groupStats
+	dir.LayerSizes = layerStats
+	dir.Incomplete = incomplete
 	return totalSize
 }
 
+// SumUncompressed totals the content sizes of the files below each
+// directory of a tree whose files have an UncompressedSize, such as the
+// members of an archive, and returns the total of dir
+func SumUncompressed(dir *FileInfo) int64 {
+	if !dir.IsDir {
+		return dir.UncompressedSize
+	}
+	var total int64
+	for i := range dir.Children {
+		total += SumUncompressed(&dir.Children[i])
+	}
+	dir.UncompressedSize = total
+	return total
+}
+
+// classifyEntry returns the category of a file, falling back to its sniffed
+// content type when the name doesn't identify it
+func classifyEntry(f *FileInfo) string {
+	fileType := ClassifyFile(f.Name, f.Extension)
+	if fileType == OtherCategory && f.MIMEType != "" {
+		if category := CategoryForMIME(f.MIMEType); category != "" {
+			return category
+		}
+	}
+	return fileType
+}
+
 // IsHidden determines if a file is hidden (starts with a dot)
 func IsHidden(path string) bool {
 	name := filepath.Base(path)
@@ -117,74 +231,6 @@ func IsHidden(path string) bool {
 	return strings.HasPrefix(name, ".") && name != "." && name != ".."
 }
 
-// GetFileType categorizes a file based on its extension
-func GetFileType(extension string) string {
-	if extension == "" {
-		return "other"
-	}
-
-	// Convert extension to lowercase for case-insensitive matching
-	ext := strings.ToLower(extension)
-
-	// Handle compound extensions like tar.gz
-	if strings.Contains(ext, ".") {
-		parts := strings.Split(ext, ".")
-		lastPart := parts[len(parts)-1]
-
-		// Special case for common archive formats
-		if lastPart == "gz" || lastPart == "bz2" || lastPart == "xz" {
-			return "archive"
-		}
-	}
-
-	// Image formats
-	imageFormats := []string{"jpg", "jpeg", "png", "gif", "bmp", "tiff", "webp", "svg", "ico", "heic", "heif"}
-	for _, format := range imageFormats {
-		if ext == format {
-			return "image"
-		}
-	}
-
-	// Video formats
-	videoFormats := []string{"mp4", "avi", "mov", "wmv", "flv", "mkv", "webm", "m4v", "mpg", "mpeg", "3gp"}
-	for _, format := range videoFormats {
-		if ext == format {
-			return "video"
-		}
-	}
-
-	// Audio formats
-	audioFormats := []string{"mp3", "wav", "ogg", "flac", "aac", "wma", "m4a", "opus"}
-	for _, format := range audioFormats {
-		if ext == format {
-			return "audio"
-		}
-	}
-
-	// Document formats
-	documentFormats := []string{
-		"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx",
-		"txt", "rtf", "odt", "ods", "odp", "md", "csv",
-		"pages", "numbers", "key", "html", "htm", "xml", "json",
-	}
-	for _, format := range documentFormats {
-		if ext == format {
-			return "document"
-		}
-	}
-
-	// Archive formats
-	archiveFormats := []string{"zip", "rar", "7z", "tar", "gz", "bz2", "xz", "iso", "dmg"}
-	for _, format := range archiveFormats {
-		if ext == format {
-			return "archive"
-		}
-	}
-
-	// Default to "other" for unrecognized extensions
-	return "other"
-}
-
 // FormatBytes converts a byte count to a human-readable string
 func FormatBytes(bytes int64) string {
 	const unit = 1024
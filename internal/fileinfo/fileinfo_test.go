@@ -173,7 +173,12 @@ func TestGetFileType(t *testing.T) {
 		{"docx", "document"},
 		{"zip", "archive"},
 		{"tar.gz", "archive"},
-		{"exe", "other"},
+		{"go", "code"},
+		{"exe", "binary"},
+		{"qcow2", "disk-image"},
+		{"sqlite", "database"},
+		{"safetensors", "model"},
+		{"xyz123", "other"},
 		{"", "other"},
 	}
 
@@ -184,3 +189,24 @@ func TestGetFileType(t *testing.T) {
 		}
 	}
 }
+
+func TestFixDirectorySizes_Counts(t *testing.T) {
+	root, dirMap := testTree()
+	FixDirectorySizes(&root, dirMap, logger.NewNoOpLogger())
+
+	tests := []struct {
+		name               string
+		node               FileInfo
+		files, dirs, items int64
+	}{
+		{"root", root, 5, 1, 6},
+		{"clips", root.Children[0], 3, 0, 3},
+	}
+
+	for _, test := range tests {
+		if test.node.FileCount != test.files || test.node.DirCount != test.dirs || test.node.ItemCount != test.items {
+			t.Errorf("%s counts = %d files, %d dirs, %d items, want %d, %d, %d", test.name,
+				test.node.FileCount, test.node.DirCount, test.node.ItemCount, test.files, test.dirs, test.items)
+		}
+	}
+}
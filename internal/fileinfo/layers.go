@@ -0,0 +1,37 @@
+package fileinfo
+
+// ImageInfo describes the container image a scan result was read from
+type ImageInfo struct {
+	// Source of the image, "oci" for an image layout or "docker" for a
+	// docker save tarball
+	Format string `json:"format"`
+	// Tags or reference names of the image
+	Tags   []string     `json:"tags,omitempty"`
+	Layers []ImageLayer `json:"layers"`
+}
+
+// ImageLayer is one layer of a container image, in the order the layers are
+// applied
+type ImageLayer struct {
+	Digest string `json:"digest"`
+	// Build step that created the layer, from the image history
+	CreatedBy string `json:"createdBy,omitempty"`
+	// Bytes of the layer as stored in the image
+	Size int64 `json:"size"`
+	// Bytes of the files the layer adds, and of those not replaced or
+	// deleted by later layers
+	UncompressedSize int64 `json:"uncompressedSize"`
+	VisibleSize      int64 `json:"visibleSize"`
+	Files            int64 `json:"files"`
+}
+
+// LayerStats holds the bytes each image layer, numbered from 1, contributes
+// to a directory tree
+type LayerStats map[int]int64
+
+// Add adds the bytes of every layer in other to s
+func (s LayerStats) Add(other LayerStats) {
+	for layer, size := range other {
+		s[layer] += size
+	}
+}
@@ -0,0 +1,40 @@
+package fileinfo
+
+import "sort"
+
+// OwnerStats holds the bytes owned by each user or group in a directory tree
+type OwnerStats map[string]int64
+
+// Add adds the bytes of every owner in other to s
+func (s OwnerStats) Add(other OwnerStats) {
+	for owner, size := range other {
+		s[owner] += size
+	}
+}
+
+// OwnerUsage is the usage of one owner in a ranking
+type OwnerUsage struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Top returns the n owners using the most bytes, largest first.
+// A non-positive n returns all of them.
+func (s OwnerStats) Top(n int) []OwnerUsage {
+	usage := make([]OwnerUsage, 0, len(s))
+	for name, size := range s {
+		usage = append(usage, OwnerUsage{Name: name, Bytes: size})
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Bytes != usage[j].Bytes {
+			return usage[i].Bytes > usage[j].Bytes
+		}
+		return usage[i].Name < usage[j].Name
+	})
+
+	if n > 0 && len(usage) > n {
+		usage = usage[:n]
+	}
+	return usage
+}
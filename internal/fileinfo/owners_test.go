@@ -0,0 +1,54 @@
+package fileinfo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/steezeburger/storage-shower/internal/logger"
+)
+
+func TestFixDirectorySizes_Owners(t *testing.T) {
+	home := FileInfo{
+		Name:  "home",
+		Path:  "/test/root/home",
+		IsDir: true,
+		Children: []FileInfo{
+			{Name: "a", Path: "/test/root/home/a", Size: 300, Owner: "alice", Group: "staff"},
+			{Name: "b", Path: "/test/root/home/b", Size: 200, Owner: "bob", Group: "staff"},
+		},
+	}
+	root := FileInfo{
+		Name:  "root",
+		Path:  "/test/root",
+		IsDir: true,
+		Children: []FileInfo{
+			{Name: "home", Path: "/test/root/home", IsDir: true},
+			{Name: "c", Path: "/test/root/c", Size: 100, Owner: "alice", Group: "wheel"},
+			{Name: "d", Path: "/test/root/d", Size: 50},
+		},
+	}
+
+	FixDirectorySizes(&root, map[string]*FileInfo{"/test/root/home": &home}, logger.NewNoOpLogger())
+
+	if want := (OwnerStats{"alice": 400, "bob": 200}); !reflect.DeepEqual(root.Owners, want) {
+		t.Errorf("Owners = %v, want %v", root.Owners, want)
+	}
+	if want := (OwnerStats{"staff": 500, "wheel": 100}); !reflect.DeepEqual(root.Groups, want) {
+		t.Errorf("Groups = %v, want %v", root.Groups, want)
+	}
+	if want := (OwnerStats{"alice": 300, "bob": 200}); !reflect.DeepEqual(root.Children[0].Owners, want) {
+		t.Errorf("Child owners = %v, want %v", root.Children[0].Owners, want)
+	}
+}
+
+func TestOwnerStats_Top(t *testing.T) {
+	stats := OwnerStats{"alice": 400, "bob": 200, "carol": 200, "dave": 10}
+
+	want := []OwnerUsage{{"alice", 400}, {"bob", 200}, {"carol", 200}}
+	if got := stats.Top(3); !reflect.DeepEqual(got, want) {
+		t.Errorf("Top(3) = %v, want %v", got, want)
+	}
+	if got := stats.Top(0); len(got) != 4 {
+		t.Errorf("Top(0) returned %d owners, want 4", len(got))
+	}
+}
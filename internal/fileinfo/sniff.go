@@ -0,0 +1,105 @@
+package fileinfo
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// SniffLen is the number of leading bytes needed to detect a content type
+const SniffLen = 512
+
+// signature is a magic number identifying a file format
+type signature struct {
+	offset   int
+	magic    []byte
+	mimeType string
+}
+
+// Signatures for formats net/http.DetectContentType doesn't know about,
+// checked before falling back to it
+var signatures = []signature{
+	{0, []byte("\x7fELF"), "application/x-elf"},
+	{0, []byte("\xfe\xed\xfa\xce"), "application/x-mach-binary"},
+	{0, []byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+	{0, []byte("\xce\xfa\xed\xfe"), "application/x-mach-binary"},
+	{0, []byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{0, []byte("\xca\xfe\xba\xbe"), "application/x-mach-binary"},
+	{0, []byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{0, []byte("\x00asm"), "application/wasm"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{0, []byte("PAR1"), "application/vnd.apache.parquet"},
+	{0, []byte("QFI\xfb"), "application/x-qemu-disk"},
+	{0, []byte("KDMV"), "application/x-vmdk"},
+	{0, []byte("vhdxfile"), "application/x-vhdx"},
+	{0, []byte("conectix"), "application/x-vhd"},
+	{0, []byte("GGUF"), "application/x-gguf"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{0, []byte("\x28\xb5\x2f\xfd"), "application/zstd"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{257, []byte("ustar"), "application/x-tar"},
+}
+
+// DetectContentType returns the MIME type of data from its leading bytes.
+// At most SniffLen bytes are considered.
+func DetectContentType(data []byte) string {
+	for _, sig := range signatures {
+		end := sig.offset + len(sig.magic)
+		if len(data) >= end && bytes.Equal(data[sig.offset:end], sig.magic) {
+			return sig.mimeType
+		}
+	}
+
+	mimeType := http.DetectContentType(data)
+	// Drop parameters such as "; charset=utf-8"
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return mimeType
+}
+
+// mimeCategories maps MIME types to built-in categories
+var mimeCategories = map[string]string{
+	"application/pdf":                               "document",
+	"application/postscript":                        "document",
+	"application/zip":                               "archive",
+	"application/x-gzip":                            "archive",
+	"application/x-tar":                             "archive",
+	"application/x-bzip2":                           "archive",
+	"application/x-xz":                              "archive",
+	"application/zstd":                              "archive",
+	"application/x-7z-compressed":                   "archive",
+	"application/x-rar-compressed":                  "archive",
+	"application/x-elf":                             "binary",
+	"application/x-mach-binary":                     "binary",
+	"application/vnd.microsoft.portable-executable": "binary",
+	"application/wasm":                              "binary",
+	"application/vnd.sqlite3":                       "database",
+	"application/vnd.apache.parquet":                "database",
+	"application/x-qemu-disk":                       "disk-image",
+	"application/x-vmdk":                            "disk-image",
+	"application/x-vhdx":                            "disk-image",
+	"application/x-vhd":                             "disk-image",
+	"application/x-gguf":                            "model",
+}
+
+// CategoryForMIME returns the category for a MIME type, or "" if the type
+// is too generic to say anything about the file
+func CategoryForMIME(mimeType string) string {
+	if category, ok := mimeCategories[mimeType]; ok {
+		return category
+	}
+
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mimeType, "text/"):
+		return "document"
+	}
+	return ""
+}
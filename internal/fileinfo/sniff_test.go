@@ -0,0 +1,75 @@
+package fileinfo
+
+import (
+	"testing"
+
+	"github.com/steezeburger/storage-shower/internal/logger"
+)
+
+func TestDetectContentType(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"elf", []byte("\x7fELF\x02\x01\x01"), "application/x-elf"},
+		{"sqlite", []byte("SQLite format 3\x00\x10\x00"), "application/vnd.sqlite3"},
+		{"qcow2", []byte("QFI\xfb\x00\x00\x00\x03"), "application/x-qemu-disk"},
+		{"tar", tar, "application/x-tar"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"text", []byte("just some notes\n"), "text/plain"},
+		{"empty", []byte{}, "text/plain"},
+	}
+
+	for _, test := range tests {
+		if got := DetectContentType(test.data); got != test.expected {
+			t.Errorf("DetectContentType(%s) = %q, want %q", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestCategoryForMIME(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		expected string
+	}{
+		{"application/x-elf", "binary"},
+		{"application/vnd.sqlite3", "database"},
+		{"application/x-gguf", "model"},
+		{"image/png", "image"},
+		{"audio/mpeg", "audio"},
+		{"text/plain", "document"},
+		{"application/octet-stream", ""},
+	}
+
+	for _, test := range tests {
+		if got := CategoryForMIME(test.mimeType); got != test.expected {
+			t.Errorf("CategoryForMIME(%q) = %q, want %q", test.mimeType, got, test.expected)
+		}
+	}
+}
+
+func TestFixDirectorySizes_MIMEType(t *testing.T) {
+	root := FileInfo{
+		Name:  "root",
+		Path:  "/test/root",
+		IsDir: true,
+		Children: []FileInfo{
+			{Name: "blob", Path: "/test/root/blob", Size: 10, MIMEType: "application/x-elf"},
+			{Name: "unknown", Path: "/test/root/unknown", Size: 20, MIMEType: "application/octet-stream"},
+			{Name: "notes.md", Path: "/test/root/notes.md", Size: 30, Extension: "md", MIMEType: "application/x-elf"},
+		},
+	}
+
+	FixDirectorySizes(&root, map[string]*FileInfo{}, logger.NewNoOpLogger())
+
+	expected := []string{"binary", "other", "document"}
+	for i, category := range expected {
+		if root.Children[i].Type != category {
+			t.Errorf("%s type = %q, want %q", root.Children[i].Name, root.Children[i].Type, category)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package git
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+var fixtureTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// repo runs git commands in a repository created for a test
+type repo struct {
+	t    *testing.T
+	dir  string
+	tick int
+}
+
+func newRepo(t *testing.T) *repo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	r := &repo{t: t, dir: t.TempDir()}
+	r.git("init", "-q", "-b", "main")
+	return r
+}
+
+// git runs a git command and returns its output
+func (r *repo) git(args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	date := fixtureTime.Add(time.Duration(r.tick) * time.Hour).Format(time.RFC3339)
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_AUTHOR_DATE="+date,
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com", "GIT_COMMITTER_DATE="+date,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		r.t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return string(out)
+}
+
+// write writes a file of the work tree
+func (r *repo) write(name string, data []byte) {
+	r.t.Helper()
+	path := filepath.Join(r.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// commit commits all changes an hour after the previous commit
+func (r *repo) commit(message string) {
+	r.t.Helper()
+	r.tick++
+	r.git("add", "-A")
+	r.git("commit", "-q", "-m", message)
+}
+
+// source returns a text file of the given number of lines
+func source(lines int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < lines; i++ {
+		buf.WriteString("line " + strconv.Itoa(i) + " of a source file that changes a little\n")
+	}
+	return buf.Bytes()
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fixtureRepo commits a large file and deletes it, changes a source file in
+// several commits, tags a release and leaves an unreachable blob. Older
+// objects are packed with deltas, later ones are loose.
+func fixtureRepo(t *testing.T) *repo {
+	r := newRepo(t)
+	r.write("assets/video.bin", randomBytes(t, 200000))
+	r.write("src/main.go", source(1000))
+	r.commit("Add video and source")
+	for i := 1; i <= 3; i++ {
+		r.write("src/main.go", source(1000+i))
+		r.commit("Change source")
+	}
+	r.git("rm", "-q", "assets/video.bin")
+	r.commit("Remove video")
+	r.git("tag", "-a", "-m", "Release", "v1")
+	r.git("gc", "-q")
+
+	r.write("src/main.go", source(1010))
+	r.write("README", []byte("readme\n"))
+	r.commit("Change source again")
+	r.write("scratch.bin", randomBytes(t, 5000))
+	r.git("hash-object", "-w", "scratch.bin")
+	os.Remove(filepath.Join(r.dir, "scratch.bin"))
+	return r
+}
+
+// catObjects returns the type, size and disk size of every object as git
+// reports them
+func catObjects(r *repo) map[string][3]string {
+	out := r.git("cat-file", "--batch-all-objects", "--batch-check=%(objectname) %(objecttype) %(objectsize) %(objectsize:disk)")
+	objects := make(map[string][3]string)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		objects[fields[0]] = [3]string{fields[1], fields[2], fields[3]}
+	}
+	return objects
+}
+
+func TestDatabase(t *testing.T) {
+	r := fixtureRepo(t)
+	want := catObjects(r)
+
+	db, err := openDatabase(filepath.Join(r.dir, ".git", "objects"))
+	if err != nil {
+		t.Fatalf("openDatabase() error = %v", err)
+	}
+	defer db.Close()
+	if len(db.packs) != 1 {
+		t.Errorf("Found %d packs, want 1", len(db.packs))
+	}
+	if len(db.objects) != len(want) {
+		t.Errorf("Found %d objects, git has %d", len(db.objects), len(want))
+	}
+
+	names := map[int]string{typeCommit: "commit", typeTree: "tree", typeBlob: "blob", typeTag: "tag"}
+	for h, obj := range db.objects {
+		if err := db.resolve(obj); err != nil {
+			t.Fatalf("resolve(%s) error = %v", h, err)
+		}
+		got := [3]string{names[obj.typ], strconv.FormatInt(obj.size, 10), strconv.FormatInt(obj.diskSize, 10)}
+		if got != want[h.String()] {
+			t.Errorf("Object %s = %v, want %v", h, got, want[h.String()])
+		}
+
+		// Content read through deltas matches the size git reports
+		typ, data, err := db.read(h)
+		if err != nil {
+			t.Fatalf("read(%s) error = %v", h, err)
+		}
+		if typ != obj.typ || int64(len(data)) != obj.size {
+			t.Errorf("read(%s) = %s of %d bytes, want %s of %d", h, names[typ], len(data), names[obj.typ], obj.size)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	r := fixtureRepo(t)
+	objects := catObjects(r)
+	var diskTotal int64
+	for _, obj := range objects {
+		size, _ := strconv.ParseInt(obj[2], 10, 64)
+		diskTotal += size
+	}
+
+	var reports int
+	root, err := Analyze(r.dir, func(done, total int) { reports++ }, nil)
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	gitDir := filepath.Join(r.dir, ".git")
+	if root.Path != gitDir || !root.IsDir {
+		t.Errorf("Root = %s, want directory %s", root.Path, gitDir)
+	}
+	if root.Size != diskTotal {
+		t.Errorf("Root size = %d, want %d bytes of objects", root.Size, diskTotal)
+	}
+	if reports == 0 {
+		t.Error("Progress never reported")
+	}
+
+	tests := []struct {
+		name    string
+		objects int64
+		// Content bytes, or 0 to skip the check
+		content int64
+		modTime time.Time
+	}{
+		{"assets/video.bin", 1, 200000, fixtureTime.Add(time.Hour)},
+		{"src/main.go", 5, 0, fixtureTime.Add(6 * time.Hour)},
+		{"README", 1, 7, fixtureTime.Add(6 * time.Hour)},
+		{CommitsName, 6, 0, time.Time{}},
+		{TagsName, 1, 0, time.Time{}},
+		{UnreachableName, 1, 5000, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := fileinfo.FindNode(&root, filepath.Join(gitDir, filepath.FromSlash(tt.name)))
+			if node == nil {
+				t.Fatalf("%s not found", tt.name)
+			}
+			if node.Objects != tt.objects {
+				t.Errorf("Objects = %d, want %d", node.Objects, tt.objects)
+			}
+			if tt.content != 0 && node.UncompressedSize != tt.content {
+				t.Errorf("UncompressedSize = %d, want %d", node.UncompressedSize, tt.content)
+			}
+			if node.Size <= 0 {
+				t.Errorf("Size = %d, want the bytes on disk", node.Size)
+			}
+			if !tt.modTime.IsZero() && node.ModTime != tt.modTime.Unix() {
+				t.Errorf("ModTime = %v, want %v", time.Unix(node.ModTime, 0).UTC(), tt.modTime)
+			}
+		})
+	}
+
+	// The random video doesn't compress, so it dominates the history
+	video := fileinfo.FindNode(&root, filepath.Join(gitDir, "assets", "video.bin"))
+	if video != nil && video.Size < root.Size/2 {
+		t.Errorf("Video takes %d of %d bytes, want most of the history", video.Size, root.Size)
+	}
+}
+
+func TestAnalyze_Worktree(t *testing.T) {
+	r := fixtureRepo(t)
+	worktree := filepath.Join(t.TempDir(), "wt")
+	r.git("worktree", "add", "-q", "-b", "feature", worktree)
+
+	root, err := Analyze(worktree, nil, nil)
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	if root.FileCount == 0 || fileinfo.FindNode(&root, filepath.Join(root.Path, "src", "main.go")) == nil {
+		t.Errorf("Worktree history missing src/main.go: %d files", root.FileCount)
+	}
+}
+
+func TestAnalyze_Errors(t *testing.T) {
+	if _, err := Analyze(t.TempDir(), nil, nil); err == nil {
+		t.Error("Analyze() of a directory that isn't a repository succeeded")
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+	w := &walker{cancel: cancel}
+	for i := 0; i < progressInterval-1; i++ {
+		w.step()
+	}
+	if err := w.step(); err != ErrCanceled {
+		t.Errorf("step() after cancel = %v, want ErrCanceled", err)
+	}
+}
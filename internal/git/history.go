@@ -0,0 +1,424 @@
+// Package git sizes the history of a git repository. It reads the pack
+// indexes and loose objects for the bytes each object takes up on disk, and
+// walks the commits reachable from the refs to attribute blobs to the paths
+// that introduced them.
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/logger"
+)
+
+// Names of the entries for objects that aren't content at a path
+const (
+	CommitsName     = "(commits)"
+	TreesName       = "(trees)"
+	TagsName        = "(tags)"
+	UnreachableName = "(unreachable blobs)"
+)
+
+// ErrCanceled is returned when the analysis is canceled
+var ErrCanceled = errors.New("scan canceled")
+
+// Number of objects processed between progress reports
+const progressInterval = 1000
+
+// introduction is the path and commit time a blob first appeared at
+type introduction struct {
+	path string
+	time int64
+}
+
+// commit is a commit reachable from the refs
+type commit struct {
+	hash hash
+	tree hash
+	time int64
+}
+
+// walker walks the history of a repository
+type walker struct {
+	db *database
+
+	blobs   map[hash]introduction
+	visited map[hash]bool
+
+	progress func(done, total int)
+	cancel   <-chan struct{}
+	done     int
+	total    int
+}
+
+// Analyze reads the repository at repoPath and returns a tree below its git
+// directory of the paths in its history. Each path is sized by the bytes its
+// blob versions take up on disk, with their content size in
+// UncompressedSize; a blob at several paths counts at the first one found
+// in the oldest commit. Commits, trees, tags and blobs no ref reaches are
+// listed as separate entries. progress, if not nil, is called with the
+// number of objects processed and the total; closing cancel stops the
+// analysis with ErrCanceled.
+func Analyze(repoPath string, progress func(done, total int), cancel <-chan struct{}) (fileinfo.FileInfo, error) {
+	if abs, err := filepath.Abs(repoPath); err == nil {
+		repoPath = abs
+	}
+	gitDir, commonDir, err := findGitDir(repoPath)
+	if err != nil {
+		return fileinfo.FileInfo{}, err
+	}
+	db, err := openDatabase(filepath.Join(commonDir, "objects"))
+	if err != nil {
+		return fileinfo.FileInfo{}, fmt.Errorf("cannot read objects: %v", err)
+	}
+	defer db.Close()
+
+	w := &walker{
+		db:       db,
+		blobs:    make(map[hash]introduction),
+		visited:  make(map[hash]bool),
+		progress: progress,
+		cancel:   cancel,
+		total:    len(db.objects),
+	}
+
+	// Find the type and size of every object first, which reads only headers
+	var commitsAndTrees int
+	for h, obj := range db.objects {
+		if err := db.resolve(obj); err != nil {
+			return fileinfo.FileInfo{}, fmt.Errorf("cannot read object %s: %v", h, err)
+		}
+		if obj.typ == typeCommit || obj.typ == typeTree {
+			commitsAndTrees++
+		}
+		if err := w.step(); err != nil {
+			return fileinfo.FileInfo{}, err
+		}
+	}
+	w.total += commitsAndTrees
+
+	tips, err := readRefs(gitDir, commonDir)
+	if err != nil {
+		return fileinfo.FileInfo{}, fmt.Errorf("cannot read refs: %v", err)
+	}
+	commits, err := w.reachableCommits(tips)
+	if err != nil {
+		return fileinfo.FileInfo{}, err
+	}
+	sort.Slice(commits, func(i, j int) bool {
+		if commits[i].time != commits[j].time {
+			return commits[i].time < commits[j].time
+		}
+		return bytes.Compare(commits[i].hash[:], commits[j].hash[:]) < 0
+	})
+	for _, c := range commits {
+		if err := w.walkTree(c.tree, "", c.time); err != nil {
+			return fileinfo.FileInfo{}, err
+		}
+	}
+	if progress != nil {
+		progress(w.total, w.total)
+	}
+
+	return w.buildTree(gitDir), nil
+}
+
+// step counts an object as processed, reporting progress and checking for
+// cancellation now and then
+func (w *walker) step() error {
+	w.done++
+	if w.done%progressInterval != 0 {
+		return nil
+	}
+	if w.progress != nil {
+		w.progress(w.done, w.total)
+	}
+	select {
+	case <-w.cancel:
+		return ErrCanceled
+	default:
+		return nil
+	}
+}
+
+// reachableCommits returns the commits reachable from tips, following tags
+// to what they point to
+func (w *walker) reachableCommits(tips []hash) ([]commit, error) {
+	seen := make(map[hash]bool)
+	var commits []commit
+	queue := append([]hash(nil), tips...)
+	for len(queue) > 0 {
+		h := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+
+		obj := w.db.objects[h]
+		if obj == nil {
+			// Shallow clones and partial clones miss some history
+			continue
+		}
+		switch obj.typ {
+		case typeTag:
+			_, data, err := w.db.read(h)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read tag %s: %v", h, err)
+			}
+			if target, ok := header(data, "object"); ok {
+				if t, ok := parseHash(target); ok {
+					queue = append(queue, t)
+				}
+			}
+		case typeCommit:
+			_, data, err := w.db.read(h)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read commit %s: %v", h, err)
+			}
+			c, parents, err := parseCommit(h, data)
+			if err != nil {
+				return nil, err
+			}
+			commits = append(commits, c)
+			queue = append(queue, parents...)
+			if err := w.step(); err != nil {
+				return nil, err
+			}
+		case typeTree:
+			// A ref to a tree, like the kernel's tagged trees
+			commits = append(commits, commit{hash: h, tree: h})
+		}
+	}
+	return commits, nil
+}
+
+// parseCommit returns the tree, commit time and parents of a commit
+func parseCommit(h hash, data []byte) (commit, []hash, error) {
+	c := commit{hash: h}
+	var parents []hash
+	for _, line := range bytes.Split(headers(data), []byte("\n")) {
+		key, value, _ := bytes.Cut(line, []byte(" "))
+		switch string(key) {
+		case "tree":
+			tree, ok := parseHash(string(value))
+			if !ok {
+				return commit{}, nil, fmt.Errorf("invalid tree in commit %s", h)
+			}
+			c.tree = tree
+		case "parent":
+			if parent, ok := parseHash(string(value)); ok {
+				parents = append(parents, parent)
+			}
+		case "committer":
+			// "Name <email> 1700000000 +0100"
+			fields := bytes.Fields(value)
+			if len(fields) >= 2 {
+				c.time, _ = strconv.ParseInt(string(fields[len(fields)-2]), 10, 64)
+			}
+		}
+	}
+	return c, parents, nil
+}
+
+// headers returns the header lines of a commit or tag, before the message
+func headers(data []byte) []byte {
+	if end := bytes.Index(data, []byte("\n\n")); end >= 0 {
+		return data[:end]
+	}
+	return data
+}
+
+// header returns the value of the first header line with the given key
+func header(data []byte, key string) (string, bool) {
+	for _, line := range bytes.Split(headers(data), []byte("\n")) {
+		if k, value, ok := bytes.Cut(line, []byte(" ")); ok && string(k) == key {
+			return string(value), true
+		}
+	}
+	return "", false
+}
+
+// walkTree records the blobs below a tree at the paths below prefix, unless
+// an older commit already introduced them. Each tree is walked once, the
+// first time it appears.
+func (w *walker) walkTree(h hash, prefix string, time int64) error {
+	if w.visited[h] {
+		return nil
+	}
+	w.visited[h] = true
+	if err := w.step(); err != nil {
+		return err
+	}
+
+	typ, data, err := w.db.read(h)
+	if err != nil {
+		return fmt.Errorf("cannot read tree %s: %v", h, err)
+	}
+	if typ != typeTree {
+		return fmt.Errorf("object %s is not a tree", h)
+	}
+
+	// Entries are "<octal mode> <name>\x00<binary hash>"
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space < 0 || nul < space || len(data) < nul+1+hashSize {
+			return fmt.Errorf("invalid tree %s", h)
+		}
+		mode, name := string(data[:space]), string(data[space+1:nul])
+		var child hash
+		copy(child[:], data[nul+1:])
+		data = data[nul+1+hashSize:]
+
+		switch mode {
+		case "40000":
+			if err := w.walkTree(child, prefix+name+"/", time); err != nil {
+				return err
+			}
+		case "160000":
+			// Submodules are commits of another repository
+		default:
+			if _, ok := w.blobs[child]; !ok {
+				w.blobs[child] = introduction{path: prefix + name, time: time}
+			}
+		}
+	}
+	return nil
+}
+
+// dirNode is a directory of the paths in the history
+type dirNode struct {
+	dirs  map[string]*dirNode
+	files map[string]*fileinfo.FileInfo
+}
+
+func newDirNode() *dirNode {
+	return &dirNode{dirs: make(map[string]*dirNode), files: make(map[string]*fileinfo.FileInfo)}
+}
+
+// buildTree sizes the paths by their blobs and lists the other objects
+func (w *walker) buildTree(gitDir string) fileinfo.FileInfo {
+	root := newDirNode()
+	extra := map[string]*fileinfo.FileInfo{
+		CommitsName:     {Name: CommitsName},
+		TreesName:       {Name: TreesName},
+		TagsName:        {Name: TagsName},
+		UnreachableName: {Name: UnreachableName},
+	}
+
+	for h, obj := range w.db.objects {
+		var entry *fileinfo.FileInfo
+		switch obj.typ {
+		case typeCommit:
+			entry = extra[CommitsName]
+		case typeTree:
+			entry = extra[TreesName]
+		case typeTag:
+			entry = extra[TagsName]
+		case typeBlob:
+			intro, ok := w.blobs[h]
+			if !ok {
+				entry = extra[UnreachableName]
+				break
+			}
+			dir := root
+			parts := splitPath(intro.path)
+			for _, part := range parts[:len(parts)-1] {
+				if dir.dirs[part] == nil {
+					dir.dirs[part] = newDirNode()
+				}
+				dir = dir.dirs[part]
+			}
+			name := parts[len(parts)-1]
+			if dir.files[name] == nil {
+				dir.files[name] = &fileinfo.FileInfo{Name: name}
+			}
+			entry = dir.files[name]
+			entry.ModTime = max(entry.ModTime, intro.time)
+		default:
+			continue
+		}
+		entry.Size += obj.diskSize
+		entry.UncompressedSize += obj.size
+		entry.Objects++
+	}
+
+	for name, entry := range extra {
+		if entry.Objects > 0 {
+			root.files[name] = entry
+		}
+	}
+
+	tree := fileinfo.FileInfo{Name: filepath.Base(gitDir), Path: gitDir, IsDir: true}
+	dirMap := map[string]*fileinfo.FileInfo{gitDir: &tree}
+	tree.Children = root.build(gitDir, dirMap)
+	fileinfo.FixDirectorySizes(&tree, dirMap, logger.NewNoOpLogger())
+	fileinfo.SumUncompressed(&tree)
+	sumObjects(&tree)
+	return tree
+}
+
+// sumObjects sets the object count of directories to that of their entries
+func sumObjects(dir *fileinfo.FileInfo) int64 {
+	if !dir.IsDir {
+		return dir.Objects
+	}
+	dir.Objects = 0
+	for i := range dir.Children {
+		dir.Objects += sumObjects(&dir.Children[i])
+	}
+	return dir.Objects
+}
+
+// build converts the entries of d into file infos sorted by name,
+// registering directories in dirMap. A file at the same path as a
+// directory in another commit gets a suffix.
+func (d *dirNode) build(dirPath string, dirMap map[string]*fileinfo.FileInfo) []fileinfo.FileInfo {
+	children := make([]fileinfo.FileInfo, 0, len(d.dirs)+len(d.files))
+	for name := range d.dirs {
+		children = append(children, fileinfo.FileInfo{Name: name, Path: filepath.Join(dirPath, name), IsDir: true})
+	}
+	for name, file := range d.files {
+		child := *file
+		if d.dirs[name] != nil {
+			child.Name = name + " (file)"
+		}
+		child.Path = filepath.Join(dirPath, child.Name)
+		if ext := path.Ext(name); ext != "" {
+			child.Extension = ext[1:]
+		}
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+
+	// Register directories once the slice no longer moves
+	for i := range children {
+		if children[i].IsDir {
+			dirMap[children[i].Path] = &children[i]
+			children[i].Children = d.dirs[children[i].Name].build(children[i].Path, dirMap)
+		}
+	}
+	return children
+}
+
+// splitPath splits a slash-separated path of the history, keeping names
+// that would leave the directory from doing so
+func splitPath(p string) []string {
+	parts := bytes.Split([]byte(p), []byte("/"))
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		name := string(part)
+		if name == "" || name == "." || name == ".." {
+			name = "_" + name
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,287 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Length of a SHA-1 object hash
+const hashSize = 20
+
+// Number of inflated objects kept as bases of deltas
+const maxCachedObjects = 4096
+
+// hash names an object
+type hash [hashSize]byte
+
+func (h hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// parseHash parses a hash written in hex
+func parseHash(s string) (hash, bool) {
+	var h hash
+	if len(s) != 2*hashSize {
+		return h, false
+	}
+	_, err := hex.Decode(h[:], []byte(s))
+	return h, err == nil
+}
+
+// object is an object of the repository and where it's stored
+type object struct {
+	// Type once resolved, 0 before
+	typ int
+	// Bytes of the pack or loose file holding the object
+	diskSize int64
+	// Size of the content once resolved
+	size int64
+
+	pack   *pack
+	offset int64
+	// File of a loose object
+	loose string
+}
+
+// cacheKey identifies an object in a pack
+type cacheKey struct {
+	pack   *pack
+	offset int64
+}
+
+// cachedObject is the inflated content of an object
+type cachedObject struct {
+	typ  int
+	data []byte
+}
+
+// database reads the objects of a repository
+type database struct {
+	objects map[hash]*object
+	packs   []*pack
+	cache   map[cacheKey]cachedObject
+}
+
+// openDatabase indexes the packed and loose objects below objectsDir
+func openDatabase(objectsDir string) (*database, error) {
+	db := &database{objects: make(map[hash]*object), cache: make(map[cacheKey]cachedObject)}
+
+	packPaths, err := filepath.Glob(filepath.Join(objectsDir, "pack", "*.pack"))
+	if err != nil {
+		return nil, err
+	}
+	for _, packPath := range packPaths {
+		p, err := loadPack(packPath, db.objects)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.packs = append(db.packs, p)
+	}
+
+	// Loose objects are stored in directories named by the first byte of
+	// their hash; ones also in a pack are counted from the pack
+	dirs, err := filepath.Glob(filepath.Join(objectsDir, "[0-9a-f][0-9a-f]"))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		for _, e := range entries {
+			h, ok := parseHash(filepath.Base(dir) + e.Name())
+			if !ok || db.objects[h] != nil {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			db.objects[h] = &object{loose: filepath.Join(dir, e.Name()), diskSize: info.Size()}
+		}
+	}
+	return db, nil
+}
+
+// Close closes the pack files
+func (db *database) Close() error {
+	for _, p := range db.packs {
+		p.file.Close()
+	}
+	return nil
+}
+
+// resolve sets the type and content size of obj, following deltas to their
+// base for the type
+func (db *database) resolve(obj *object) error {
+	if obj.typ != 0 {
+		return nil
+	}
+	if obj.loose != "" {
+		typ, size, _, err := readLoose(obj.loose, false)
+		if err != nil {
+			return err
+		}
+		obj.typ, obj.size = typ, size
+		return nil
+	}
+
+	e, err := obj.pack.entry(obj.offset)
+	if err != nil {
+		return err
+	}
+	if e.typ != typeOfsDelta && e.typ != typeRefDelta {
+		obj.typ, obj.size = e.typ, e.size
+		return nil
+	}
+	typ, err := db.baseType(obj.pack, e, 0)
+	if err != nil {
+		return err
+	}
+	obj.typ = typ
+
+	// The content size is at the start of the delta
+	head, err := obj.pack.inflate(e.dataOffset, min(e.size, 20))
+	if err != nil {
+		return err
+	}
+	_, rest := deltaSize(head)
+	obj.size, _ = deltaSize(rest)
+	return nil
+}
+
+// baseType returns the type of the object a delta applies to
+func (db *database) baseType(p *pack, e entry, depth int) (int, error) {
+	if depth > maxDeltaDepth {
+		return 0, errors.New("delta chain too long")
+	}
+	if e.typ == typeRefDelta {
+		base := db.objects[e.baseHash]
+		if base == nil {
+			return 0, fmt.Errorf("missing delta base %s", e.baseHash)
+		}
+		if err := db.resolve(base); err != nil {
+			return 0, err
+		}
+		return base.typ, nil
+	}
+
+	base, err := p.entry(e.baseOffset)
+	if err != nil {
+		return 0, err
+	}
+	if base.typ == typeOfsDelta || base.typ == typeRefDelta {
+		return db.baseType(p, base, depth+1)
+	}
+	return base.typ, nil
+}
+
+// read returns the type and content of an object
+func (db *database) read(h hash) (int, []byte, error) {
+	obj := db.objects[h]
+	if obj == nil {
+		return 0, nil, fmt.Errorf("missing object %s", h)
+	}
+	if obj.loose != "" {
+		typ, _, data, err := readLoose(obj.loose, true)
+		return typ, data, err
+	}
+	return db.readPacked(obj.pack, obj.offset, 0)
+}
+
+// readPacked returns the type and content of the object at offset in p,
+// applying deltas
+func (db *database) readPacked(p *pack, offset int64, depth int) (int, []byte, error) {
+	if depth > maxDeltaDepth {
+		return 0, nil, errors.New("delta chain too long")
+	}
+	key := cacheKey{p, offset}
+	if cached, ok := db.cache[key]; ok {
+		return cached.typ, cached.data, nil
+	}
+
+	e, err := p.entry(offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := p.inflate(e.dataOffset, e.size)
+	if err != nil {
+		return 0, nil, err
+	}
+	typ := e.typ
+	if e.typ == typeOfsDelta || e.typ == typeRefDelta {
+		var base []byte
+		if e.typ == typeOfsDelta {
+			typ, base, err = db.readPacked(p, e.baseOffset, depth+1)
+		} else {
+			typ, base, err = db.read(e.baseHash)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if data, err = applyDelta(base, data); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// Keep the object for the deltas of later versions based on it
+	if len(db.cache) >= maxCachedObjects {
+		clear(db.cache)
+	}
+	db.cache[key] = cachedObject{typ, data}
+	return typ, data, nil
+}
+
+// readLoose reads the type and size of a loose object from its header, and
+// its content if content is set
+func readLoose(path string, content bool) (int, int64, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer file.Close()
+	reader, err := zlib.NewReader(file)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer reader.Close()
+
+	// The header is "<type> <size>\x00"
+	head := make([]byte, 32)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, 0, nil, err
+	}
+	head = head[:n]
+	end := bytes.IndexByte(head, 0)
+	name, sizeText, ok := bytes.Cut(head[:max(end, 0)], []byte(" "))
+	if end < 0 || !ok {
+		return 0, 0, nil, fmt.Errorf("invalid loose object %s", path)
+	}
+	size, err := strconv.ParseInt(string(sizeText), 10, 64)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid loose object %s", path)
+	}
+	typ := map[string]int{"commit": typeCommit, "tree": typeTree, "blob": typeBlob, "tag": typeTag}[string(name)]
+	if typ == 0 || !content {
+		return typ, size, nil, nil
+	}
+
+	data := append([]byte(nil), head[end+1:]...)
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return typ, size, append(data, rest...), nil
+}
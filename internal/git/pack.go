@@ -0,0 +1,279 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Object types as numbered in packs
+const (
+	typeCommit   = 1
+	typeTree     = 2
+	typeBlob     = 3
+	typeTag      = 4
+	typeOfsDelta = 6
+	typeRefDelta = 7
+)
+
+// Longest chain of deltas followed to a base object
+const maxDeltaDepth = 1000
+
+// Magic number of version 2 pack indexes
+var idxMagic = []byte{0xff, 't', 'O', 'c'}
+
+// pack is a pack file of the object database
+type pack struct {
+	file *os.File
+	size int64
+}
+
+// entry is the header of an object in a pack
+type entry struct {
+	typ int
+	// Size of the inflated object, or of the delta for deltified objects
+	size int64
+	// Where the compressed data starts
+	dataOffset int64
+	// Base object of a delta, by offset in the same pack or by hash
+	baseOffset int64
+	baseHash   hash
+}
+
+// loadPack reads the index of the pack at packPath and adds its objects to
+// objects, sized by the bytes each takes up in the pack
+func loadPack(packPath string, objects map[hash]*object) (*pack, error) {
+	idxPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+	idx, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	hashes, offsets, err := parseIndex(idx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pack index %s: %v", idxPath, err)
+	}
+
+	file, err := os.Open(packPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	p := &pack{file: file, size: info.Size()}
+
+	// An object takes up the pack up to the next one; the last one ends at
+	// the checksum trailer
+	order := make([]int, len(offsets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return offsets[order[a]] < offsets[order[b]] })
+	for n, i := range order {
+		end := p.size - hashSize
+		if n+1 < len(order) {
+			end = offsets[order[n+1]]
+		}
+		objects[hashes[i]] = &object{pack: p, offset: offsets[i], diskSize: end - offsets[i]}
+	}
+	return p, nil
+}
+
+// parseIndex returns the hashes and offsets of the objects in a pack index
+// of version 1 or 2
+func parseIndex(idx []byte) ([]hash, []int64, error) {
+	if len(idx) < 8+256*4 {
+		return nil, nil, errors.New("truncated")
+	}
+	version := 1
+	fanout := idx
+	if bytes.HasPrefix(idx, idxMagic) {
+		version = int(binary.BigEndian.Uint32(idx[4:8]))
+		if version != 2 {
+			return nil, nil, fmt.Errorf("unsupported version %d", version)
+		}
+		fanout = idx[8:]
+	}
+	count := int(binary.BigEndian.Uint32(fanout[255*4:]))
+	rest := fanout[256*4:]
+
+	hashes := make([]hash, count)
+	offsets := make([]int64, count)
+	if version == 1 {
+		if len(rest) < count*(4+hashSize) {
+			return nil, nil, errors.New("truncated")
+		}
+		for i := 0; i < count; i++ {
+			record := rest[i*(4+hashSize):]
+			offsets[i] = int64(binary.BigEndian.Uint32(record))
+			copy(hashes[i][:], record[4:])
+		}
+		return hashes, offsets, nil
+	}
+
+	// Hashes, CRCs, 31-bit offsets, then 64-bit offsets for large packs
+	if len(rest) < count*(hashSize+4+4) {
+		return nil, nil, errors.New("truncated")
+	}
+	for i := 0; i < count; i++ {
+		copy(hashes[i][:], rest[i*hashSize:])
+	}
+	small := rest[count*(hashSize+4):]
+	large := small[count*4:]
+	for i := 0; i < count; i++ {
+		offset := binary.BigEndian.Uint32(small[i*4:])
+		if offset&0x80000000 == 0 {
+			offsets[i] = int64(offset)
+			continue
+		}
+		n := int(offset &^ 0x80000000)
+		if len(large) < (n+1)*8 {
+			return nil, nil, errors.New("truncated")
+		}
+		offsets[i] = int64(binary.BigEndian.Uint64(large[n*8:]))
+	}
+	return hashes, offsets, nil
+}
+
+// entry reads the header of the object at offset
+func (p *pack) entry(offset int64) (entry, error) {
+	buf := make([]byte, 32+hashSize)
+	n, err := p.file.ReadAt(buf, offset)
+	if n == 0 {
+		return entry{}, err
+	}
+	buf = buf[:n]
+
+	// Type and size, continued in 7-bit groups while the high bit is set
+	e := entry{typ: int(buf[0]>>4) & 7, size: int64(buf[0] & 0x0f)}
+	i, shift := 1, 4
+	for c := buf[0]; c&0x80 != 0; shift += 7 {
+		if i >= len(buf) {
+			return entry{}, errors.New("truncated object header")
+		}
+		c = buf[i]
+		i++
+		e.size |= int64(c&0x7f) << shift
+	}
+
+	switch e.typ {
+	case typeOfsDelta:
+		// Distance back to the base, in big-endian 7-bit groups where each
+		// continuation adds one
+		var distance int64
+		for first := true; ; first = false {
+			if i >= len(buf) {
+				return entry{}, errors.New("truncated delta offset")
+			}
+			c := buf[i]
+			i++
+			if !first {
+				distance++
+			}
+			distance = distance<<7 | int64(c&0x7f)
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		e.baseOffset = offset - distance
+		if e.baseOffset < 0 || distance == 0 {
+			return entry{}, errors.New("invalid delta offset")
+		}
+	case typeRefDelta:
+		if len(buf) < i+hashSize {
+			return entry{}, errors.New("truncated delta base")
+		}
+		copy(e.baseHash[:], buf[i:])
+		i += hashSize
+	}
+	e.dataOffset = offset + int64(i)
+	return e, nil
+}
+
+// inflate returns the first n bytes of the compressed data at offset
+func (p *pack) inflate(offset, n int64) ([]byte, error) {
+	reader, err := zlib.NewReader(io.NewSectionReader(p.file, offset, p.size-offset))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data := make([]byte, n)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// applyDelta builds an object from its base and a delta, which copies
+// ranges of the base and inserts new data
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta := deltaSize(delta)
+	if baseSize != int64(len(base)) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	size, delta := deltaSize(delta)
+	result := make([]byte, 0, size)
+
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		if op&0x80 == 0 {
+			if op == 0 || int(op) > len(delta) {
+				return nil, errors.New("invalid delta instruction")
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+			continue
+		}
+
+		// Offset and size bytes are present where their bits are set
+		var offset, n int64
+		for bit := 0; bit < 7; bit++ {
+			if op&(1<<bit) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, errors.New("truncated delta")
+			}
+			if bit < 4 {
+				offset |= int64(delta[0]) << (8 * bit)
+			} else {
+				n |= int64(delta[0]) << (8 * (bit - 4))
+			}
+			delta = delta[1:]
+		}
+		if n == 0 {
+			n = 0x10000
+		}
+		if offset+n > int64(len(base)) {
+			return nil, errors.New("delta copies past its base")
+		}
+		result = append(result, base[offset:offset+n]...)
+	}
+	if int64(len(result)) != size {
+		return nil, errors.New("delta result size mismatch")
+	}
+	return result, nil
+}
+
+// deltaSize reads a size from the header of a delta and returns the rest
+func deltaSize(delta []byte) (int64, []byte) {
+	var size int64
+	for shift := 0; len(delta) > 0; shift += 7 {
+		c := delta[0]
+		delta = delta[1:]
+		size |= int64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	return size, delta
+}
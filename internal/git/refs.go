@@ -0,0 +1,110 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// findGitDir returns the git directory of the repository at repoPath and
+// the common directory holding its objects and refs, which differs for
+// linked worktrees
+func findGitDir(repoPath string) (gitDir, commonDir string, err error) {
+	gitDir = filepath.Join(repoPath, ".git")
+	info, err := os.Stat(gitDir)
+	switch {
+	case err == nil && !info.IsDir():
+		// Worktrees and submodules point to their git directory
+		data, err := os.ReadFile(gitDir)
+		if err != nil {
+			return "", "", err
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+		if !ok {
+			return "", "", fmt.Errorf("invalid %s", gitDir)
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(repoPath, target)
+		}
+		gitDir = target
+	case err != nil:
+		// A bare repository is its own git directory
+		gitDir = repoPath
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); err != nil {
+		return "", "", fmt.Errorf("%s is not a git repository", repoPath)
+	}
+
+	commonDir = gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	// Objects of SHA-256 repositories have longer hashes
+	if data, err := os.ReadFile(filepath.Join(commonDir, "config")); err == nil {
+		if strings.Contains(strings.ToLower(string(data)), "objectformat = sha256") {
+			return "", "", errors.New("SHA-256 repositories aren't supported")
+		}
+	}
+	return gitDir, commonDir, nil
+}
+
+// readRefs returns the objects that HEAD, branches, tags and other refs
+// point to
+func readRefs(gitDir, commonDir string) ([]hash, error) {
+	var tips []hash
+	add := func(value string) {
+		if h, ok := parseHash(strings.TrimSpace(value)); ok {
+			tips = append(tips, h)
+		}
+	}
+
+	// A detached HEAD isn't on any branch
+	if data, err := os.ReadFile(filepath.Join(gitDir, "HEAD")); err == nil {
+		add(string(data))
+	}
+
+	file, err := os.Open(filepath.Join(commonDir, "packed-refs"))
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+				continue
+			}
+			value, _, _ := strings.Cut(line, " ")
+			add(value)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(filepath.Join(commonDir, "refs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			add(string(data))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return tips, nil
+}
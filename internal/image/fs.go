@@ -0,0 +1,169 @@
+package image
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Number of symbolic links followed when resolving a path, like Linux
+const maxLinks = 40
+
+// errNoContent is returned when reading a file, whose content isn't kept
+var errNoContent = errors.New("content of image files isn't kept")
+
+// lookup returns the node at the slash-separated path name, following
+// symbolic links on the way and, if follow is set, a link at the end.
+// Absolute link targets resolve from the root of the image.
+func (img *Image) lookup(op, name string, follow bool) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	parts := strings.Split(name, "/")
+	stack := []*node{img.root}
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		child := stack[len(stack)-1].children[part]
+		if child == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if child.mode&fs.ModeSymlink != 0 && (len(parts) > 0 || follow) {
+			if links++; links > maxLinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			if path.IsAbs(child.target) {
+				stack = stack[:1]
+			}
+			parts = append(strings.Split(child.target, "/"), parts...)
+			continue
+		}
+		stack = append(stack, child)
+	}
+	return stack[len(stack)-1], nil
+}
+
+// Open opens the file or directory name, following symbolic links
+func (img *Image) Open(name string) (fs.File, error) {
+	n, err := img.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	file := &file{name: name, info: fileInfo{path.Base(name), n}}
+	if n.children != nil {
+		file.entries = entries(n)
+	}
+	return file, nil
+}
+
+// Stat returns the file info of name, following symbolic links
+func (img *Image) Stat(name string) (fs.FileInfo, error) {
+	n, err := img.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{path.Base(name), n}, nil
+}
+
+// ReadDir returns the entries of the directory name sorted by name
+func (img *Image) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := img.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.children == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return entries(n), nil
+}
+
+// ReadLink returns the target of the symbolic link name
+func (img *Image) ReadLink(name string) (string, error) {
+	n, err := img.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return n.target, nil
+}
+
+// entries returns the entries of a directory sorted by name
+func entries(dir *node) []fs.DirEntry {
+	list := make([]fs.DirEntry, 0, len(dir.children))
+	for name, child := range dir.children {
+		list = append(list, fs.FileInfoToDirEntry(fileInfo{name, child}))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// fileInfo describes a node; Layer reports the layer that wrote it
+type fileInfo struct {
+	name string
+	n    *node
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.n.size }
+func (i fileInfo) Mode() fs.FileMode  { return i.n.mode }
+func (i fileInfo) ModTime() time.Time { return i.n.modTime }
+func (i fileInfo) IsDir() bool        { return i.n.children != nil }
+func (i fileInfo) Sys() any           { return nil }
+func (i fileInfo) Layer() int         { return i.n.layer }
+
+// file is an open file or directory of the image
+type file struct {
+	name    string
+	info    fileInfo
+	entries []fs.DirEntry
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: errNoContent}
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries of a directory, or all remaining ones
+// if n <= 0
+func (f *file) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.info.n.children == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	if n <= 0 {
+		list := f.entries
+		f.entries = nil
+		return list, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.entries))
+	list := f.entries[:n]
+	f.entries = f.entries[n:]
+	return list, nil
+}
@@ -0,0 +1,301 @@
+// Package image reads container images from local files, an OCI image layout
+// directory or a docker save tarball, and applies their layers in order to
+// build the merged file system, keeping which layer wrote each file.
+package image
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// Image formats
+const (
+	OCI    = "oci"
+	Docker = "docker"
+)
+
+// Media types of manifests and image indexes
+const (
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// Annotation holding the reference name of an image in an OCI layout
+const refNameAnnotation = "org.opencontainers.image.ref.name"
+
+// Image is the merged file system of a container image. It implements
+// fs.FS, fs.ReadDirFS and fs.StatFS; file content isn't kept, so only
+// directories can be read.
+type Image struct {
+	info fileinfo.ImageInfo
+	root *node
+}
+
+// layerRef locates a layer blob in the image source
+type layerRef struct {
+	name   string
+	digest string
+}
+
+// manifest lists the layers of an image and where its config is
+type manifest struct {
+	format string
+	tags   []string
+	config string
+	layers []layerRef
+}
+
+// descriptor points to a blob of an OCI image
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+// Open reads the image at imagePath, an OCI image layout directory or an
+// uncompressed docker save tarball, and applies its layers
+func Open(imagePath string) (*Image, error) {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	var src source
+	if info.IsDir() {
+		src = dirSource(imagePath)
+	} else {
+		tarball, err := openTarSource(imagePath)
+		if err != nil {
+			return nil, err
+		}
+		src = tarball
+	}
+	defer src.Close()
+
+	m, err := readDockerManifest(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		m, err = readOCIManifest(src)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, errors.New("not an OCI image layout or docker save tarball")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img := &Image{
+		info: fileinfo.ImageInfo{Format: m.format, Tags: m.tags},
+		root: &node{mode: fs.ModeDir | 0755, children: make(map[string]*node)},
+	}
+	history, diffIDs := readConfig(src, m.config)
+	for i, ref := range m.layers {
+		layer := fileinfo.ImageLayer{Digest: ref.digest}
+		// Docker names layers by the digest of their uncompressed content
+		if m.format == Docker && i < len(diffIDs) {
+			layer.Digest = diffIDs[i]
+		}
+		if i < len(history) {
+			layer.CreatedBy = history[i]
+		}
+		if err := img.applyLayer(src, ref.name, i+1, &layer); err != nil {
+			return nil, fmt.Errorf("failed to read layer %d (%s): %v", i+1, layer.Digest, err)
+		}
+		img.info.Layers = append(img.info.Layers, layer)
+	}
+	img.countVisible(img.root)
+	return img, nil
+}
+
+// Info returns the format, tags and layers of the image
+func (img *Image) Info() fileinfo.ImageInfo {
+	return img.info
+}
+
+// readJSON decodes the JSON file name of the image source into v
+func readJSON(src source, name string, v any) error {
+	r, _, err := src.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return nil
+}
+
+// readDockerManifest reads the manifest.json of a docker save tarball
+func readDockerManifest(src source) (manifest, error) {
+	var entries []struct {
+		Config   string   `json:"Config"`
+		RepoTags []string `json:"RepoTags"`
+		Layers   []string `json:"Layers"`
+	}
+	if err := readJSON(src, "manifest.json", &entries); err != nil {
+		return manifest{}, err
+	}
+	if len(entries) == 0 {
+		return manifest{}, errors.New("manifest.json lists no images")
+	}
+
+	entry := entries[0]
+	m := manifest{format: Docker, tags: entry.RepoTags, config: entry.Config}
+	for _, name := range entry.Layers {
+		m.layers = append(m.layers, layerRef{name: name, digest: blobDigest(name)})
+	}
+	return m, nil
+}
+
+// readOCIManifest reads the index.json of an OCI image layout and the
+// manifest of the image for this platform, or the first one
+func readOCIManifest(src source) (manifest, error) {
+	var index struct {
+		Manifests []descriptor `json:"manifests"`
+	}
+	if err := readJSON(src, "index.json", &index); err != nil {
+		return manifest{}, err
+	}
+
+	var tags []string
+	for _, desc := range index.Manifests {
+		if name := desc.Annotations[refNameAnnotation]; name != "" {
+			tags = append(tags, name)
+		}
+	}
+
+	// Descend through nested indexes, e.g. of multi-platform images
+	manifests := index.Manifests
+	for depth := 0; depth < 8; depth++ {
+		desc, ok := pickManifest(manifests)
+		if !ok {
+			return manifest{}, errors.New("index.json lists no image manifests")
+		}
+		name, err := blobName(desc.Digest)
+		if err != nil {
+			return manifest{}, err
+		}
+
+		var blob struct {
+			MediaType string       `json:"mediaType"`
+			Manifests []descriptor `json:"manifests"`
+			Config    descriptor   `json:"config"`
+			Layers    []descriptor `json:"layers"`
+		}
+		if err := readJSON(src, name, &blob); err != nil {
+			return manifest{}, err
+		}
+		mediaType := desc.MediaType
+		if mediaType == "" {
+			mediaType = blob.MediaType
+		}
+		if mediaType == mediaTypeOCIIndex || mediaType == mediaTypeDockerList || blob.Manifests != nil {
+			manifests = blob.Manifests
+			continue
+		}
+
+		m := manifest{format: OCI, tags: tags}
+		if m.config, err = blobName(blob.Config.Digest); err != nil {
+			return manifest{}, err
+		}
+		for _, layer := range blob.Layers {
+			name, err := blobName(layer.Digest)
+			if err != nil {
+				return manifest{}, err
+			}
+			m.layers = append(m.layers, layerRef{name: name, digest: layer.Digest})
+		}
+		return m, nil
+	}
+	return manifest{}, errors.New("image indexes nested too deeply")
+}
+
+// pickManifest returns the manifest for this platform, or the first one
+// that isn't an attestation or other artifact without a platform
+func pickManifest(manifests []descriptor) (descriptor, bool) {
+	var first *descriptor
+	for i, desc := range manifests {
+		switch desc.MediaType {
+		case "", mediaTypeOCIIndex, mediaTypeDockerList, mediaTypeOCIManifest, mediaTypeDockerManifest:
+		default:
+			continue
+		}
+		if desc.Platform == nil {
+			if first == nil {
+				first = &manifests[i]
+			}
+			continue
+		}
+		if desc.Platform.OS == "linux" && desc.Platform.Architecture == runtime.GOARCH {
+			return desc, true
+		}
+		if desc.Platform.OS != "unknown" && first == nil {
+			first = &manifests[i]
+		}
+	}
+	if first == nil {
+		return descriptor{}, false
+	}
+	return *first, true
+}
+
+// readConfig returns the build steps of the layers and their uncompressed
+// digests from the image config. The image is still read without them.
+func readConfig(src source, name string) (history, diffIDs []string) {
+	if name == "" {
+		return nil, nil
+	}
+	var config struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+		History []struct {
+			CreatedBy  string `json:"created_by"`
+			EmptyLayer bool   `json:"empty_layer"`
+		} `json:"history"`
+	}
+	if err := readJSON(src, name, &config); err != nil {
+		return nil, nil
+	}
+
+	// Steps that only change metadata don't create a layer
+	for _, step := range config.History {
+		if !step.EmptyLayer {
+			history = append(history, strings.TrimSpace(step.CreatedBy))
+		}
+	}
+	return history, config.RootFS.DiffIDs
+}
+
+// blobName returns the path of the blob with the given digest in an image
+// layout
+func blobName(digest string) (string, error) {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok || algorithm == "" || hex == "" || strings.ContainsAny(digest, "/\\") {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return "blobs/" + algorithm + "/" + hex, nil
+}
+
+// blobDigest returns the digest of a blob from its path in an image layout,
+// or the path itself for the layer directories of older docker save tarballs
+func blobDigest(name string) string {
+	dir, hex := path.Split(name)
+	if algorithm, ok := strings.CutPrefix(dir, "blobs/"); ok && algorithm != "" {
+		return strings.TrimSuffix(algorithm, "/") + ":" + hex
+	}
+	return name
+}
@@ -0,0 +1,377 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var fixtureTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// tarEntry is a member of a layer written by the tests
+type tarEntry struct {
+	name string
+	// Size of a regular file, or target of a symbolic or hard link
+	size   int
+	link   string
+	isDir  bool
+	isHard bool
+}
+
+// fixtureLayers replace, delete and hide files of the layers below
+var fixtureLayers = [][]tarEntry{
+	{
+		{name: "etc/", isDir: true},
+		{name: "etc/config", size: 100},
+		{name: "usr/bin/tool", size: 1000},
+		{name: "var/cache/apt/pkgs.bin", size: 5000},
+		{name: "bin", link: "usr/bin"},
+		{name: "lib", link: "/usr/lib"},
+		{name: "loop", link: "loop"},
+	},
+	{
+		{name: "usr/lib/libbig.so", size: 20000},
+		{name: "usr/lib/libbig.so.1", link: "usr/lib/libbig.so", isHard: true},
+		{name: "var/cache/apt/pkgs.bin", size: 6000},
+		{name: "etc/.wh.config"},
+	},
+	{
+		{name: "var/cache/new.txt", size: 10},
+		{name: "var/cache/.wh..wh..opq"},
+		{name: "usr/bin/tool", size: 1500},
+	},
+}
+
+// Build steps of the fixture layers, with a step that creates no layer
+var fixtureHistory = []string{"ADD rootfs.tar /", "ENV PATH=/usr/bin", "RUN install libbig", "RUN cleanup"}
+
+// layerTar returns a layer holding entries
+func layerTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(entry.size), ModTime: fixtureTime}
+		switch {
+		case entry.isDir:
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		case entry.isHard:
+			header.Typeflag, header.Linkname = tar.TypeLink, entry.link
+		case entry.link != "":
+			header.Typeflag, header.Linkname, header.Mode = tar.TypeSymlink, entry.link, 0777
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(make([]byte, header.Size))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// configJSON returns an image config with the diff IDs of layers
+func configJSON(t *testing.T, layers [][]byte) []byte {
+	t.Helper()
+	config := map[string]any{"architecture": runtime.GOARCH, "os": "linux"}
+	var diffIDs []string
+	for _, layer := range layers {
+		diffIDs = append(diffIDs, digest(layer))
+	}
+	config["rootfs"] = map[string]any{"type": "layers", "diff_ids": diffIDs}
+	var history []map[string]any
+	for _, step := range fixtureHistory {
+		history = append(history, map[string]any{"created_by": step, "empty_layer": step == "ENV PATH=/usr/bin"})
+	}
+	config["history"] = history
+	return mustJSON(t, config)
+}
+
+func digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeOCILayout writes the fixture layers gzip compressed into an OCI image
+// layout, behind a multi-platform index with an attestation manifest
+func writeOCILayout(t *testing.T) (string, [][]byte) {
+	t.Helper()
+	dir := t.TempDir()
+	writeBlob := func(data []byte) string {
+		d := digest(data)
+		path := filepath.Join(dir, "blobs", "sha256", d[len("sha256:"):])
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	var layers, blobs [][]byte
+	var layerDescs []map[string]any
+	for _, entries := range fixtureLayers {
+		layer := layerTar(t, entries)
+		blob := gzipData(t, layer)
+		layers = append(layers, layer)
+		blobs = append(blobs, blob)
+		layerDescs = append(layerDescs, map[string]any{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": writeBlob(blob), "size": len(blob),
+		})
+	}
+	config := configJSON(t, layers)
+	manifest := mustJSON(t, map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeOCIManifest,
+		"config":        map[string]any{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": writeBlob(config), "size": len(config)},
+		"layers":        layerDescs,
+	})
+	attestation := mustJSON(t, map[string]any{"schemaVersion": 2, "mediaType": mediaTypeOCIManifest, "layers": []any{}})
+	index := mustJSON(t, map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeOCIIndex,
+		"manifests": []map[string]any{
+			{"mediaType": mediaTypeOCIManifest, "digest": writeBlob(attestation), "size": len(attestation),
+				"platform": map[string]string{"os": "unknown", "architecture": "unknown"}},
+			{"mediaType": mediaTypeOCIManifest, "digest": writeBlob(manifest), "size": len(manifest),
+				"platform": map[string]string{"os": "linux", "architecture": runtime.GOARCH}},
+		},
+	})
+	top := mustJSON(t, map[string]any{
+		"schemaVersion": 2,
+		"manifests": []map[string]any{{
+			"mediaType": mediaTypeOCIIndex, "digest": writeBlob(index), "size": len(index),
+			"annotations": map[string]string{refNameAnnotation: "app:1.0"},
+		}},
+	})
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), top, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, blobs
+}
+
+// writeDockerSave writes the fixture layers into a docker save tarball in
+// the legacy format, with the first layer linked from where images share it
+func writeDockerSave(t *testing.T, layers [][]byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.tar")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tw := tar.NewWriter(file)
+	add := func(name string, data []byte) {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data)), ModTime: fixtureTime})
+		tw.Write(data)
+	}
+	var names []string
+	for i, layer := range layers {
+		name := fmt.Sprintf("layer%d/layer.tar", i)
+		names = append(names, name)
+		if i == 0 {
+			add("shared/layer.tar", layer)
+			tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: "../shared/layer.tar", ModTime: fixtureTime})
+			continue
+		}
+		add(name, layer)
+	}
+	add("config.json", configJSON(t, layers))
+	add("manifest.json", mustJSON(t, []map[string]any{
+		{"Config": "config.json", "RepoTags": []string{"app:1.0"}, "Layers": names},
+	}))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpen(t *testing.T) {
+	ociDir, blobs := writeOCILayout(t)
+	var layers [][]byte
+	for _, entries := range fixtureLayers {
+		layers = append(layers, layerTar(t, entries))
+	}
+	dockerPath := writeDockerSave(t, layers)
+
+	tests := []struct {
+		name    string
+		path    string
+		format  string
+		digests []string
+		sizes   []int64
+	}{
+		{"oci layout", ociDir, OCI,
+			[]string{digest(blobs[0]), digest(blobs[1]), digest(blobs[2])},
+			[]int64{int64(len(blobs[0])), int64(len(blobs[1])), int64(len(blobs[2]))}},
+		{"docker save", dockerPath, Docker,
+			[]string{digest(layers[0]), digest(layers[1]), digest(layers[2])},
+			[]int64{int64(len(layers[0])), int64(len(layers[1])), int64(len(layers[2]))}},
+	}
+
+	expected := []struct {
+		createdBy                    string
+		uncompressed, visible, files int64
+	}{
+		{"ADD rootfs.tar /", 6100, 0, 3},
+		{"RUN install libbig", 26000, 20000, 3},
+		{"RUN cleanup", 1510, 1510, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := Open(test.path)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			info := img.Info()
+			if info.Format != test.format || len(info.Tags) != 1 || info.Tags[0] != "app:1.0" {
+				t.Errorf("Image is %s tagged %v, want %s tagged app:1.0", info.Format, info.Tags, test.format)
+			}
+			if len(info.Layers) != len(expected) {
+				t.Fatalf("Image has %d layers, want %d", len(info.Layers), len(expected))
+			}
+			for i, layer := range info.Layers {
+				want := expected[i]
+				if layer.Digest != test.digests[i] || layer.Size != test.sizes[i] || layer.CreatedBy != want.createdBy {
+					t.Errorf("Layer %d = %s of %d bytes by %q, want %s of %d bytes by %q", i+1,
+						layer.Digest, layer.Size, layer.CreatedBy, test.digests[i], test.sizes[i], want.createdBy)
+				}
+				if layer.UncompressedSize != want.uncompressed || layer.VisibleSize != want.visible || layer.Files != want.files {
+					t.Errorf("Layer %d adds %d bytes in %d files, %d visible, want %d in %d, %d visible", i+1,
+						layer.UncompressedSize, layer.Files, layer.VisibleSize, want.uncompressed, want.files, want.visible)
+				}
+			}
+		})
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	dir := t.TempDir()
+	compressed := filepath.Join(dir, "app.tar.gz")
+	if err := os.WriteFile(compressed, gzipData(t, []byte("image")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plain := filepath.Join(dir, "plain.tar")
+	if err := os.WriteFile(plain, layerTar(t, fixtureLayers[0]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{compressed, plain, t.TempDir(), filepath.Join(dir, "missing")} {
+		if _, err := Open(path); err == nil {
+			t.Errorf("Open(%s) succeeded", path)
+		}
+	}
+}
+
+func TestImageFS(t *testing.T) {
+	dir, _ := writeOCILayout(t)
+	img, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	files := []struct {
+		name  string
+		size  int64
+		layer int
+	}{
+		{"usr/bin/tool", 1500, 3},
+		{"bin/tool", 1500, 3},
+		{"lib/libbig.so", 20000, 2},
+		{"usr/lib/libbig.so.1", 0, 2},
+		{"var/cache/new.txt", 10, 3},
+	}
+	for _, file := range files {
+		info, err := fs.Stat(img, file.name)
+		if err != nil {
+			t.Errorf("Stat(%s) error = %v", file.name, err)
+			continue
+		}
+		if info.Size() != file.size || info.(interface{ Layer() int }).Layer() != file.layer {
+			t.Errorf("%s has %d bytes from layer %d, want %d from layer %d",
+				file.name, info.Size(), info.(interface{ Layer() int }).Layer(), file.size, file.layer)
+		}
+	}
+
+	for _, name := range []string{"etc/config", "var/cache/apt", "loop", "../etc"} {
+		if _, err := fs.Stat(img, name); err == nil {
+			t.Errorf("Stat(%s) succeeded", name)
+		}
+	}
+
+	entries, err := fs.ReadDir(img, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if fmt.Sprint(names) != "[bin etc lib loop usr var]" {
+		t.Errorf("Root entries = %v, want [bin etc lib loop usr var]", names)
+	}
+	if entries[0].Type() != fs.ModeSymlink {
+		t.Errorf("bin has type %v, want a symbolic link", entries[0].Type())
+	}
+	if target, err := img.ReadLink("lib"); err != nil || target != "/usr/lib" {
+		t.Errorf("ReadLink(lib) = %q, %v, want /usr/lib", target, err)
+	}
+
+	file, err := img.Open("usr/bin/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Read(make([]byte, 10)); !errors.Is(err, errNoContent) {
+		t.Errorf("Read() error = %v, want %v", err, errNoContent)
+	}
+	dirFile, err := img.Open("usr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, err := dirFile.(fs.ReadDirFile).ReadDir(1); err != nil || len(list) != 1 || list[0].Name() != "bin" {
+		t.Errorf("ReadDir(1) = %v, %v, want [bin]", list, err)
+	}
+	if list, err := dirFile.(fs.ReadDirFile).ReadDir(-1); err != nil || len(list) != 1 || list[0].Name() != "lib" {
+		t.Errorf("ReadDir(-1) = %v, %v, want [lib]", list, err)
+	}
+	if _, err := dirFile.(fs.ReadDirFile).ReadDir(1); err != io.EOF {
+		t.Errorf("ReadDir(1) at the end = %v, want io.EOF", err)
+	}
+}
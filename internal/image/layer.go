@@ -0,0 +1,188 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// Whiteout files mark files deleted by a layer, or a directory whose
+// content from lower layers is hidden
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// node is a file or directory of the merged file system
+type node struct {
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+	// Layer that last wrote the node, numbered from 1; 0 for the root
+	layer  int
+	target string
+	// Entries of a directory by name; nil for other files
+	children map[string]*node
+}
+
+// applyLayer reads the layer blob name and applies it to the merged file
+// system as layer number n, counting its size and files into layer
+func (img *Image) applyLayer(src source, name string, n int, layer *fileinfo.ImageLayer) error {
+	blob, size, err := src.open(name)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	layer.Size = size
+
+	content, err := decompress(blob)
+	if err != nil {
+		return err
+	}
+	reader := tar.NewReader(content)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := cleanName(header.Name)
+		if name == "" {
+			continue
+		}
+		dir, base := path.Dir(name), path.Base(name)
+
+		// Whiteouts only apply to lower layers
+		if base == opaqueWhiteout {
+			if parent := img.lookupDir(dir); parent != nil {
+				hideLower(parent, n)
+			}
+			continue
+		}
+		if hidden, ok := strings.CutPrefix(base, whiteoutPrefix); ok {
+			if parent := img.lookupDir(dir); parent != nil {
+				delete(parent.children, hidden)
+			}
+			continue
+		}
+
+		entry := &node{mode: header.FileInfo().Mode(), modTime: header.ModTime, layer: n}
+		switch header.Typeflag {
+		case tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeDir:
+			entry.children = make(map[string]*node)
+		case tar.TypeSymlink:
+			entry.target = header.Linkname
+		case tar.TypeReg:
+			entry.size = header.Size
+			layer.UncompressedSize += header.Size
+			layer.Files++
+		case tar.TypeLink:
+			// Hard links share the content of their target
+			layer.Files++
+		}
+
+		parent := img.mkdirAll(dir, n)
+		if existing, ok := parent.children[base]; ok && existing.children != nil && entry.children != nil {
+			// Directories merge with the same directory of lower layers
+			existing.mode, existing.modTime, existing.layer = entry.mode, entry.modTime, n
+			continue
+		}
+		parent.children[base] = entry
+	}
+}
+
+// decompress returns the tar stream of a layer blob, which is stored
+// uncompressed or compressed with gzip or bzip2
+func decompress(blob io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(blob)
+	magic, _ := buffered.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(buffered), nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, errors.New("zstd compressed layers aren't supported")
+	}
+	return buffered, nil
+}
+
+// lookupDir returns the directory at the slash-separated path name without
+// following symbolic links, or nil if there is none
+func (img *Image) lookupDir(name string) *node {
+	dir := img.root
+	if name == "." {
+		return dir
+	}
+	for _, part := range strings.Split(name, "/") {
+		dir = dir.children[part]
+		if dir == nil || dir.children == nil {
+			return nil
+		}
+	}
+	return dir
+}
+
+// mkdirAll returns the directory at name, creating it and its parents as
+// part of layer n where they are missing or replaced by other files
+func (img *Image) mkdirAll(name string, n int) *node {
+	dir := img.root
+	if name == "." {
+		return dir
+	}
+	for _, part := range strings.Split(name, "/") {
+		child := dir.children[part]
+		if child == nil || child.children == nil {
+			child = &node{mode: fs.ModeDir | 0755, layer: n, children: make(map[string]*node)}
+			dir.children[part] = child
+		}
+		dir = child
+	}
+	return dir
+}
+
+// hideLower removes the entries below dir that lower layers than n wrote,
+// keeping directories that hold entries of layer n. It returns whether
+// anything of layer n is left.
+func hideLower(dir *node, n int) bool {
+	kept := false
+	for name, child := range dir.children {
+		if child.children != nil && hideLower(child, n) {
+			kept = true
+			continue
+		}
+		if child.layer < n {
+			delete(dir.children, name)
+		} else {
+			kept = true
+		}
+	}
+	return kept
+}
+
+// countVisible adds the size of each file below dir to the visible size of
+// the layer that wrote it
+func (img *Image) countVisible(dir *node) {
+	for _, child := range dir.children {
+		if child.children != nil {
+			img.countVisible(child)
+		} else if child.layer > 0 {
+			img.info.Layers[child.layer-1].VisibleSize += child.size
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Number of symbolic links followed when opening a file of a tarball
+const maxTarLinks = 16
+
+// source is the directory or tarball an image is read from
+type source interface {
+	// open returns the content and size of the file name, a slash-separated
+	// path in the source
+	open(name string) (io.ReadCloser, int64, error)
+	Close() error
+}
+
+// dirSource reads an image from an OCI image layout directory
+type dirSource string
+
+func (d dirSource) open(name string) (io.ReadCloser, int64, error) {
+	if !fs.ValidPath(name) {
+		return nil, 0, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+func (d dirSource) Close() error {
+	return nil
+}
+
+// tarMember is where a file's content is in a tarball, or which member a
+// link points to
+type tarMember struct {
+	offset, size int64
+	link         string
+}
+
+// tarSource reads an image from a docker save tarball, or an image layout
+// packed into one, without extracting it
+type tarSource struct {
+	file    *os.File
+	members map[string]tarMember
+}
+
+// openTarSource indexes the members of the tarball at tarPath
+func openTarSource(tarPath string) (*tarSource, error) {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 2)
+	if _, err := file.ReadAt(magic, 0); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		file.Close()
+		return nil, errors.New("compressed image tarballs aren't supported, decompress it first")
+	}
+
+	// The tar reader seeks past content it doesn't read, so only headers
+	// are read and the file offset is where each member's content starts
+	src := &tarSource{file: file, members: make(map[string]tarMember)}
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return src, nil
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("cannot read image tarball: %v", err)
+		}
+
+		name := cleanName(header.Name)
+		switch header.Typeflag {
+		case tar.TypeReg:
+			offset, err := file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+			src.members[name] = tarMember{offset: offset, size: header.Size}
+		case tar.TypeSymlink:
+			// Older docker save tarballs link layers shared between images
+			src.members[name] = tarMember{link: cleanName(path.Join(path.Dir(name), header.Linkname))}
+		case tar.TypeLink:
+			src.members[name] = tarMember{link: cleanName(header.Linkname)}
+		}
+	}
+}
+
+func (t *tarSource) open(name string) (io.ReadCloser, int64, error) {
+	member, ok := t.members[cleanName(name)]
+	for links := 0; ok && member.link != ""; links++ {
+		if links == maxTarLinks {
+			return nil, 0, fmt.Errorf("too many links to %s", name)
+		}
+		member, ok = t.members[member.link]
+	}
+	if !ok {
+		return nil, 0, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(io.NewSectionReader(t.file, member.offset, member.size)), member.size, nil
+}
+
+func (t *tarSource) Close() error {
+	return t.file.Close()
+}
+
+// cleanName returns a member name as a slash-separated path relative to the
+// root, keeping it from pointing outside
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
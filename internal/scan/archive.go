@@ -0,0 +1,85 @@
+package scan
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+
+	"github.com/steezeburger/storage-shower/internal/archive"
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// Errors stopping the listing of an archive when the scan is canceled or
+// the read is abandoned
+var (
+	errArchiveCanceled = errors.New("scan canceled")
+	errArchiveSkipped  = errors.New("read skipped")
+)
+
+// expandArchive lists the members of an archive file as its children. The
+// archive is read subject to the read timeout and can be skipped like a
+// directory; archives that time out are marked so. Archives that can't be
+// read are left as plain files.
+func (w *walker) expandArchive(entry *fileinfo.FileInfo) {
+	format := archive.Format(entry.Name)
+	if format == "" {
+		return
+	}
+
+	// Only touched by the helper until the read finishes
+	var members []archive.Member
+	list, ok := w.timedRead(entry.Path, func(read *activeRead) listing {
+		var list listing
+		members, list.err = w.readArchive(entry.Path, format, read)
+		list.canceled = errors.Is(list.err, errArchiveCanceled)
+		return list
+	})
+	if !ok {
+		entry.TimedOut = list.timedOut
+		w.recordError(entry, entry.Path, "read", list.err)
+		return
+	}
+	if list.canceled {
+		return
+	}
+	if list.err != nil {
+		log.Printf("Warning: Cannot list archive %s: %v", entry.Path, list.err)
+		if len(members) == 0 {
+			return
+		}
+	}
+
+	archive.Expand(entry, format, members)
+	// Some members are missing from a partly read archive
+	entry.Incomplete = list.err != nil
+}
+
+// readArchive reads the members of the archive file at path, advancing the
+// progress of read with each. It stops early when the scan is canceled or the
+// read is skipped, returning the members read.
+func (w *walker) readArchive(path, format string, read *activeRead) ([]archive.Member, error) {
+	file, err := w.fsys.Open(w.fsName(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var members []archive.Member
+	err = archive.Read(file, format, func(member archive.Member) error {
+		select {
+		case <-w.cancel:
+			return errArchiveCanceled
+		case <-read.skip:
+			return errArchiveSkipped
+		default:
+		}
+		if len(members) >= archive.MaxMembers {
+			return archive.ErrTooManyMembers
+		}
+		atomic.AddInt64(&w.entriesRead, 1)
+		atomic.AddInt64(&read.progress, 1)
+		members = append(members, member)
+		return nil
+	})
+	return members, err
+}
@@ -0,0 +1,137 @@
+package scan
+
+import (
+	"archive/zip"
+	"bytes"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/archive"
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// zipData returns a zip archive of the named files with the given sizes
+func zipData(t *testing.T, files map[string]int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, size := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(make([]byte, size))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestScanFS_ExpandArchives(t *testing.T) {
+	isolateScans(t)
+	data := zipData(t, map[string]int{"site/index.html": 5000, "site/img/logo.png": 20000})
+	fsys := fstest.MapFS{
+		"backup/site.zip": {Data: data},
+		"backup/bad.zip":  {Data: []byte("not a zip")},
+		"notes.txt":       {Data: make([]byte, 10)},
+	}
+	rootPath := normalizePath("/fixture")
+
+	tests := []struct {
+		name   string
+		expand bool
+	}{
+		{"plain files", false},
+		{"expanded", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := ScanFS(fsys, "/fixture", Options{ExpandArchives: test.expand})
+			if err != nil {
+				t.Fatalf("ScanFS() error = %v", err)
+			}
+
+			// Members don't count towards the size on disk
+			size := int64(len(data) + 9 + 10)
+			if root.Size != size || root.FileCount != 3 {
+				t.Errorf("Root size %d, %d files, want %d, 3", root.Size, root.FileCount, size)
+			}
+			if root.Incomplete {
+				t.Error("Scan marked incomplete")
+			}
+
+			site := fileinfo.FindNode(&root, filepath.Join(rootPath, "backup", "site.zip"))
+			if site == nil || site.Size != int64(len(data)) {
+				t.Fatalf("site.zip = %+v, want %d bytes", site, len(data))
+			}
+			logo := fileinfo.FindNode(&root, filepath.Join(rootPath, "backup", "site.zip", "site", "img", "logo.png"))
+			if !test.expand {
+				if site.Archive != "" || len(site.Children) != 0 || logo != nil {
+					t.Errorf("site.zip listed with ExpandArchives off: %+v", site)
+				}
+				return
+			}
+
+			if site.Archive != archive.Zip || site.UncompressedSize != 25000 || site.FileCount != 2 {
+				t.Errorf("site.zip = %s archive with %d bytes in %d files, want zip with 25000 in 2",
+					site.Archive, site.UncompressedSize, site.FileCount)
+			}
+			if logo == nil || logo.UncompressedSize != 20000 || logo.Size <= 0 {
+				t.Errorf("site/img/logo.png = %+v, want a member of 20000 bytes", logo)
+			}
+			if bad := fileinfo.FindNode(&root, filepath.Join(rootPath, "backup", "bad.zip")); bad == nil || bad.Archive != "" {
+				t.Errorf("bad.zip = %+v, want a plain file", bad)
+			}
+		})
+	}
+}
+
+func TestScanFS_ArchiveReadTimeout(t *testing.T) {
+	isolateScans(t)
+	fsys := hangingFS{
+		FS: fstest.MapFS{
+			"backup/site.zip": {Data: zipData(t, map[string]int{"index.html": 5000})},
+			"notes.txt":       {Data: make([]byte, 10)},
+		},
+		hung:    "backup/site.zip",
+		release: make(chan struct{}),
+	}
+	t.Cleanup(func() { close(fsys.release) })
+
+	type scanResult struct {
+		tree fileinfo.FileInfo
+		err  error
+	}
+	done := make(chan scanResult, 1)
+	go func() {
+		tree, err := ScanFS(fsys, "/fixture", Options{ExpandArchives: true, ReadTimeout: 50 * time.Millisecond})
+		done <- scanResult{tree, err}
+	}()
+
+	var root fileinfo.FileInfo
+	select {
+	case result := <-done:
+		if result.err != nil {
+			t.Fatalf("ScanFS() error = %v", result.err)
+		}
+		root = result.tree
+	case <-time.After(5 * time.Second):
+		t.Fatal("Scan didn't move on from the hung archive")
+	}
+
+	site := fileinfo.FindNode(&root, filepath.Join(normalizePath("/fixture"), "backup", "site.zip"))
+	if site == nil {
+		t.Fatal("Archive missing from the tree")
+	}
+	if !site.TimedOut || len(site.Children) != 0 || site.Archive != "" {
+		t.Errorf("Hung archive timed out %v with %d children as %q, want timed out plain file",
+			site.TimedOut, len(site.Children), site.Archive)
+	}
+	if root.ErrorCount != 1 {
+		t.Errorf("ErrorCount = %d, want 1", root.ErrorCount)
+	}
+}
@@ -0,0 +1,137 @@
+package scan
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// CleanupError is an item that couldn't be removed
+type CleanupError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// CleanupResult lists what a cleanup removed and what it couldn't
+type CleanupResult struct {
+	Removed []string       `json:"removed"`
+	Errors  []CleanupError `json:"errors"`
+}
+
+// Cleanup removes the items of a cleanup report that lie under rootPath.
+// Each item is checked again before removal, so anything that gained data
+// since the scan is kept.
+func Cleanup(rootPath string, report fileinfo.CleanupReport) CleanupResult {
+	result := CleanupResult{Removed: []string{}, Errors: []CleanupError{}}
+
+	remove := func(path string, check func(string) error) {
+		err := checkUnderRoot(rootPath, path)
+		if err == nil {
+			err = check(path)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, CleanupError{Path: path, Error: err.Error()})
+			return
+		}
+		log.Printf("Cleanup removed %s", path)
+		result.Removed = append(result.Removed, path)
+	}
+
+	for _, path := range report.EmptyFiles {
+		remove(path, removeEmptyFile)
+	}
+	for _, link := range report.BrokenLinks {
+		remove(link.Path, removeBrokenLink)
+	}
+	for _, path := range report.EmptyDirs {
+		remove(path, removeEmptyTree)
+	}
+
+	return result
+}
+
+// checkUnderRoot returns an error unless path is strictly inside rootPath,
+// also after resolving symbolic links in its parent directories
+func checkUnderRoot(rootPath, path string) error {
+	if !isInside(rootPath, path) {
+		return fmt.Errorf("not inside the scanned root %s", rootPath)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(rootPath)
+	if err != nil {
+		return err
+	}
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if realParent != realRoot && !isInside(realRoot, realParent) {
+		return fmt.Errorf("resolves outside the scanned root %s", rootPath)
+	}
+	return nil
+}
+
+// isInside reports whether path lies strictly inside dir
+func isInside(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// removeEmptyFile removes a regular file if it's still empty
+func removeEmptyFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Size() != 0 {
+		return fmt.Errorf("no longer an empty file")
+	}
+	return os.Remove(path)
+}
+
+// removeBrokenLink removes a symbolic link if its target still doesn't exist
+func removeBrokenLink(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("no longer a symbolic link")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("link target exists")
+	}
+	return os.Remove(path)
+}
+
+// removeEmptyTree removes a directory tree if it holds nothing but
+// directories
+func removeEmptyTree(path string) error {
+	var dirs []string
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return fmt.Errorf("no longer empty, contains %s", p)
+		}
+		dirs = append(dirs, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove the deepest directories first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Remove(dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
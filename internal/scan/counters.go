@@ -0,0 +1,29 @@
+package scan
+
+// Counters are totals across all scans since the process started
+type Counters struct {
+	ScansCompleted int64 `json:"scansCompleted"`
+	ScansFailed    int64 `json:"scansFailed"`
+	// Entries that couldn't be read
+	Errors int64 `json:"errors"`
+	// Times a scan was detected as stalled
+	Stalls int64 `json:"stalls"`
+}
+
+// Totals since the process started, guarded by statusMutex
+var counters Counters
+
+// GetCounters returns the totals across all scans since the process started
+func GetCounters() Counters {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	return counters
+}
+
+// countError records an entry the current scan couldn't read
+func countError() {
+	statusMutex.Lock()
+	scanStatus.Errors++
+	counters.Errors++
+	statusMutex.Unlock()
+}
@@ -0,0 +1,44 @@
+package scan
+
+import "sync"
+
+// Subscribers waiting for scan status changes
+var (
+	statusSubscribers = make(map[chan struct{}]struct{})
+	subscribersMutex  sync.Mutex
+)
+
+// SubscribeStatus registers for scan status change notifications. The returned
+// channel receives a value whenever the status changes. Notifications are
+// coalesced so a slow reader never blocks the scanner; readers should call
+// GetScanStatus to fetch the latest state. Call the returned function to
+// unsubscribe.
+func SubscribeStatus() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	subscribersMutex.Lock()
+	statusSubscribers[ch] = struct{}{}
+	subscribersMutex.Unlock()
+
+	unsubscribe := func() {
+		subscribersMutex.Lock()
+		delete(statusSubscribers, ch)
+		subscribersMutex.Unlock()
+	}
+
+	return ch, unsubscribe
+}
+
+// notifyStatusChange signals all subscribers that the scan status changed
+func notifyStatusChange() {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+
+	for ch := range statusSubscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A notification is already pending for this subscriber
+		}
+	}
+}
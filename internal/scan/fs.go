@@ -0,0 +1,54 @@
+package scan
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// dirFS is the file system of a directory of the operating system. Unlike
+// os.DirFS it reads symbolic links, and its errors carry the full paths.
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+// newDirFS returns the file system rooted at dir
+func newDirFS(dir string) dirFS {
+	return dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+// path returns the location of the named file on the operating system
+func (f dirFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(f.dir, filepath.FromSlash(name)), nil
+}
+
+// ReadDir lists the named directory sorted by name
+func (f dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := f.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(path)
+}
+
+// Stat returns the file info of the named file, following symbolic links
+func (f dirFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := f.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+// ReadLink returns the target of the named symbolic link
+func (f dirFS) ReadLink(name string) (string, error) {
+	path, err := f.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(path)
+}
@@ -0,0 +1,149 @@
+package scan
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+var fixtureTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// statFS reports inodes, blocks, owners and times for the files of a MapFS
+type statFS struct {
+	fstest.MapFS
+}
+
+func (f statFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := f.MapFS.ReadDir(name)
+	for i := range entries {
+		entries[i] = statEntry{entries[i]}
+	}
+	return entries, err
+}
+
+type statEntry struct {
+	fs.DirEntry
+}
+
+func (e statEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return statInfo{info}, nil
+}
+
+// statInfo is a file info with 4 KiB blocks owned by IDs without names
+type statInfo struct {
+	fs.FileInfo
+}
+
+func (statInfo) FileID() (dev, ino uint64, ok bool) { return 1, 42, true }
+func (i statInfo) Blocks() (blocks int64, ok bool)  { return (i.Size() + 4095) / 4096 * 8, true }
+func (statInfo) Owner() (uid, gid uint32, ok bool)  { return 4242421, 4242422, true }
+func (statInfo) Times() (atime, ctime time.Time, ok bool) {
+	return fixtureTime, fixtureTime.Add(time.Hour), true
+}
+
+func fixtureFS() fstest.MapFS {
+	return fstest.MapFS{
+		"docs/readme.md":    {Data: make([]byte, 10), ModTime: fixtureTime},
+		"docs/img/logo.png": {Data: make([]byte, 100)},
+		"bin/tool":          {Data: make([]byte, 50), Mode: 0755},
+		".cache/blob":       {Data: make([]byte, 1000)},
+		"latest":            {Data: []byte("docs"), Mode: fs.ModeSymlink},
+	}
+}
+
+func TestScanFS(t *testing.T) {
+	isolateScans(t)
+
+	root, err := ScanFS(fixtureFS(), "/fixture", Options{IgnoreHidden: true})
+	if err != nil {
+		t.Fatalf("ScanFS() error = %v", err)
+	}
+
+	rootPath := normalizePath("/fixture")
+	if root.Path != rootPath || !root.IsDir {
+		t.Errorf("Root = %s (dir %v), want directory %s", root.Path, root.IsDir, rootPath)
+	}
+	if root.Size != 164 || root.FileCount != 4 || root.DirCount != 3 {
+		t.Errorf("Root size %d, %d files, %d dirs, want 164, 4, 3", root.Size, root.FileCount, root.DirCount)
+	}
+	if node := fileinfo.FindNode(&root, filepath.Join(rootPath, ".cache")); node != nil {
+		t.Error("Hidden directory should be skipped")
+	}
+
+	img := fileinfo.FindNode(&root, filepath.Join(rootPath, "docs", "img"))
+	if img == nil || img.Size != 100 || img.Extensions["png"].Files != 1 {
+		t.Errorf("docs/img = %+v, want 100 bytes in one png", img)
+	}
+	readme := fileinfo.FindNode(&root, filepath.Join(rootPath, "docs", "readme.md"))
+	if readme == nil || readme.ModTime != fixtureTime.Unix() {
+		t.Errorf("docs/readme.md = %+v, want modification time from the fixture", readme)
+	}
+	link := fileinfo.FindNode(&root, filepath.Join(rootPath, "latest"))
+	if link == nil || link.Mode&fs.ModeSymlink == 0 || link.BrokenLink {
+		t.Errorf("latest = %+v, want a symbolic link", link)
+	}
+
+	history := History()
+	if len(history) != 1 || history[0].Path != rootPath || history[0].Size != 164 {
+		t.Errorf("History = %+v, want the scan of %s", history, rootPath)
+	}
+}
+
+func TestScanFS_StatInfo(t *testing.T) {
+	isolateScans(t)
+
+	root, err := ScanFS(statFS{fixtureFS()}, "/fixture", Options{})
+	if err != nil {
+		t.Fatalf("ScanFS() error = %v", err)
+	}
+
+	blob := fileinfo.FindNode(&root, filepath.Join(normalizePath("/fixture"), ".cache", "blob"))
+	if blob == nil {
+		t.Fatal("File missing from the tree")
+	}
+	if blob.DiskUsage != 4096 {
+		t.Errorf("DiskUsage = %d, want 4096", blob.DiskUsage)
+	}
+	if blob.UID != 4242421 || blob.GID != 4242422 || blob.Owner != "4242421" {
+		t.Errorf("Owner = %s (%d:%d), want IDs from StatInfo", blob.Owner, blob.UID, blob.GID)
+	}
+	if blob.AccessTime != fixtureTime.Unix() || blob.ChangeTime != fixtureTime.Add(time.Hour).Unix() {
+		t.Errorf("Times = %d, %d, want the ones from StatInfo", blob.AccessTime, blob.ChangeTime)
+	}
+	if root.Owners["4242421"] != root.Size {
+		t.Errorf("Owners = %v, want all %d bytes owned by 4242421", root.Owners, root.Size)
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a", "b", "c.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a/b/c.txt", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("Cannot create symbolic links: %v", err)
+	}
+
+	fsys := newDirFS(dir)
+	if err := fstest.TestFS(fsys, "a/b/c.txt"); err != nil {
+		t.Error(err)
+	}
+	if target, err := fsys.ReadLink("link"); err != nil || target != "a/b/c.txt" {
+		t.Errorf("ReadLink() = %q, %v, want a/b/c.txt", target, err)
+	}
+	if _, err := fsys.ReadDir("../outside"); err == nil {
+		t.Error("ReadDir() of a name outside the root succeeded")
+	}
+}
@@ -0,0 +1,46 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/git"
+)
+
+// scanGitHistory sizes the history of the git repository at repoPath by the
+// objects it keeps on disk, reporting it below the git directory. Options
+// for walking a file system don't apply.
+func scanGitHistory(repoPath string, opts Options) (fileinfo.FileInfo, error) {
+	repoPath = normalizePath(repoPath)
+	log.Printf("Reading git history of: %s", repoPath)
+	beginScan(repoPath, "")
+
+	statusMutex.Lock()
+	cancel := cancelScan
+	statusMutex.Unlock()
+	progress := func(done, total int) {
+		statusMutex.Lock()
+		scanStatus.ScannedItems = done
+		scanStatus.TotalItems = max(total, 1)
+		scanStatus.Progress = float64(done) / float64(scanStatus.TotalItems)
+		statusMutex.Unlock()
+		notifyStatusChange()
+	}
+
+	root, err := git.Analyze(repoPath, progress, cancel)
+	if errors.Is(err, git.ErrCanceled) {
+		// Half-walked history would attribute blobs to the wrong paths
+		log.Printf("Scan was canceled")
+		failScan()
+		return fileinfo.FileInfo{}, err
+	}
+	if err != nil {
+		failScan()
+		return fileinfo.FileInfo{}, fmt.Errorf("failed to read git history: %v", err)
+	}
+
+	finishScan(&root, opts)
+	return root, nil
+}
@@ -0,0 +1,82 @@
+package scan
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// writeRepo creates a git repository with one commit of the given files
+func writeRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestScanDirectory_GitHistory(t *testing.T) {
+	isolateScans(t)
+	repo := writeRepo(t, map[string]string{"notes.txt": "some notes\n", "data.csv": "a,b\n1,2\n"})
+
+	root, err := ScanDirectory(repo, Options{GitHistory: true})
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+
+	gitDir := filepath.Join(normalizePath(repo), ".git")
+	if root.Path != gitDir {
+		t.Errorf("Root path = %s, want %s", root.Path, gitDir)
+	}
+	// Two blobs at their paths, the tree and the commit
+	if root.Objects != 4 || root.FileCount != 4 {
+		t.Errorf("Root has %d objects in %d files, want 4 in 4", root.Objects, root.FileCount)
+	}
+	notes := fileinfo.FindNode(&root, filepath.Join(gitDir, "notes.txt"))
+	if notes == nil || notes.Objects != 1 || notes.UncompressedSize != 11 {
+		t.Errorf("notes.txt = %+v, want 1 version of 11 bytes", notes)
+	}
+
+	history := History()
+	if len(history) != 1 || history[0].Path != gitDir {
+		t.Errorf("History = %+v, want the scan of %s", history, gitDir)
+	}
+	if status := GetScanStatus(); status.InProgress || status.Progress != 1 {
+		t.Errorf("Status = %+v, want a finished scan", status)
+	}
+}
+
+func TestScanDirectory_GitHistoryErrors(t *testing.T) {
+	isolateScans(t)
+
+	if _, err := ScanDirectory(t.TempDir(), Options{GitHistory: true}); err == nil {
+		t.Error("ScanDirectory() of a directory without a repository succeeded")
+	}
+	if status := GetScanStatus(); status.InProgress {
+		t.Error("Scan still in progress after failing to read the repository")
+	}
+	if _, err := ScanDirectory(t.TempDir(), Options{GitHistory: true, Image: true}); err == nil {
+		t.Error("ScanDirectory() as both an image and a git history succeeded")
+	}
+}
@@ -0,0 +1,248 @@
+package scan
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pattern of the result files written by ScanDirectory
+const resultFilePattern = "storage-shower-*.json"
+
+// RetentionPolicy decides which scans of the roots matching Path are kept.
+// A scan is kept if any of the rules keeps it; pinned scans are always kept.
+type RetentionPolicy struct {
+	// Glob pattern matched against the scanned root path
+	Path string `json:"path"`
+	// Number of most recent scans to keep
+	KeepLast int `json:"keepLast,omitempty"`
+	// Keep the newest scan of each of this many most recent days, weeks
+	// and months that have scans
+	KeepDaily   int `json:"keepDaily,omitempty"`
+	KeepWeekly  int `json:"keepWeekly,omitempty"`
+	KeepMonthly int `json:"keepMonthly,omitempty"`
+}
+
+// Retention policies by root, the first match applies
+var retentionPolicies []RetentionPolicy
+
+// ValidateRetention checks that retention policies have a valid pattern and
+// keep at least one scan
+func ValidateRetention(policies []RetentionPolicy) error {
+	for _, policy := range policies {
+		if _, err := filepath.Match(policy.Path, ""); err != nil || policy.Path == "" {
+			return fmt.Errorf("invalid path pattern %q in retention policy", policy.Path)
+		}
+		if policy.KeepLast < 0 || policy.KeepDaily < 0 || policy.KeepWeekly < 0 || policy.KeepMonthly < 0 {
+			return fmt.Errorf("retention policy for %q keeps a negative number of scans", policy.Path)
+		}
+		if policy.KeepLast+policy.KeepDaily+policy.KeepWeekly+policy.KeepMonthly == 0 {
+			return fmt.Errorf("retention policy for %q keeps no scans", policy.Path)
+		}
+	}
+	return nil
+}
+
+// SetRetentionPolicies sets the per-root retention policies. Roots no
+// policy matches keep their most recent scans up to the history retention.
+func SetRetentionPolicies(policies []RetentionPolicy) {
+	statusMutex.Lock()
+	retentionPolicies = append([]RetentionPolicy(nil), policies...)
+	statusMutex.Unlock()
+}
+
+// policyFor returns the retention policy for scans of rootPath. Callers
+// must hold statusMutex.
+func policyFor(rootPath string) RetentionPolicy {
+	for _, policy := range retentionPolicies {
+		if matched, _ := filepath.Match(policy.Path, rootPath); matched {
+			return policy
+		}
+	}
+	return RetentionPolicy{Path: rootPath, KeepLast: historyRetention}
+}
+
+// applyRetention splits scans, newest first, into the ones to keep and the
+// ones to remove, applying the policy of each root separately. The same
+// root on different hosts counts as different roots.
+func applyRetention(scans []ScanRecord, policyFor func(string) RetentionPolicy) (kept, removed []ScanRecord) {
+	type hostRoot struct{ host, path string }
+	byRoot := make(map[hostRoot][]int)
+	for i, record := range scans {
+		key := hostRoot{record.Host, record.Path}
+		byRoot[key] = append(byRoot[key], i)
+	}
+
+	keep := make([]bool, len(scans))
+	for root, indexes := range byRoot {
+		policy := policyFor(root.path)
+
+		// Keep the newest scan of each of the most recent periods
+		keepPeriods := func(n int, period func(time.Time) string) {
+			seen := make(map[string]bool)
+			for _, i := range indexes {
+				if len(seen) >= n {
+					break
+				}
+				key := period(scans[i].Timestamp.Local())
+				if !seen[key] {
+					seen[key] = true
+					keep[i] = true
+				}
+			}
+		}
+
+		for n, i := range indexes {
+			if n < policy.KeepLast || scans[i].Pinned {
+				keep[i] = true
+			}
+		}
+		keepPeriods(policy.KeepDaily, func(t time.Time) string {
+			return t.Format("2006-01-02")
+		})
+		keepPeriods(policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		})
+		keepPeriods(policy.KeepMonthly, func(t time.Time) string {
+			return t.Format("2006-01")
+		})
+	}
+
+	kept = []ScanRecord{}
+	for i, record := range scans {
+		if keep[i] {
+			kept = append(kept, record)
+		} else {
+			removed = append(removed, record)
+		}
+	}
+	return kept, removed
+}
+
+// pruneHistory applies the retention policies to the scan history and
+// returns the result files of the scans it dropped. Callers must hold
+// statusMutex.
+func pruneHistory() []string {
+	kept, removed := applyRetention(PreviousScans, policyFor)
+	PreviousScans = kept
+
+	files := make([]string, 0, len(removed))
+	for _, record := range removed {
+		files = append(files, resultFile(record.ResultID))
+	}
+	return files
+}
+
+// removeResultFiles deletes the result files of scans dropped from history
+func removeResultFiles(files []string) {
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: Cannot remove scan result %s: %v", file, err)
+		}
+	}
+}
+
+// resultFile returns the location of the result file of a scan
+func resultFile(resultID string) string {
+	return filepath.Join(os.TempDir(), filepath.Base(resultID))
+}
+
+// History returns a copy of the previous scans, newest first
+func History() []ScanRecord {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	return append([]ScanRecord{}, PreviousScans...)
+}
+
+// UpdateScanRecord pins or unpins a scan and sets its label. Nil values are
+// left unchanged. The history is saved when the record changes.
+func UpdateScanRecord(resultID string, pinned *bool, label *string) (ScanRecord, error) {
+	statusMutex.Lock()
+	var record ScanRecord
+	found := false
+	for i := range PreviousScans {
+		if PreviousScans[i].ResultID != resultID {
+			continue
+		}
+		if pinned != nil {
+			PreviousScans[i].Pinned = *pinned
+		}
+		if label != nil {
+			PreviousScans[i].Label = strings.TrimSpace(*label)
+		}
+		record = PreviousScans[i]
+		found = true
+		break
+	}
+	statusMutex.Unlock()
+
+	if !found {
+		return ScanRecord{}, fmt.Errorf("scan result with ID %s not found", resultID)
+	}
+	SavePreviousScans()
+	return record, nil
+}
+
+// CleanOrphanedResults removes result files in the temporary directory that
+// no scan in the history refers to, and returns their paths. Other instances
+// share the directory and the saved history, so files the saved history
+// refers to or that are newer than it are left alone, as are files written
+// by a scan in progress.
+func CleanOrphanedResults() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(os.TempDir(), resultFilePattern))
+	if err != nil {
+		return nil, err
+	}
+
+	saved, savedAt, err := readSavedHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	statusMutex.Lock()
+	referenced := make(map[string]bool, len(PreviousScans)+len(saved))
+	for _, record := range append(saved, PreviousScans...) {
+		referenced[resultFile(record.ResultID)] = true
+	}
+	referenced[resultPath] = true
+	var scanStarted time.Time
+	if scanStatus.InProgress {
+		scanStarted = scanStatus.StartedAt
+	}
+	statusMutex.Unlock()
+
+	removed := []string{}
+	for _, file := range files {
+		if referenced[file] {
+			continue
+		}
+		info, err := os.Lstat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		// Files newer than the saved history, or any without one, may
+		// belong to a scan another instance hasn't recorded yet
+		if !info.ModTime().Before(savedAt) {
+			continue
+		}
+		if !scanStarted.IsZero() && !info.ModTime().Before(scanStarted) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			log.Printf("Warning: Cannot remove orphaned scan result %s: %v", file, err)
+			continue
+		}
+		removed = append(removed, file)
+	}
+
+	if len(removed) > 0 {
+		log.Printf("Removed %d orphaned scan result files", len(removed))
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
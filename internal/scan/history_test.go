@@ -0,0 +1,132 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+func TestApplyRetention(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2024, 5, d, hour, 0, 0, 0, time.Local)
+	}
+	// Newest first, two roots interleaved
+	scans := []ScanRecord{
+		{Path: "/data", ResultID: "d1", Timestamp: day(20, 12)},
+		{Path: "/tmp/x", ResultID: "t1", Timestamp: day(20, 11)},
+		{Path: "/data", ResultID: "d2", Timestamp: day(20, 9)},
+		{Path: "/tmp/x", ResultID: "t2", Timestamp: day(20, 8)},
+		{Path: "/tmp/x", ResultID: "t3", Timestamp: day(19, 8)},
+		{Path: "/data", ResultID: "d3", Timestamp: day(19, 9)},
+		{Path: "/data", ResultID: "d4", Timestamp: day(12, 9)},
+		{Path: "/data", ResultID: "d5", Timestamp: day(1, 9), Pinned: true},
+		{Path: "/data", ResultID: "d6", Timestamp: time.Date(2024, 4, 2, 9, 0, 0, 0, time.Local)},
+	}
+
+	tests := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{"last", RetentionPolicy{KeepLast: 2}, []string{"d1", "d2", "d5"}},
+		{"daily", RetentionPolicy{KeepDaily: 2}, []string{"d1", "d3", "d5"}},
+		{"weekly", RetentionPolicy{KeepWeekly: 3}, []string{"d1", "d3", "d4", "d5"}},
+		{"monthly", RetentionPolicy{KeepMonthly: 2}, []string{"d1", "d5", "d6"}},
+		{"combined", RetentionPolicy{KeepLast: 1, KeepDaily: 2, KeepMonthly: 2}, []string{"d1", "d3", "d5", "d6"}},
+	}
+
+	for _, test := range tests {
+		// Scratch directories keep only their latest scan
+		policyFor := func(root string) RetentionPolicy {
+			if root == "/data" {
+				return test.policy
+			}
+			return RetentionPolicy{KeepLast: 1}
+		}
+
+		kept, removed := applyRetention(scans, policyFor)
+		var got []string
+		for _, record := range kept {
+			if record.Path == "/data" {
+				got = append(got, record.ResultID)
+			} else if record.ResultID != "t1" {
+				t.Errorf("%s: kept %s of /tmp/x, want only t1", test.name, record.ResultID)
+			}
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: kept %v, want %v", test.name, got, test.expected)
+		}
+		if len(kept)+len(removed) != len(scans) {
+			t.Errorf("%s: kept %d and removed %d of %d scans", test.name, len(kept), len(removed), len(scans))
+		}
+	}
+}
+
+func TestValidateRetention(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []RetentionPolicy
+		valid    bool
+	}{
+		{"valid", []RetentionPolicy{{Path: "/data", KeepLast: 3, KeepWeekly: 8}}, true},
+		{"missing path", []RetentionPolicy{{KeepLast: 1}}, false},
+		{"bad pattern", []RetentionPolicy{{Path: "/data/[", KeepLast: 1}}, false},
+		{"keeps nothing", []RetentionPolicy{{Path: "/data"}}, false},
+		{"negative", []RetentionPolicy{{Path: "/data", KeepLast: 2, KeepDaily: -1}}, false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateRetention(test.policies); (err == nil) != test.valid {
+			t.Errorf("%s: ValidateRetention() error = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestStoreResult(t *testing.T) {
+	isolateScans(t)
+	SetHistoryRetention(2)
+	t.Cleanup(func() { SetHistoryRetention(MaxPreviousScans) })
+
+	day := func(d int) time.Time {
+		return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC)
+	}
+	root := fileinfo.FileInfo{Name: "build", Path: "/build", IsDir: true, Size: 4096}
+
+	// Uploads arriving out of order, from two hosts with the same root
+	for _, upload := range []ScanRecord{
+		{Host: "ci-1", Timestamp: day(3)},
+		{Host: "ci-2", Timestamp: day(2)},
+		{Host: "ci-1", Timestamp: day(1)},
+		{Host: "ci-1", Timestamp: day(4)},
+	} {
+		record, err := StoreResult(root, upload)
+		if err != nil {
+			t.Fatalf("StoreResult() error = %v", err)
+		}
+		if record.Path != "/build" || record.Size != 4096 || record.ResultID == "" {
+			t.Errorf("StoreResult() = %+v, want the path, size and ID of the result", record)
+		}
+	}
+
+	var got []string
+	for _, record := range History() {
+		got = append(got, record.Host+" "+record.Timestamp.Format("01-02"))
+	}
+	want := []string{"ci-1 05-04", "ci-1 05-03", "ci-2 05-02"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("History = %v, want %v", got, want)
+	}
+
+	stored, err := GetScanResultByID(History()[0].ResultID)
+	if err != nil || stored.Size != 4096 {
+		t.Errorf("GetScanResultByID() = %d bytes, %v, want the uploaded result", stored.Size, err)
+	}
+	if _, ok := latestResult("/build"); ok {
+		t.Error("latestResult() returned an uploaded scan, want only scans of this machine")
+	}
+	if _, err := StoreResult(root, ScanRecord{}); err == nil {
+		t.Error("StoreResult() without a host succeeded")
+	}
+}
@@ -0,0 +1,33 @@
+package scan
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/image"
+)
+
+// imageFS is implemented by the file systems of container images to
+// describe the image and its layers
+type imageFS interface {
+	fs.FS
+	Info() fileinfo.ImageInfo
+}
+
+// scanImage applies the layers of the container image at imagePath and
+// scans the merged file system. File content isn't kept, so it can't be
+// sniffed or listed as an archive.
+func scanImage(imagePath string, opts Options) (fileinfo.FileInfo, error) {
+	log.Printf("Reading container image: %s", imagePath)
+	img, err := image.Open(normalizePath(imagePath))
+	if err != nil {
+		failScan()
+		return fileinfo.FileInfo{}, fmt.Errorf("failed to read image: %v", err)
+	}
+
+	opts.SniffContent = false
+	opts.ExpandArchives = false
+	return ScanFS(img, imagePath, opts)
+}
@@ -0,0 +1,91 @@
+package scan
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// writeImage writes a docker save tarball whose layers hold files of the
+// given sizes by name
+func writeImage(t *testing.T, layers ...map[string]int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	add := func(name string, data []byte) {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))})
+		tw.Write(data)
+	}
+
+	var names []string
+	for i, files := range layers {
+		var layer bytes.Buffer
+		lw := tar.NewWriter(&layer)
+		for name, size := range files {
+			lw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(size)})
+			lw.Write(make([]byte, size))
+		}
+		lw.Close()
+		names = append(names, "layers/"+string(rune('a'+i))+"/layer.tar")
+		add(names[i], layer.Bytes())
+	}
+	manifest, _ := json.Marshal([]map[string]any{{"RepoTags": []string{"app:latest"}, "Layers": names}})
+	add("manifest.json", manifest)
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScanDirectory_Image(t *testing.T) {
+	isolateScans(t)
+	imagePath := writeImage(t,
+		map[string]int{"usr/lib/libbig.so": 20000, "app/main": 500},
+		map[string]int{"app/main": 800, "app/data.db": 3000},
+	)
+
+	root, err := ScanDirectory(imagePath, Options{Image: true, SniffContent: true, ExpandArchives: true})
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+
+	if root.Image == nil || len(root.Image.Layers) != 2 || root.Image.Tags[0] != "app:latest" {
+		t.Fatalf("Image = %+v, want app:latest with 2 layers", root.Image)
+	}
+	if root.Size != 23800 || root.FileCount != 3 {
+		t.Errorf("Root size %d, %d files, want 23800, 3", root.Size, root.FileCount)
+	}
+	if root.LayerSizes[1] != 20000 || root.LayerSizes[2] != 3800 {
+		t.Errorf("LayerSizes = %v, want 20000 bytes from layer 1 and 3800 from layer 2", root.LayerSizes)
+	}
+	main := fileinfo.FindNode(&root, filepath.Join(normalizePath(imagePath), "app", "main"))
+	if main == nil || main.Size != 800 || main.Layer != 2 {
+		t.Errorf("app/main = %+v, want 800 bytes from layer 2", main)
+	}
+
+	history := History()
+	if len(history) != 1 || history[0].Path != normalizePath(imagePath) {
+		t.Errorf("History = %+v, want the scan of %s", history, imagePath)
+	}
+}
+
+func TestScanDirectory_ImageError(t *testing.T) {
+	isolateScans(t)
+
+	if _, err := ScanDirectory(t.TempDir(), Options{Image: true}); err == nil {
+		t.Fatal("ScanDirectory() of a directory without an image succeeded")
+	}
+	if status := GetScanStatus(); status.InProgress {
+		t.Error("Scan still in progress after failing to read the image")
+	}
+}
@@ -0,0 +1,260 @@
+package scan
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// readDir lists a directory; tests replace it to simulate slow filesystems
+var readDir = fs.ReadDir
+
+// listing is the outcome of reading a directory
+type listing struct {
+	children []fileinfo.FileInfo
+	// Entries that couldn't be read
+	errors []entryError
+	// Error listing the directory; entries read before it are kept
+	err error
+	// Whether the scan was canceled while reading
+	canceled bool
+	// Whether the read took longer than the read timeout
+	timedOut bool
+}
+
+// entryError is an entry of a directory that couldn't be read
+type entryError struct {
+	path string
+	op   string
+	err  error
+}
+
+// activeRead is a directory being read
+type activeRead struct {
+	path    string
+	started time.Time
+	// Closed to stop waiting for the read
+	skip    chan struct{}
+	skipped bool
+	// Entries handled by the helper; the read doesn't time out while it
+	// grows
+	progress int64
+
+	// Entries read so far, kept when the read is abandoned
+	mutex     sync.Mutex
+	partial   listing
+	abandoned bool
+}
+
+// update changes the entries read so far, unless the read was abandoned
+func (r *activeRead) update(change func(list *listing)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.abandoned {
+		change(&r.partial)
+	}
+}
+
+// result returns the entries read so far
+func (r *activeRead) result() listing {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.partial
+}
+
+// abandon stops the helper from adding entries and returns those it read
+func (r *activeRead) abandon() listing {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.abandoned = true
+	return listing{children: r.partial.children, errors: r.partial.errors}
+}
+
+// readDirectory reads the entries of a directory in a helper goroutine. It
+// returns false if the read was skipped or timed out before it finished, in
+// which case the listing's error says why and it holds the entries read
+// until then. The helper of an abandoned read may stay blocked in the
+// filesystem until it returns.
+func (w *walker) readDirectory(path string) (listing, bool) {
+	return w.timedRead(path, func(read *activeRead) listing {
+		return w.readEntries(path, read)
+	})
+}
+
+// timedRead runs read for path in a helper goroutine, subject to the read
+// timeout and skipping like a directory read. The read times out once the
+// read timeout passes without it advancing its progress. read should return
+// early once its skip channel is closed.
+func (w *walker) timedRead(path string, read func(active *activeRead) listing) (listing, bool) {
+	active := &activeRead{path: path, started: time.Now(), skip: make(chan struct{})}
+	w.activeMutex.Lock()
+	w.active[path] = active
+	w.activeMutex.Unlock()
+	defer func() {
+		w.activeMutex.Lock()
+		delete(w.active, path)
+		w.activeMutex.Unlock()
+	}()
+
+	// Buffered so an abandoned read can finish without blocking
+	done := make(chan listing, 1)
+	go func() {
+		done <- read(active)
+	}()
+
+	// A nil channel never fires, so reads without a timeout wait forever
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	if w.opts.ReadTimeout > 0 {
+		timer = time.NewTimer(w.opts.ReadTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var progress int64
+	for {
+		select {
+		case list := <-done:
+			return list, true
+		case <-timeout:
+			// Give a read that's still advancing another timeout
+			if current := atomic.LoadInt64(&active.progress); current != progress {
+				progress = current
+				timer.Reset(w.opts.ReadTimeout)
+				continue
+			}
+			// Stop the helper at the next entry if the read unblocks
+			w.skip(path)
+			list := active.abandon()
+			list.err = fmt.Errorf("timed out after %v without progress", w.opts.ReadTimeout)
+			list.timedOut = true
+			return list, false
+		case <-active.skip:
+			list := active.abandon()
+			list.err = fmt.Errorf("skipped after blocking for %v",
+				time.Since(active.started).Round(time.Second))
+			return list, false
+		case <-w.cancel:
+			return listing{canceled: true}, true
+		}
+	}
+}
+
+// listWithin lists the named directory of fsys, giving up on it after timeout
+// when that's positive. It returns false if cancel was closed first. Entries
+// read before an error are returned.
+func listWithin(fsys fs.FS, name string, timeout time.Duration, cancel <-chan struct{}) ([]fs.DirEntry, bool) {
+	// Buffered so an abandoned read can finish without blocking
+	done := make(chan []fs.DirEntry, 1)
+	go func() {
+		entries, _ := fs.ReadDir(fsys, name)
+		done <- entries
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case entries := <-done:
+		return entries, true
+	case <-expired:
+		return nil, true
+	case <-cancel:
+		return nil, false
+	}
+}
+
+// readEntries lists a directory and gathers the file info of its entries
+// into read, advancing its progress with each entry. It stops early when the
+// scan is canceled or the read is skipped.
+func (w *walker) readEntries(path string, read *activeRead) listing {
+	// Keep the entries read before an error
+	name := w.fsName(path)
+	entries, err := readDir(w.fsys, name)
+	read.update(func(list *listing) {
+		list.err = err
+		list.children = make([]fileinfo.FileInfo, 0, len(entries))
+	})
+
+	for _, entry := range entries {
+		select {
+		case <-w.cancel:
+			read.update(func(list *listing) { list.canceled = true })
+			return read.result()
+		case <-read.skip:
+			return read.result()
+		default:
+		}
+
+		entryName := entry.Name()
+		entryPath := filepath.Join(path, entryName)
+		atomic.AddInt64(&w.entriesRead, 1)
+		atomic.AddInt64(&read.progress, 1)
+
+		// Skip hidden and excluded files/directories if requested
+		if shouldSkip(entryPath, w.opts) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			read.update(func(list *listing) {
+				list.errors = append(list.errors, entryError{path: entryPath, op: "lstat", err: err})
+			})
+			continue
+		}
+
+		// Extract extension for files
+		extension := ""
+		if !info.IsDir() {
+			if ext := filepath.Ext(entryPath); ext != "" {
+				extension = ext[1:] // Remove the leading dot
+			}
+		}
+
+		entryInfo := fileinfo.FileInfo{
+			Name:      entryName,
+			Path:      entryPath,
+			Size:      info.Size(),
+			IsDir:     entry.IsDir(),
+			Extension: extension,
+		}
+		fsEntry := joinName(name, entryName)
+		recordStat(w.fsys, fsEntry, &entryInfo, info)
+
+		// Detect the type of unrecognized regular files from their content
+		if w.opts.SniffContent && info.Mode().IsRegular() && info.Size() > 0 &&
+			fileinfo.ClassifyFile(entryName, extension) == fileinfo.OtherCategory {
+			entryInfo.MIMEType = sniffContentType(w.fsys, fsEntry, info)
+		}
+
+		read.update(func(list *listing) { list.children = append(list.children, entryInfo) })
+	}
+	return read.result()
+}
+
+// fsName returns the name in the scanned file system of the entry at path
+func (w *walker) fsName(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return "."
+	}
+	return filepath.ToSlash(rel)
+}
+
+// joinName returns the name of an entry of the named directory of an fs.FS
+func joinName(dir, entry string) string {
+	if dir == "." {
+		return entry
+	}
+	return dir + "/" + entry
+}
@@ -0,0 +1,270 @@
+package scan
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// Delay of slowReadDir for reads that never finish on their own
+const hang = time.Duration(-1)
+
+// isolateScans keeps the results and history of the test's scans in
+// temporary directories
+func isolateScans(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("TMPDIR", t.TempDir())
+
+	statusMutex.Lock()
+	previous := PreviousScans
+	PreviousScans = nil
+	statusMutex.Unlock()
+	t.Cleanup(func() {
+		statusMutex.Lock()
+		PreviousScans = previous
+		statusMutex.Unlock()
+	})
+}
+
+// slowReadDir fakes a slow filesystem by delaying reads of the directories
+// in delays, by name relative to the scanned root. Reads delayed by hang
+// block until the test ends, like reads on a dead network mount.
+func slowReadDir(t *testing.T, delays map[string]time.Duration) {
+	t.Helper()
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	var hung []chan struct{}
+	readDir = func(fsys fs.FS, name string) ([]fs.DirEntry, error) {
+		delay, ok := delays[name]
+		switch {
+		case delay == hang:
+			finished := make(chan struct{})
+			mutex.Lock()
+			hung = append(hung, finished)
+			mutex.Unlock()
+			defer close(finished)
+			<-release
+		case ok:
+			time.Sleep(delay)
+		}
+		return fs.ReadDir(fsys, name)
+	}
+	// Let abandoned reads finish before restoring the real function
+	t.Cleanup(func() {
+		close(release)
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, finished := range hung {
+			select {
+			case <-finished:
+			case <-time.After(5 * time.Second):
+			}
+		}
+		readDir = fs.ReadDir
+	})
+}
+
+func TestScanDirectory_ReadTimeout(t *testing.T) {
+	isolateScans(t)
+	root := t.TempDir()
+	files := map[string]int{
+		"nfs/dead/lost.bin":  100,
+		"slow/kept.bin":      20,
+		"local/data.bin":     10,
+		"local/deeper/x.bin": 5,
+	}
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dead := filepath.Join(root, "nfs", "dead")
+	slowReadDir(t, map[string]time.Duration{
+		"nfs/dead": hang,
+		"slow":     20 * time.Millisecond,
+	})
+
+	type scanResult struct {
+		tree fileinfo.FileInfo
+		err  error
+	}
+	done := make(chan scanResult, 1)
+	go func() {
+		tree, err := ScanDirectory(root, Options{Workers: 2, ReadTimeout: 200 * time.Millisecond})
+		done <- scanResult{tree, err}
+	}()
+
+	var tree fileinfo.FileInfo
+	select {
+	case result := <-done:
+		if result.err != nil {
+			t.Fatalf("ScanDirectory() error = %v", result.err)
+		}
+		tree = result.tree
+	case <-time.After(10 * time.Second):
+		t.Fatal("Scan didn't move on from the hung directory")
+	}
+
+	if tree.Size != 35 || !tree.Incomplete {
+		t.Errorf("Root size %d, incomplete %v, want 35, true", tree.Size, tree.Incomplete)
+	}
+	nfs := fileinfo.FindNode(&tree, filepath.Join(root, "nfs"))
+	deadNode := fileinfo.FindNode(&tree, dead)
+	if nfs == nil || deadNode == nil {
+		t.Fatalf("Timed out directory missing from the tree")
+	}
+	if !deadNode.TimedOut || !deadNode.Incomplete || len(deadNode.Children) != 0 {
+		t.Errorf("Hung directory = %+v, want timed out without children", *deadNode)
+	}
+	if nfs.TimedOut || !nfs.Incomplete {
+		t.Errorf("Parent of hung directory timed out %v, incomplete %v, want false, true",
+			nfs.TimedOut, nfs.Incomplete)
+	}
+	for _, name := range []string{"slow", "local"} {
+		if node := fileinfo.FindNode(&tree, filepath.Join(root, name)); node == nil || node.TimedOut || node.Incomplete {
+			t.Errorf("Directory %s should be read completely, got %+v", name, node)
+		}
+	}
+	if len(tree.Errors) != 1 || tree.Errors[0].Path != dead ||
+		!strings.HasPrefix(tree.Errors[0].Message, "timed out after") {
+		t.Errorf("Errors = %+v, want the timeout of %s", tree.Errors, dead)
+	}
+}
+
+// hangingFS is a file system whose listing or opening of one entry blocks
+// until release is closed
+type hangingFS struct {
+	fs.FS
+	hung    string
+	release chan struct{}
+}
+
+func (f hangingFS) Open(name string) (fs.File, error) {
+	if name == f.hung {
+		<-f.release
+	}
+	return f.FS.Open(name)
+}
+
+func (f hangingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == f.hung {
+		<-f.release
+	}
+	return fs.ReadDir(f.FS, name)
+}
+
+func TestCountFiles_ReadTimeout(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"dead/lost.bin", "local/a.bin", "local/b.bin"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := hangingFS{FS: os.DirFS(root), hung: "dead", release: make(chan struct{})}
+	t.Cleanup(func() { close(fsys.release) })
+
+	done := make(chan struct{})
+	go func() {
+		countFiles(fsys, root, Options{ReadTimeout: 50 * time.Millisecond}, make(chan struct{}))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Count didn't move on from the hung directory")
+	}
+
+	// The root, both directories and the two readable files
+	if total := GetScanStatus().TotalItems; total != 5 {
+		t.Errorf("TotalItems = %d, want 5", total)
+	}
+}
+
+// slowEntriesFS is a file system whose directory entries take delay to stat,
+// except hung, which blocks until release is closed
+type slowEntriesFS struct {
+	fs.FS
+	delay   time.Duration
+	hung    string
+	release chan struct{}
+}
+
+func (f slowEntriesFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.FS, name)
+	for i, entry := range entries {
+		entries[i] = slowEntry{DirEntry: entry, fsys: f}
+	}
+	return entries, err
+}
+
+// slowEntry is a directory entry of a slowEntriesFS
+type slowEntry struct {
+	fs.DirEntry
+	fsys slowEntriesFS
+}
+
+func (e slowEntry) Info() (fs.FileInfo, error) {
+	if e.Name() == e.fsys.hung {
+		<-e.fsys.release
+	}
+	time.Sleep(e.fsys.delay)
+	return e.DirEntry.Info()
+}
+
+func TestScanFS_SlowLargeDirectory(t *testing.T) {
+	isolateScans(t)
+	files := fstest.MapFS{}
+	for i := 0; i < 40; i++ {
+		files[fmt.Sprintf("big/file-%02d", i)] = &fstest.MapFile{Data: make([]byte, 10)}
+	}
+
+	tests := []struct {
+		name     string
+		hung     string
+		files    int
+		timedOut bool
+	}{
+		// Each entry is quick but the whole directory takes several timeouts
+		{"slow but progressing", "", 40, false},
+		// Entries read before the read blocks are kept
+		{"blocked partway", "file-30", 30, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := slowEntriesFS{FS: files, delay: 5 * time.Millisecond, hung: test.hung, release: make(chan struct{})}
+			t.Cleanup(func() { close(fsys.release) })
+
+			root, err := ScanFS(fsys, "/fixture", Options{ReadTimeout: 50 * time.Millisecond})
+			if err != nil {
+				t.Fatalf("ScanFS() error = %v", err)
+			}
+			big := fileinfo.FindNode(&root, filepath.Join(normalizePath("/fixture"), "big"))
+			if big == nil {
+				t.Fatal("Directory missing from the tree")
+			}
+			if len(big.Children) != test.files || big.TimedOut != test.timedOut || big.Incomplete != test.timedOut {
+				t.Errorf("Directory has %d children, timed out %v, incomplete %v, want %d, %v, %v",
+					len(big.Children), big.TimedOut, big.Incomplete, test.files, test.timedOut, test.timedOut)
+			}
+		})
+	}
+}
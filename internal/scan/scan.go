@@ -1,8 +1,11 @@
 package scan
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -15,15 +18,64 @@ import (
 	"github.com/steezeburger/storage-shower/internal/logger"
 )
 
-// Maximum number of previous scans to store
+// Default number of previous scans to keep per root
 const MaxPreviousScans = 10
 
+// DefaultWorkers is the number of directories read concurrently when Options
+// doesn't specify a worker count
+const DefaultWorkers = 4
+
+// Options controls how a scan walks the filesystem
+type Options struct {
+	// Skip files and directories whose name starts with a dot
+	IgnoreHidden bool
+	// Collect files matching this term into the scan status
+	SearchTerm string
+	// Glob patterns of entries to skip. Patterns containing a path
+	// separator are matched against the full path, others against the name.
+	Excludes []string
+	// Maximum number of directories read concurrently
+	Workers int
+	// Read the first bytes of files the name doesn't classify to detect
+	// their type from the content
+	SniffContent bool
+	// List the members of zip and tar archives as their children
+	ExpandArchives bool
+	// Read the root as a container image, an OCI image layout directory or
+	// a docker save tarball, and scan the file system its layers build
+	Image bool
+	// Read the root as a git repository and size the objects of its
+	// history by the paths that introduced them
+	GitHistory bool
+	// Time without progress before the scan counts as stalled; 30 seconds
+	// if zero
+	StallThreshold time.Duration
+	// Time reading a directory may go without progress before the scan
+	// gives up on it and marks it as timed out, e.g. on a dead network
+	// mount; no limit if zero
+	ReadTimeout time.Duration
+	// Only return the result, without saving it or recording it in the
+	// history, for agents uploading results to a server
+	Unsaved bool
+}
+
 // ScanRecord represents a record of a previous scan
 type ScanRecord struct {
 	Path      string    `json:"path"`
 	Timestamp time.Time `json:"timestamp"`
 	ResultID  string    `json:"resultId"`
 	Size      int64     `json:"size"`
+	// How long the scan took in seconds, how many items it read and how
+	// many of them it couldn't read
+	Duration float64 `json:"duration,omitempty"`
+	Items    int     `json:"items,omitempty"`
+	Errors   int     `json:"errors,omitempty"`
+	// Pinned scans are never removed by retention
+	Pinned bool   `json:"pinned,omitempty"`
+	Label  string `json:"label,omitempty"`
+	// Machine an agent scanned and uploaded the result from; empty for
+	// scans run by this process
+	Host string `json:"host,omitempty"`
 }
 
 // SearchResult represents a file that matches the search criteria
@@ -41,9 +93,18 @@ type ScanStatus struct {
 	ScannedItems  int            `json:"scannedItems"`
 	TotalItems    int            `json:"totalItems"`
 	Progress      float64        `json:"progress"`
+	BytesScanned  int64          `json:"bytesScanned"`
+	StartedAt     time.Time      `json:"startedAt"`
+	ItemsPerSec   float64        `json:"itemsPerSec"`
+	BytesPerSec   float64        `json:"bytesPerSec"`
 	Stalled       bool           `json:"stalled,omitempty"`
+	Errors        int            `json:"errors,omitempty"`
 	SearchTerm    string         `json:"searchTerm,omitempty"`
 	SearchResults []SearchResult `json:"searchResults,omitempty"`
+
+	// Directory the stalled scan is waiting on and for how many seconds
+	StalledPath string  `json:"stalledPath,omitempty"`
+	StalledFor  float64 `json:"stalledFor,omitempty"`
 }
 
 // Shared variables
@@ -62,56 +123,92 @@ var (
 	// Channel to signal scan cancellation
 	cancelScan chan struct{}
 
+	// Whether cancelScan has been closed for the current scan
+	scanCanceled bool
+
+	// Whether TryBeginScan reserved the scanner for the next ScanDirectory call
+	scanReserved bool
+
 	// Debug flag to control verbose logging
 	DebugMode bool
 
-	// To track stalled scans
-	lastScannedItems int
-	lastProgressTime time.Time
+	// Walker of the scan in progress, for skipping blocked directories
+	activeWalker *walker
 
 	// Current result path
 	resultPath string
+
+	// Number of previous scans kept per root without a retention policy
+	historyRetention = MaxPreviousScans
 )
 
+// walker holds the state shared by the goroutines of one recursive scan
+type walker struct {
+	// File system being scanned and the path its root is reported at
+	fsys fs.FS
+	root string
+
+	opts Options
+
+	// Closed when the scan is canceled; kept here since blocked reads can
+	// outlive the scan and the next one replaces cancelScan
+	cancel <-chan struct{}
+
+	// Map to track directories by path
+	dirMap      map[string]*fileinfo.FileInfo
+	dirMapMutex sync.Mutex
+
+	// Tokens for goroutines scanning subdirectories in parallel
+	workers chan struct{}
+
+	// Entries that couldn't be read, up to fileinfo.MaxScanErrors
+	errors      []fileinfo.ScanError
+	errorsMutex sync.Mutex
+
+	// Directories being read, by path
+	active      map[string]*activeRead
+	activeMutex sync.Mutex
+
+	// Entries read so far, counted as progress by the stall watchdog
+	entriesRead int64
+}
+
 // ScanDirectory scans a directory and returns file information
-func ScanDirectory(rootPath string, ignoreHidden bool, searchTerm string) (fileinfo.FileInfo, error) {
-	log.Printf("Beginning directory scan of: %s", rootPath)
-	// Use filepath.Clean to normalize the path
-	rootPath = filepath.Clean(rootPath)
-	// Convert to absolute path to ensure consistency
-	absPath, err := filepath.Abs(rootPath)
-	if err == nil {
-		rootPath = absPath
+func ScanDirectory(rootPath string, opts Options) (fileinfo.FileInfo, error) {
+	if opts.Image && opts.GitHistory {
+		return fileinfo.FileInfo{}, fmt.Errorf("cannot scan a path as both a container image and a git repository")
+	}
+	if opts.Image {
+		return scanImage(rootPath, opts)
 	}
+	if opts.GitHistory {
+		return scanGitHistory(rootPath, opts)
+	}
+	return ScanFS(newDirFS(normalizePath(rootPath)), rootPath, opts)
+}
+
+// ScanFS scans the file system fsys like ScanDirectory scans a directory,
+// reporting its entries below rootPath, so in-memory fixtures, archives and
+// other virtual file systems go through the same code. Symbolic link
+// targets are read if fsys has a ReadLink(name) method, and file infos
+// implementing StatInfo add inodes, blocks, owners and times.
+func ScanFS(fsys fs.FS, rootPath string, opts Options) (fileinfo.FileInfo, error) {
+	log.Printf("Beginning directory scan of: %s", rootPath)
+	rootPath = normalizePath(rootPath)
 	log.Printf("Normalized path: %s", rootPath)
+	beginScan(rootPath, opts.SearchTerm)
 
-	// Initialize scan status
 	statusMutex.Lock()
-	scanStatus = ScanStatus{
-		InProgress:    true,
-		CurrentPath:   rootPath,
-		ScannedItems:  0,
-		TotalItems:    1, // Start with at least 1 to avoid division by zero
-		Progress:      0.0,
-		SearchTerm:    searchTerm,
-		SearchResults: make([]SearchResult, 0),
-	}
-	lastScannedItems = 0
-	lastProgressTime = time.Now()
+	cancel := cancelScan
 	statusMutex.Unlock()
 
-	// Create a new cancel channel
-	cancelScan = make(chan struct{})
-
 	// Start counting files in a separate goroutine
-	go countFiles(rootPath, ignoreHidden)
+	go countFiles(fsys, rootPath, opts, cancel)
 
 	// Get basic info about the root directory
-	fileInfo, err := os.Stat(rootPath)
+	fileInfo, err := fs.Stat(fsys, ".")
 	if err != nil {
-		statusMutex.Lock()
-		scanStatus.InProgress = false
-		statusMutex.Unlock()
+		failScan()
 		return fileinfo.FileInfo{}, fmt.Errorf("failed to access path: %v", err)
 	}
 
@@ -122,13 +219,47 @@ func ScanDirectory(rootPath string, ignoreHidden bool, searchTerm string) (filei
 		IsDir: fileInfo.IsDir(),
 		Size:  fileInfo.Size(),
 	}
+	recordStat(fsys, ".", &root, fileInfo)
 
-	// Map to track directories by path
-	dirMap := make(map[string]*fileinfo.FileInfo)
-	dirMap[rootPath] = &root
+	// The calling goroutine counts as the first worker
+	workers := opts.Workers
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+	w := &walker{
+		fsys:    fsys,
+		root:    rootPath,
+		opts:    opts,
+		dirMap:  make(map[string]*fileinfo.FileInfo),
+		workers: make(chan struct{}, workers-1),
+		active:  make(map[string]*activeRead),
+	}
+	w.dirMap[rootPath] = &root
+	dirMap := w.dirMap
+
+	statusMutex.Lock()
+	w.cancel = cancelScan
+	activeWalker = w
+	statusMutex.Unlock()
+	stopWatchdog := make(chan struct{})
+	watchdogDone := make(chan struct{})
+	go func() {
+		defer close(watchdogDone)
+		w.watchStalls(stopWatchdog)
+	}()
 
 	// Scan the directory structure recursively
-	err = scanRecursive(rootPath, &root, dirMap, ignoreHidden, searchTerm)
+	err = w.scanRecursive(rootPath, &root)
+
+	// Wait for the watchdog so it can't mark the finished scan as stalled
+	close(stopWatchdog)
+	<-watchdogDone
+	statusMutex.Lock()
+	activeWalker = nil
+	scanStatus.Stalled = false
+	scanStatus.StalledPath = ""
+	scanStatus.StalledFor = 0
+	statusMutex.Unlock()
 
 	// Check if scan was canceled
 	if err != nil && err.Error() == "scan canceled" {
@@ -136,10 +267,7 @@ func ScanDirectory(rootPath string, ignoreHidden bool, searchTerm string) (filei
 		// Still save the partial result
 		err = nil
 	} else if err != nil {
-		// On error, update status and return
-		statusMutex.Lock()
-		scanStatus.InProgress = false
-		statusMutex.Unlock()
+		failScan()
 		return fileinfo.FileInfo{}, err
 	}
 
@@ -149,108 +277,230 @@ func ScanDirectory(rootPath string, ignoreHidden bool, searchTerm string) (filei
 	}
 	debugLogger := logger.NewDebugLogger(DebugMode)
 	fileinfo.FixDirectorySizes(&root, dirMap, debugLogger)
+	if img, ok := fsys.(imageFS); ok {
+		info := img.Info()
+		root.Image = &info
+	}
+
+	// Attach the errors, estimating what they hid from the previous scan
+	statusMutex.Lock()
+	root.ErrorCount = scanStatus.Errors
+	statusMutex.Unlock()
+	if len(w.errors) > 0 {
+		root.Errors = w.errors
+		if previous, ok := latestResult(rootPath); ok {
+			root.MissingBytes = fileinfo.EstimateMissingBytes(root.Errors, &previous)
+		}
+	}
+
+	finishScan(&root, opts)
+	return root, nil
+}
 
+// beginScan marks a scan of rootPath as in progress
+func beginScan(rootPath, searchTerm string) {
+	statusMutex.Lock()
+	scanStatus = ScanStatus{
+		InProgress:    true,
+		CurrentPath:   rootPath,
+		ScannedItems:  0,
+		TotalItems:    1, // Start with at least 1 to avoid division by zero
+		Progress:      0.0,
+		StartedAt:     time.Now(),
+		SearchTerm:    searchTerm,
+		SearchResults: make([]SearchResult, 0),
+	}
+
+	// Create a new cancel channel unless TryBeginScan already did, so a
+	// cancellation requested in between isn't lost
+	if !scanReserved {
+		cancelScan = make(chan struct{})
+		scanCanceled = false
+	}
+	scanReserved = false
+	statusMutex.Unlock()
+	notifyStatusChange()
+}
+
+// failScan counts the scan in progress as failed and ends it
+func failScan() {
+	statusMutex.Lock()
+	counters.ScansFailed++
+	scanStatus.InProgress = false
+	scanReserved = false
+	statusMutex.Unlock()
+	notifyStatusChange()
+}
+
+// writeResult trims a scan result and saves it to a temporary file, whose
+// name becomes the result ID. It returns the ID and the size of the file.
+func writeResult(root *fileinfo.FileInfo) (string, int, error) {
 	// Trim the tree to reduce size before saving
-	trimmedRoot := trimTreeForStorage(&root, 0)
+	trimmedRoot := trimTreeForStorage(root, 0)
 
-	// Save result to a temporary file
 	resultJSON, err := json.Marshal(trimmedRoot)
 	if err != nil {
-		log.Printf("Error marshaling result: %v", err)
-		statusMutex.Lock()
-		scanStatus.InProgress = false
-		statusMutex.Unlock()
-		return root, nil
+		return "", 0, fmt.Errorf("error marshaling result: %v", err)
 	}
 
-	tempFile, err := os.CreateTemp("", "storage-shower-*.json")
+	tempFile, err := os.CreateTemp("", resultFilePattern)
 	if err != nil {
-		log.Printf("Error creating temp file: %v", err)
-		statusMutex.Lock()
-		scanStatus.InProgress = false
-		statusMutex.Unlock()
-		return root, nil
+		return "", 0, fmt.Errorf("error creating temp file: %v", err)
 	}
 
 	_, err = tempFile.Write(resultJSON)
+	tempFile.Close()
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", 0, fmt.Errorf("error writing to temp file: %v", err)
+	}
+	return filepath.Base(tempFile.Name()), len(resultJSON), nil
+}
+
+// finishScan ends the scan in progress, saving its result unless opts say
+// otherwise
+func finishScan(root *fileinfo.FileInfo, opts Options) {
+	if !opts.Unsaved {
+		saveResult(root)
+		return
+	}
+
+	statusMutex.Lock()
+	counters.ScansCompleted++
+	scanStatus.InProgress = false
+	statusMutex.Unlock()
+	notifyStatusChange()
+	log.Printf("Scan completed successfully for path: %s", root.Path)
+}
+
+// saveResult saves the result of the scan in progress to a temporary file,
+// records it in the history and ends the scan
+func saveResult(root *fileinfo.FileInfo) {
+	resultID, resultSize, err := writeResult(root)
 	if err != nil {
-		log.Printf("Error writing to temp file: %v", err)
-		tempFile.Close()
+		log.Printf("Error saving result: %v", err)
 		statusMutex.Lock()
 		scanStatus.InProgress = false
 		statusMutex.Unlock()
-		return root, nil
+		notifyStatusChange()
+		return
 	}
 
-	tempFile.Close()
-
-	// Generate a unique ID for this scan result
-	resultID := filepath.Base(tempFile.Name())
-
 	// Record this scan
+	statusMutex.Lock()
 	newScan := ScanRecord{
-		Path:      rootPath,
+		Path:      root.Path,
 		Timestamp: time.Now(),
 		ResultID:  resultID,
 		Size:      root.Size,
+		Duration:  time.Since(scanStatus.StartedAt).Seconds(),
+		Items:     scanStatus.ScannedItems,
+		Errors:    scanStatus.Errors,
 	}
+	counters.ScansCompleted++
 
 	// Update global variables
-	statusMutex.Lock()
-	resultPath = tempFile.Name()
+	resultPath = resultFile(resultID)
 	PreviousScans = append([]ScanRecord{newScan}, PreviousScans...)
-	if len(PreviousScans) > MaxPreviousScans {
-		PreviousScans = PreviousScans[:MaxPreviousScans]
-	}
+	expired := pruneHistory()
 	scanStatus.InProgress = false
 	statusMutex.Unlock()
+	notifyStatusChange()
+	removeResultFiles(expired)
 
 	// Save previous scans to persistent storage
 	SavePreviousScans()
 
-	log.Printf("Scan completed successfully for path: %s", rootPath)
-	log.Printf("Scan result saved to %s (%s)", tempFile.Name(), fileinfo.FormatBytes(int64(len(resultJSON))))
-
-	return root, nil
+	log.Printf("Scan completed successfully for path: %s", root.Path)
+	log.Printf("Scan result saved to %s (%s)", resultPath, fileinfo.FormatBytes(int64(resultSize)))
 }
 
-// countFiles counts files in a directory to provide progress information
-func countFiles(rootPath string, ignoreHidden bool) {
-	log.Printf("Starting file count for: %s", rootPath)
-	var count int
+// StoreResult adds the result of a scan an agent ran on another machine to
+// the history under record.Host, keeping the scan's own timestamp and
+// counts. It returns the record as stored, with the ID of the result.
+func StoreResult(root fileinfo.FileInfo, record ScanRecord) (ScanRecord, error) {
+	if record.Host == "" {
+		return ScanRecord{}, fmt.Errorf("scan result has no host")
+	}
+	resultID, resultSize, err := writeResult(&root)
+	if err != nil {
+		return ScanRecord{}, err
+	}
 
-	filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip items we can't access
-		}
+	record.Path = root.Path
+	record.Size = root.Size
+	record.ResultID = resultID
+	record.Pinned = false
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
 
-		// Check if we should cancel
-		select {
-		case <-cancelScan:
-			return filepath.SkipAll
-		default:
-			// Continue with scan
+	// Keep the history newest first even when uploads arrive late
+	statusMutex.Lock()
+	i := sort.Search(len(PreviousScans), func(i int) bool {
+		return !PreviousScans[i].Timestamp.After(record.Timestamp)
+	})
+	// Build a new slice rather than shifting records within the old one
+	scans := make([]ScanRecord, 0, len(PreviousScans)+1)
+	scans = append(scans, PreviousScans[:i]...)
+	scans = append(scans, record)
+	scans = append(scans, PreviousScans[i:]...)
+	PreviousScans = scans
+	expired := pruneHistory()
+	statusMutex.Unlock()
+	removeResultFiles(expired)
+
+	SavePreviousScans()
+
+	log.Printf("Stored scan of %s:%s (%s)", record.Host, record.Path, fileinfo.FormatBytes(int64(resultSize)))
+	return record, nil
+}
+
+// countFiles counts files in a file system to provide progress information.
+// Directories whose listing takes longer than the read timeout aren't
+// counted, so a blocked directory can't hold up the count.
+func countFiles(fsys fs.FS, rootPath string, opts Options, cancel <-chan struct{}) {
+	log.Printf("Starting file count for: %s", rootPath)
+	// Include the root itself
+	count := 1
+
+	var walk func(name string) bool
+	walk = func(name string) bool {
+		entries, ok := listWithin(fsys, name, opts.ReadTimeout, cancel)
+		if !ok {
+			return false
 		}
+		for _, entry := range entries {
+			// Check if we should cancel
+			select {
+			case <-cancel:
+				return false
+			default:
+				// Continue with count
+			}
 
-		if ignoreHidden && fileinfo.IsHidden(path) {
-			if info.IsDir() {
-				return filepath.SkipDir
+			entryName := joinName(name, entry.Name())
+			if shouldSkip(filepath.Join(rootPath, filepath.FromSlash(entryName)), opts) {
+				continue
 			}
-			return nil
-		}
 
-		count++
+			count++
 
-		if count%1000 == 0 {
-			log.Printf("Counted %d files so far...", count)
-		}
+			if count%1000 == 0 {
+				log.Printf("Counted %d files so far...", count)
+			}
 
-		statusMutex.Lock()
-		scanStatus.TotalItems = count
-		statusMutex.Unlock()
+			statusMutex.Lock()
+			scanStatus.TotalItems = count
+			statusMutex.Unlock()
 
-		return nil
-	})
+			if entry.IsDir() && !walk(entryName) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(".")
 
 	log.Printf("File count completed: %d total items found", count)
 	statusMutex.Lock()
@@ -261,11 +511,44 @@ func countFiles(rootPath string, ignoreHidden bool) {
 	statusMutex.Unlock()
 }
 
+// normalizePath cleans a path and makes it absolute so scans of the same
+// directory are recorded under the same root
+func normalizePath(path string) string {
+	path = filepath.Clean(path)
+	if absPath, err := filepath.Abs(path); err == nil {
+		return absPath
+	}
+	return path
+}
+
+// shouldSkip reports whether an entry is hidden or excluded by the options
+func shouldSkip(path string, opts Options) bool {
+	if opts.IgnoreHidden && fileinfo.IsHidden(path) {
+		return true
+	}
+	return isExcluded(path, opts.Excludes)
+}
+
+// isExcluded reports whether path matches any of the exclude patterns
+func isExcluded(path string, excludes []string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range excludes {
+		target := name
+		if strings.ContainsRune(pattern, filepath.Separator) {
+			target = path
+		}
+		if matched, _ := filepath.Match(pattern, target); matched {
+			return true
+		}
+	}
+	return false
+}
+
 // scanRecursive recursively scans a directory
-func scanRecursive(path string, dir *fileinfo.FileInfo, dirMap map[string]*fileinfo.FileInfo, ignoreHidden bool, searchTerm string) error {
+func (w *walker) scanRecursive(path string, dir *fileinfo.FileInfo) error {
 	// Check for cancellation
 	select {
-	case <-cancelScan:
+	case <-w.cancel:
 		return fmt.Errorf("scan canceled")
 	default:
 		// Continue with scan
@@ -281,108 +564,132 @@ func scanRecursive(path string, dir *fileinfo.FileInfo, dirMap map[string]*filei
 		scanStatus.Progress = 0.0
 	}
 
-	// Check for stalled scan
-	if scanStatus.ScannedItems > 0 {
-		if scanStatus.ScannedItems > lastScannedItems {
-			// Progress is being made, update the last known state
-			lastScannedItems = scanStatus.ScannedItems
-			lastProgressTime = time.Now()
-			scanStatus.Stalled = false
-		} else if time.Since(lastProgressTime) > 30*time.Second {
-			// No progress for 30 seconds, consider scan stalled
-			log.Printf("Scan appears stalled - no progress for 30 seconds")
-			scanStatus.Stalled = true
-		}
-	}
 	statusMutex.Unlock()
+	notifyStatusChange()
 
 	// Only read the directory if it's a directory
 	if !dir.IsDir {
 		return nil
 	}
 
-	// Read directory contents
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		log.Printf("Warning: Cannot read directory %s: %v", path, err)
-		return nil
+	// Read the directory in a helper goroutine so a blocked read can be
+	// skipped
+	list, ok := w.readDirectory(path)
+	if !ok {
+		// Keep the entries read before the read was abandoned
+		dir.TimedOut = list.timedOut
+	}
+	if list.err != nil {
+		w.recordError(dir, path, "readdir", list.err)
+	}
+	for _, entryErr := range list.errors {
+		w.recordError(dir, entryErr.path, entryErr.op, entryErr.err)
 	}
 
-	// Process each entry in the directory
-	for _, entry := range entries {
-		// Check for cancellation again
-		select {
-		case <-cancelScan:
-			return fmt.Errorf("scan canceled")
-		default:
-			// Continue with scan
+	for _, entryInfo := range list.children {
+		if entryInfo.IsDir {
+			continue
 		}
 
-		entryName := entry.Name()
-		entryPath := filepath.Join(path, entryName)
+		// Count file bytes towards scan throughput
+		statusMutex.Lock()
+		scanStatus.BytesScanned += entryInfo.Size
+		statusMutex.Unlock()
 
-		// Skip hidden files/directories if requested
-		if ignoreHidden && fileinfo.IsHidden(entryPath) {
-			continue
+		// Check if file matches search term (if search term is provided)
+		if w.opts.SearchTerm != "" && matchesSearchTerm(entryInfo, w.opts.SearchTerm) {
+			statusMutex.Lock()
+			scanStatus.SearchResults = append(scanStatus.SearchResults, SearchResult{
+				Path:      entryInfo.Path,
+				Name:      entryInfo.Name,
+				Size:      entryInfo.Size,
+				Extension: entryInfo.Extension,
+			})
+			statusMutex.Unlock()
 		}
+	}
 
-		// Get file info
-		info, err := entry.Info()
-		if err != nil {
-			log.Printf("Warning: Cannot get info for %s: %v", entryPath, err)
-			continue
-		}
+	// Store all entries before descending so pointers into dir.Children
+	// stay valid while subdirectories are scanned
+	dir.Children = list.children
+	if list.canceled {
+		return fmt.Errorf("scan canceled")
+	}
 
-		// Extract extension for files
-		extension := ""
-		if !info.IsDir() {
-			if ext := filepath.Ext(entryPath); ext != "" {
-				extension = ext[1:] // Remove the leading dot
+	// List archives after the directory read, each in a timed read of its
+	// own since decompressing a large tarball can take minutes
+	if w.opts.ExpandArchives {
+		for i := range dir.Children {
+			if !dir.Children[i].IsDir && dir.Children[i].Mode.IsRegular() {
+				w.expandArchive(&dir.Children[i])
 			}
 		}
+	}
 
-		// Create file info for this entry
-		fileSize := info.Size()
-		entryInfo := fileinfo.FileInfo{
-			Name:      entryName,
-			Path:      entryPath,
-			Size:      fileSize,
-			IsDir:     entry.IsDir(),
-			Extension: extension,
+	// Recursively scan subdirectories, handing them to idle workers when
+	// available and scanning inline otherwise
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var firstErr error
+	setErr := func(err error) {
+		errMutex.Lock()
+		if firstErr == nil {
+			firstErr = err
 		}
+		errMutex.Unlock()
+	}
 
-		// Add to parent's children
-		dir.Children = append(dir.Children, entryInfo)
-
-		// Check if file matches search term (if search term is provided)
-		if searchTerm != "" && !entry.IsDir() {
-			if matchesSearchTerm(entryInfo, searchTerm) {
-				statusMutex.Lock()
-				scanStatus.SearchResults = append(scanStatus.SearchResults, SearchResult{
-					Path:      entryPath,
-					Name:      entryName,
-					Size:      fileSize,
-					Extension: extension,
-				})
-				statusMutex.Unlock()
-			}
+	for i := range dir.Children {
+		if !dir.Children[i].IsDir {
+			continue
 		}
 
-		// If it's a directory, add to dirMap and recursively scan
-		if entry.IsDir() {
-			// Store a reference to the directory in the map
-			dirIndex := len(dir.Children) - 1
-			dirMap[entryPath] = &dir.Children[dirIndex]
+		// Store a reference to the directory in the map
+		child := &dir.Children[i]
+		w.dirMapMutex.Lock()
+		w.dirMap[child.Path] = child
+		w.dirMapMutex.Unlock()
 
-			// Recursively scan the directory
-			err := scanRecursive(entryPath, &dir.Children[dirIndex], dirMap, ignoreHidden, searchTerm)
-			if err != nil {
-				return err
+		select {
+		case w.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-w.workers }()
+				if err := w.scanRecursive(child.Path, child); err != nil {
+					setErr(err)
+				}
+			}()
+		default:
+			if err := w.scanRecursive(child.Path, child); err != nil {
+				setErr(err)
 			}
 		}
+
+		errMutex.Lock()
+		failed := firstErr != nil
+		errMutex.Unlock()
+		if failed {
+			break
+		}
 	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// recordError records an entry that couldn't be read and marks the
+// directory containing it as incomplete
+func (w *walker) recordError(dir *fileinfo.FileInfo, path, op string, err error) {
+	log.Printf("Warning: Cannot read %s: %v", path, err)
+	dir.Incomplete = true
+	countError()
 
-	return nil
+	w.errorsMutex.Lock()
+	if len(w.errors) < fileinfo.MaxScanErrors {
+		w.errors = append(w.errors, fileinfo.NewScanError(path, op, err))
+	}
+	w.errorsMutex.Unlock()
 }
 
 // GetScanStatus returns the current scan status
@@ -395,9 +702,73 @@ func GetScanStatus() ScanStatus {
 		status.Progress = 0.0
 	}
 	statusMutex.Unlock()
+
+	// Derive throughput from the elapsed time of the running scan
+	if status.InProgress && !status.StartedAt.IsZero() {
+		if elapsed := time.Since(status.StartedAt).Seconds(); elapsed > 0 {
+			status.ItemsPerSec = float64(status.ScannedItems) / elapsed
+			status.BytesPerSec = float64(status.BytesScanned) / elapsed
+		}
+	}
 	return status
 }
 
+// TryBeginScan marks a scan of rootPath as in progress unless one is already
+// running. It returns false if another scan holds the scanner.
+func TryBeginScan(rootPath string) bool {
+	statusMutex.Lock()
+	if scanStatus.InProgress {
+		statusMutex.Unlock()
+		return false
+	}
+	scanStatus = ScanStatus{
+		InProgress:  true,
+		CurrentPath: rootPath,
+		TotalItems:  1,
+		StartedAt:   time.Now(),
+	}
+	cancelScan = make(chan struct{})
+	scanCanceled = false
+	scanReserved = true
+	statusMutex.Unlock()
+	notifyStatusChange()
+	return true
+}
+
+// SetHistoryRetention sets how many previous scans of each root are kept in
+// history unless a retention policy matches the root
+func SetHistoryRetention(n int) {
+	if n < 1 {
+		return
+	}
+	statusMutex.Lock()
+	historyRetention = n
+	statusMutex.Unlock()
+}
+
+// WaitForScan blocks until no scan is in progress or ctx is done
+func WaitForScan(ctx context.Context) error {
+	updates, unsubscribe := SubscribeStatus()
+	defer unsubscribe()
+
+	for {
+		if !GetScanStatus().InProgress {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updates:
+		}
+	}
+}
+
+// TrimResult returns a scan result trimmed to the depth and detail that
+// stored results keep
+func TrimResult(root *fileinfo.FileInfo) fileinfo.FileInfo {
+	return trimTreeForStorage(root, 0)
+}
+
 // trimTreeForStorage reduces the size of the directory tree by limiting depth
 // and trimming nodes with small sizes
 func trimTreeForStorage(node *fileinfo.FileInfo, depth int) fileinfo.FileInfo {
@@ -454,16 +825,18 @@ func trimTreeForStorage(node *fileinfo.FileInfo, depth int) fileinfo.FileInfo {
 // CancelScan cancels any scan in progress
 func CancelScan() string {
 	statusMutex.Lock()
-	inProgress := scanStatus.InProgress
-	statusMutex.Unlock()
+	defer statusMutex.Unlock()
 
-	if inProgress {
-		// Signal cancellation
-		close(cancelScan)
-		return "stopping"
+	if !scanStatus.InProgress {
+		return "not_running"
 	}
 
-	return "not_running"
+	// Signal cancellation, guarding against repeated stop requests
+	if !scanCanceled {
+		close(cancelScan)
+		scanCanceled = true
+	}
+	return "stopping"
 }
 
 // GetLatestScanResult returns the most recent scan result
@@ -511,8 +884,7 @@ func GetScanResultByID(resultID string) (fileinfo.FileInfo, error) {
 		return fileinfo.FileInfo{}, fmt.Errorf("scan result with ID %s not found", resultID)
 	}
 
-	// Extract the full path from the ResultID
-	resultPath := filepath.Join(os.TempDir(), resultID)
+	resultPath := resultFile(resultID)
 
 	// Read the result file
 	data, err := os.ReadFile(resultPath)
@@ -529,6 +901,45 @@ func GetScanResultByID(resultID string) (fileinfo.FileInfo, error) {
 	return result, nil
 }
 
+// latestResult returns the newest stored result of a scan of rootPath
+func latestResult(rootPath string) (fileinfo.FileInfo, bool) {
+	for _, record := range History() {
+		if record.Path != rootPath || record.Host != "" {
+			continue
+		}
+		result, err := GetScanResultByID(record.ResultID)
+		if err != nil {
+			log.Printf("Warning: Cannot load scan result %s: %v", record.ResultID, err)
+			return fileinfo.FileInfo{}, false
+		}
+		return result, true
+	}
+	return fileinfo.FileInfo{}, false
+}
+
+// OldestScanSince returns the oldest stored result of a scan of rootPath
+// that finished in the window [since, before)
+func OldestScanSince(rootPath string, since, before time.Time) (fileinfo.FileInfo, ScanRecord, bool) {
+	statusMutex.Lock()
+	scans := PreviousScans
+	statusMutex.Unlock()
+
+	// Scans are stored newest first
+	for i := len(scans) - 1; i >= 0; i-- {
+		record := scans[i]
+		if record.Path != rootPath || record.Host != "" || record.Timestamp.Before(since) || !record.Timestamp.Before(before) {
+			continue
+		}
+		result, err := GetScanResultByID(record.ResultID)
+		if err != nil {
+			log.Printf("Warning: Cannot load scan result %s: %v", record.ResultID, err)
+			continue
+		}
+		return result, record, true
+	}
+	return fileinfo.FileInfo{}, ScanRecord{}, false
+}
+
 // SavePreviousScans saves the list of previous scans to a file
 func SavePreviousScans() {
 	// Get user's home directory
@@ -546,7 +957,7 @@ func SavePreviousScans() {
 	}
 
 	// Save to file
-	scansFile := filepath.Join(configDir, "previous-scans.json")
+	scansFile := historyFile(homeDir)
 
 	statusMutex.Lock()
 	data, err := json.MarshalIndent(PreviousScans, "", "  ")
@@ -562,6 +973,37 @@ func SavePreviousScans() {
 	}
 }
 
+// historyFile returns the location of the saved history in homeDir
+func historyFile(homeDir string) string {
+	return filepath.Join(homeDir, ".storage-shower", "previous-scans.json")
+}
+
+// readSavedHistory returns the scans of the saved history and when it was
+// last written, or no scans and the zero time if it doesn't exist
+func readSavedHistory() ([]ScanRecord, time.Time, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("cannot get home directory: %v", err)
+	}
+	path := historyFile(homeDir)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var scans []ScanRecord
+	if err := json.Unmarshal(data, &scans); err != nil {
+		return nil, time.Time{}, fmt.Errorf("cannot parse scan history: %v", err)
+	}
+	return scans, info.ModTime(), nil
+}
+
 // LoadPreviousScans loads the list of previous scans from a file
 func LoadPreviousScans() {
 	// Get user's home directory
@@ -572,8 +1014,7 @@ func LoadPreviousScans() {
 	}
 
 	// Check if file exists
-	scansFile := filepath.Join(homeDir, ".storage-shower", "previous-scans.json")
-	data, err := os.ReadFile(scansFile)
+	data, err := os.ReadFile(historyFile(homeDir))
 	if err != nil {
 		// This is not an error, file might not exist yet
 		return
@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// Maximum number of entries kept in the content type cache
+const maxSniffCacheEntries = 200000
+
+// sniffKey identifies file content across scans and hard links
+type sniffKey struct {
+	dev, ino uint64
+	size     int64
+	modTime  time.Time
+}
+
+// Content types detected in previous and current scans
+var (
+	sniffCache      = make(map[sniffKey]string)
+	sniffCacheMutex sync.Mutex
+)
+
+// sniffContentType reads the first bytes of the named file of fsys and
+// returns its detected MIME type. Results are cached by inode, size and
+// modification time, so hard links and unchanged files are only read once.
+func sniffContentType(fsys fs.FS, name string, info fs.FileInfo) string {
+	dev, ino, ok := fileID(info)
+	key := sniffKey{dev: dev, ino: ino, size: info.Size(), modTime: info.ModTime()}
+	if ok {
+		sniffCacheMutex.Lock()
+		mimeType, cached := sniffCache[key]
+		sniffCacheMutex.Unlock()
+		if cached {
+			return mimeType
+		}
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	header := make([]byte, fileinfo.SniffLen)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	mimeType := fileinfo.DetectContentType(header[:n])
+
+	if ok {
+		sniffCacheMutex.Lock()
+		if len(sniffCache) >= maxSniffCacheEntries {
+			sniffCache = make(map[sniffKey]string)
+		}
+		sniffCache[key] = mimeType
+		sniffCacheMutex.Unlock()
+	}
+
+	return mimeType
+}
@@ -0,0 +1,147 @@
+package scan
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/steezeburger/storage-shower/pkg/utils"
+)
+
+// How often the watchdog checks scan progress
+var stallCheckInterval = time.Second
+
+// Default time without progress before a scan counts as stalled
+const defaultStallThreshold = 30 * time.Second
+
+// watchStalls marks the scan as stalled while it makes no progress, with
+// the directory it has been waiting on longest, until stop is closed
+func (w *walker) watchStalls(stop <-chan struct{}) {
+	threshold := w.opts.StallThreshold
+	if threshold <= 0 {
+		threshold = defaultStallThreshold
+	}
+	seconds := int(threshold.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	detector := utils.NewStallDetector()
+	detector.SetStallThreshold(seconds)
+	// A hung mount can block the very first directories
+	detector.SetMinimumItemsForStallCheck(1)
+	if seconds < 10 {
+		detector.SetStartupGracePeriod(seconds)
+	}
+
+	ticker := time.NewTicker(stallCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		statusMutex.Lock()
+		items := scanStatus.ScannedItems
+		statusMutex.Unlock()
+		detector.UpdateActivity(items + int(atomic.LoadInt64(&w.entriesRead)))
+
+		stalled := detector.IsStalled()
+		var blocked *activeRead
+		if stalled {
+			blocked = w.oldestRead()
+		}
+
+		statusMutex.Lock()
+		wasStalled := scanStatus.Stalled
+		scanStatus.Stalled = stalled
+		scanStatus.StalledPath = ""
+		scanStatus.StalledFor = 0
+		if blocked != nil {
+			scanStatus.StalledPath = blocked.path
+			scanStatus.StalledFor = time.Since(blocked.started).Seconds()
+		}
+		if stalled && !wasStalled {
+			counters.Stalls++
+		}
+		statusMutex.Unlock()
+
+		if stalled && !wasStalled {
+			if blocked != nil {
+				log.Printf("Scan appears stalled - waiting on %s for %v",
+					blocked.path, time.Since(blocked.started).Round(time.Second))
+			} else {
+				log.Printf("Scan appears stalled - no progress for %v", threshold)
+			}
+		}
+		if stalled || wasStalled {
+			notifyStatusChange()
+		}
+	}
+}
+
+// oldestRead returns the directory read that has been running longest, or
+// nil if none is
+func (w *walker) oldestRead() *activeRead {
+	w.activeMutex.Lock()
+	defer w.activeMutex.Unlock()
+
+	var oldest *activeRead
+	for _, read := range w.active {
+		if read.skipped {
+			continue
+		}
+		if oldest == nil || read.started.Before(oldest.started) {
+			oldest = read
+		}
+	}
+	return oldest
+}
+
+// skip stops waiting for the read of a directory, or for the one that has
+// been running longest if path is empty
+func (w *walker) skip(path string) (string, error) {
+	var read *activeRead
+	if path == "" {
+		read = w.oldestRead()
+	}
+
+	w.activeMutex.Lock()
+	defer w.activeMutex.Unlock()
+	if path != "" {
+		read = w.active[path]
+	}
+	if read == nil || read.skipped {
+		if path == "" {
+			return "", fmt.Errorf("no directory read in progress")
+		}
+		return "", fmt.Errorf("not reading %s", path)
+	}
+	read.skipped = true
+	close(read.skip)
+	return read.path, nil
+}
+
+// SkipPath makes the scan in progress stop waiting for a directory whose
+// read is blocked, e.g. on a hung network mount, and continue without its
+// contents. An empty path skips the directory the scan has waited on
+// longest. It returns the skipped path.
+func SkipPath(path string) (string, error) {
+	statusMutex.Lock()
+	w := activeWalker
+	statusMutex.Unlock()
+	if w == nil {
+		return "", fmt.Errorf("no scan in progress")
+	}
+
+	skipped, err := w.skip(path)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Skipping %s at the user's request", skipped)
+	return skipped, nil
+}
@@ -0,0 +1,88 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanDirectory_SkipBlockedDirectory(t *testing.T) {
+	isolateScans(t)
+	root := t.TempDir()
+	hung := filepath.Join(root, "mnt")
+	if err := os.Mkdir(hung, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hung, "hidden.bin"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "data.bin"), make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	slowReadDir(t, map[string]time.Duration{"mnt": hang})
+	oldInterval := stallCheckInterval
+	stallCheckInterval = 20 * time.Millisecond
+	defer func() { stallCheckInterval = oldInterval }()
+	stallsBefore := GetCounters().Stalls
+
+	type scanResult struct {
+		size       int64
+		incomplete bool
+		errors     int
+		err        error
+	}
+	done := make(chan scanResult, 1)
+	go func() {
+		result, err := ScanDirectory(root, Options{Workers: 1, StallThreshold: time.Second})
+		done <- scanResult{result.Size, result.Incomplete, len(result.Errors), err}
+	}()
+
+	// Wait for the watchdog to report the blocked directory
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := GetScanStatus()
+		if status.Stalled && status.StalledPath == hung {
+			if status.StalledFor < 1 {
+				t.Errorf("StalledFor = %v, want at least the threshold", status.StalledFor)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Scan not reported stalled on %s, status %+v", hung, status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if stalls := GetCounters().Stalls; stalls != stallsBefore+1 {
+		t.Errorf("Stalls = %d, want %d", stalls, stallsBefore+1)
+	}
+
+	if _, err := SkipPath("/not/being/read"); err == nil {
+		t.Error("SkipPath() of a directory not being read succeeded")
+	}
+	skipped, err := SkipPath("")
+	if err != nil || skipped != hung {
+		t.Fatalf("SkipPath() = %q, %v, want %q", skipped, err, hung)
+	}
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			t.Fatalf("ScanDirectory() error = %v", result.err)
+		}
+		if result.size != 10 || !result.incomplete || result.errors != 1 {
+			t.Errorf("Result size %d, incomplete %v, %d errors, want 10, true, 1",
+				result.size, result.incomplete, result.errors)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Scan didn't continue after skipping the blocked directory")
+	}
+
+	if status := GetScanStatus(); status.Stalled || status.StalledPath != "" {
+		t.Errorf("Stall still reported after the scan finished: %+v", status)
+	}
+	if _, err := SkipPath(""); err == nil {
+		t.Error("SkipPath() without a scan succeeded")
+	}
+}
@@ -0,0 +1,150 @@
+package scan
+
+import (
+	"io/fs"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// Resolved user and group names by ID
+var (
+	userNames      = make(map[uint32]string)
+	groupNames     = make(map[uint32]string)
+	ownerNameMutex sync.Mutex
+)
+
+// userName returns the name of a user, or its ID if it can't be resolved
+func userName(uid uint32) string {
+	ownerNameMutex.Lock()
+	defer ownerNameMutex.Unlock()
+
+	if name, ok := userNames[uid]; ok {
+		return name
+	}
+	id := strconv.FormatUint(uint64(uid), 10)
+	name := id
+	if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+	userNames[uid] = name
+	return name
+}
+
+// groupName returns the name of a group, or its ID if it can't be resolved
+func groupName(gid uint32) string {
+	ownerNameMutex.Lock()
+	defer ownerNameMutex.Unlock()
+
+	if name, ok := groupNames[gid]; ok {
+		return name
+	}
+	id := strconv.FormatUint(uint64(gid), 10)
+	name := id
+	if g, err := user.LookupGroupId(id); err == nil {
+		name = g.Name
+	}
+	groupNames[gid] = name
+	return name
+}
+
+// StatInfo is an optional interface for the fs.FileInfo of the files of a
+// scanned fs.FS. File systems other than the operating system's implement
+// it to report what stat(2) would beyond fs.FileInfo; without it, these
+// are decoded from Sys(), which only works for files of the OS.
+type StatInfo interface {
+	fs.FileInfo
+	// FileID returns the device and inode numbers of the file
+	FileID() (dev, ino uint64, ok bool)
+	// Blocks returns the number of 512-byte blocks allocated to the file
+	Blocks() (blocks int64, ok bool)
+	// Owner returns the user and group IDs owning the file
+	Owner() (uid, gid uint32, ok bool)
+	// Times returns the access and status change times of the file
+	Times() (atime, ctime time.Time, ok bool)
+}
+
+// LayerInfo is an optional interface for the fs.FileInfo of the files of a
+// container image, reporting the layer that wrote the file
+type LayerInfo interface {
+	fs.FileInfo
+	// Layer returns the number of the layer, counting from 1 for the base
+	Layer() int
+}
+
+// readLinkFS is implemented by file systems that can read symbolic links
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// fileID returns the device and inode numbers of a file
+func fileID(info fs.FileInfo) (dev, ino uint64, ok bool) {
+	if stat, isStat := info.(StatInfo); isStat {
+		return stat.FileID()
+	}
+	return sysFileID(info)
+}
+
+// fileBlocks returns the number of 512-byte blocks allocated to a file
+func fileBlocks(info fs.FileInfo) (blocks int64, ok bool) {
+	if stat, isStat := info.(StatInfo); isStat {
+		return stat.Blocks()
+	}
+	return sysFileBlocks(info)
+}
+
+// fileOwner returns the user and group IDs owning a file
+func fileOwner(info fs.FileInfo) (uid, gid uint32, ok bool) {
+	if stat, isStat := info.(StatInfo); isStat {
+		return stat.Owner()
+	}
+	return sysFileOwner(info)
+}
+
+// fileTimes returns the access and status change times of a file
+func fileTimes(info fs.FileInfo) (atime, ctime time.Time, ok bool) {
+	if stat, isStat := info.(StatInfo); isStat {
+		return stat.Times()
+	}
+	return sysFileTimes(info)
+}
+
+// recordStat copies timestamps, ownership, mode bits, disk usage and image
+// layers from info into entry, and resolves symbolic links. name is the
+// entry's name in fsys.
+func recordStat(fsys fs.FS, name string, entry *fileinfo.FileInfo, info fs.FileInfo) {
+	entry.Mode = info.Mode()
+	entry.ModTime = info.ModTime().Unix()
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if linkFS, ok := fsys.(readLinkFS); ok {
+			entry.LinkTarget, _ = linkFS.ReadLink(name)
+		}
+		if _, err := fs.Stat(fsys, name); err != nil {
+			entry.BrokenLink = true
+		}
+	}
+
+	if atime, ctime, ok := fileTimes(info); ok {
+		entry.AccessTime = atime.Unix()
+		entry.ChangeTime = ctime.Unix()
+	}
+
+	if uid, gid, ok := fileOwner(info); ok {
+		entry.UID = uid
+		entry.GID = gid
+		entry.Owner = userName(uid)
+		entry.Group = groupName(gid)
+	}
+
+	if blocks, ok := fileBlocks(info); ok && !info.IsDir() {
+		entry.DiskUsage = blocks * 512
+	}
+
+	if layered, ok := info.(LayerInfo); ok {
+		entry.Layer = layered.Layer()
+	}
+}
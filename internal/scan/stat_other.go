@@ -0,0 +1,23 @@
+//go:build !unix
+
+package scan
+
+import "os"
+
+// sysFileID returns the device and inode numbers of a file of the
+// operating system. They aren't available on this platform.
+func sysFileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
+
+// sysFileBlocks returns the 512-byte blocks allocated to a file of the
+// operating system. They aren't available on this platform.
+func sysFileBlocks(info os.FileInfo) (blocks int64, ok bool) {
+	return 0, false
+}
+
+// sysFileOwner returns the user and group IDs owning a file of the
+// operating system. They aren't available on this platform.
+func sysFileOwner(info os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !openbsd && !dragonfly && !solaris && !illumos && !aix && !darwin && !freebsd && !netbsd && !ios
+
+package scan
+
+import (
+	"os"
+	"time"
+)
+
+// sysFileTimes returns the access and status change times of a file of
+// the operating system. They aren't available on this platform.
+func sysFileTimes(info os.FileInfo) (atime, ctime time.Time, ok bool) {
+	return time.Time{}, time.Time{}, false
+}
@@ -0,0 +1,20 @@
+//go:build darwin || freebsd || netbsd || ios
+
+package scan
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// sysFileTimes returns the access and status change times of a file of
+// the operating system
+func sysFileTimes(info os.FileInfo) (atime, ctime time.Time, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return time.Unix(int64(stat.Atimespec.Sec), int64(stat.Atimespec.Nsec)),
+		time.Unix(int64(stat.Ctimespec.Sec), int64(stat.Ctimespec.Nsec)), true
+}
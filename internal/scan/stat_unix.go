@@ -0,0 +1,38 @@
+//go:build unix
+
+package scan
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysFileID returns the device and inode numbers of a file of the
+// operating system
+func sysFileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(stat.Dev), uint64(stat.Ino), true
+}
+
+// sysFileBlocks returns the 512-byte blocks allocated to a file of the
+// operating system
+func sysFileBlocks(info os.FileInfo) (blocks int64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(stat.Blocks), true
+}
+
+// sysFileOwner returns the user and group IDs owning a file of the
+// operating system
+func sysFileOwner(info os.FileInfo) (uid, gid uint32, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return stat.Uid, stat.Gid, true
+}
@@ -0,0 +1,326 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/steezeburger/storage-shower/pkg/utils"
+)
+
+// Shortest interval allowed between scheduled scans
+const minInterval = time.Minute
+
+// How long to wait before retrying a scan that was due while another scan
+// was running
+const busyRetryDelay = time.Minute
+
+// ErrBusy is returned by a RunFunc when another scan holds the scanner
+var ErrBusy = errors.New("another scan is in progress")
+
+// Schedule is a recurring scan of a directory
+type Schedule struct {
+	// Name shown in status; defaults to the path
+	Name string `json:"name,omitempty"`
+	// Directory to scan
+	Path string `json:"path"`
+	// Read Path as a container image instead of a directory
+	Image bool `json:"image,omitempty"`
+	// Read Path as a git repository and size its history
+	GitHistory bool `json:"gitHistory,omitempty"`
+	// Cron expression, e.g. "0 3 * * *" for every night at 3:00
+	Cron string `json:"cron,omitempty"`
+	// Time between scans, used instead of Cron
+	Interval utils.Duration `json:"interval,omitempty"`
+	// Skip hidden files and directories
+	IgnoreHidden bool `json:"ignoreHidden,omitempty"`
+	// Glob patterns skipped in addition to the configured excludes
+	Excludes []string `json:"excludes,omitempty"`
+}
+
+// Status is a schedule with the times of its last and next run
+type Status struct {
+	Schedule
+	NextRun   time.Time  `json:"nextRun"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	Running   bool       `json:"running"`
+}
+
+// RunFunc runs the scan of a schedule. It returns ErrBusy if the scan
+// couldn't start because another one was running.
+type RunFunc func(s Schedule) error
+
+// Scheduler runs scans when their schedules are due
+type Scheduler struct {
+	run RunFunc
+
+	mutex   sync.Mutex
+	entries []*entry
+	started bool
+	stopped bool
+
+	// Wakes the loop when schedules change
+	reload chan struct{}
+	stop   chan struct{}
+}
+
+// entry is the state of one schedule
+type entry struct {
+	schedule Schedule
+	cron     *cronSpec
+	next     time.Time
+	lastRun  *time.Time
+	lastErr  string
+	running  bool
+}
+
+// key returns the name identifying a schedule
+func (s Schedule) key() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Path
+}
+
+// Validate checks that schedules have a path, a valid cron expression that
+// matches some time or an interval, and distinct names
+func Validate(schedules []Schedule) error {
+	names := make(map[string]bool)
+	for _, s := range schedules {
+		if s.Path == "" {
+			return fmt.Errorf("schedule %q needs a path", s.Name)
+		}
+		if names[s.key()] {
+			return fmt.Errorf("duplicate schedule %q", s.key())
+		}
+		names[s.key()] = true
+		if s.Image && s.GitHistory {
+			return fmt.Errorf("schedule %q reads both a container image and a git history", s.key())
+		}
+
+		switch {
+		case s.Cron != "" && s.Interval != 0:
+			return fmt.Errorf("schedule %q sets both cron and interval", s.key())
+		case s.Cron != "":
+			spec, err := parseCron(s.Cron)
+			if err != nil {
+				return fmt.Errorf("schedule %q: %v", s.key(), err)
+			}
+			if spec.next(time.Now()).IsZero() {
+				return fmt.Errorf("schedule %q: cron expression %q never matches", s.key(), s.Cron)
+			}
+		case time.Duration(s.Interval) < minInterval:
+			return fmt.Errorf("schedule %q needs a cron expression or an interval of at least %v", s.key(), minInterval)
+		}
+		for _, pattern := range s.Excludes {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid exclude pattern %q in schedule %q: %v", pattern, s.key(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// New creates a scheduler that calls run for due schedules once started
+func New(run RunFunc) *Scheduler {
+	return &Scheduler{
+		run:    run,
+		reload: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Update replaces the schedules. Schedules that keep their name and timing
+// keep their run history and next run time.
+func (s *Scheduler) Update(schedules []Schedule) {
+	now := time.Now()
+
+	s.mutex.Lock()
+	previous := make(map[string]*entry, len(s.entries))
+	for _, e := range s.entries {
+		previous[e.schedule.key()] = e
+	}
+
+	entries := make([]*entry, 0, len(schedules))
+	for _, schedule := range schedules {
+		var spec *cronSpec
+		if schedule.Cron != "" {
+			var err error
+			if spec, err = parseCron(schedule.Cron); err != nil {
+				log.Printf("Warning: Ignoring schedule %q: %v", schedule.key(), err)
+				continue
+			}
+		} else if schedule.Interval <= 0 {
+			log.Printf("Warning: Ignoring schedule %q without cron expression or interval", schedule.key())
+			continue
+		}
+
+		// Reuse the entry of an existing schedule so a run in progress
+		// updates it when it finishes
+		e, ok := previous[schedule.key()]
+		if !ok {
+			e = &entry{}
+		}
+		timingChanged := e.schedule.Cron != schedule.Cron || e.schedule.Interval != schedule.Interval
+		e.schedule, e.cron = schedule, spec
+		if e.next.IsZero() || (timingChanged && !e.running) {
+			e.next = e.nextAfter(now)
+		}
+		entries = append(entries, e)
+	}
+	s.entries = entries
+	s.mutex.Unlock()
+
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+// nextAfter returns when the schedule is next due after t
+func (e *entry) nextAfter(t time.Time) time.Time {
+	if e.cron != nil {
+		return e.cron.next(t)
+	}
+	return t.Add(time.Duration(e.schedule.Interval))
+}
+
+// Start runs due schedules in the background until Stop is called
+func (s *Scheduler) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	go s.loop()
+}
+
+// Stop stops starting scans. Scans already running are left to finish.
+func (s *Scheduler) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	close(s.stop)
+}
+
+// loop waits for the next due schedule and runs it
+func (s *Scheduler) loop() {
+	for {
+		wait := s.runDue(time.Now())
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.reload:
+			timer.Stop()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runDue starts the scans due at now and returns how long to wait until the
+// next one is due
+func (s *Scheduler) runDue(now time.Time) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Sleep for a long time when nothing is scheduled; updates wake the loop
+	wait := 24 * time.Hour
+	for _, e := range s.entries {
+		if e.next.IsZero() || e.running {
+			continue
+		}
+		if !e.next.After(now) {
+			e.running = true
+			go s.runEntry(e)
+			continue
+		}
+		if d := e.next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// runEntry runs the scan of an entry and schedules its next run
+func (s *Scheduler) runEntry(e *entry) {
+	s.mutex.Lock()
+	stopped := s.stopped
+	schedule := e.schedule
+	s.mutex.Unlock()
+	if stopped {
+		return
+	}
+
+	startedAt := time.Now()
+	log.Printf("Running scheduled scan %q of %s", schedule.key(), schedule.Path)
+	err := s.run(schedule)
+
+	s.mutex.Lock()
+	e.running = false
+	switch {
+	case errors.Is(err, ErrBusy):
+		log.Printf("Scheduled scan %q postponed: %v", schedule.key(), err)
+		e.lastErr = "postponed: " + err.Error()
+		e.next = time.Now().Add(busyRetryDelay)
+	default:
+		e.lastRun = &startedAt
+		e.lastErr = ""
+		if err != nil {
+			log.Printf("Scheduled scan %q failed: %v", schedule.key(), err)
+			e.lastErr = err.Error()
+		}
+		// Interval schedules count from the start of the run; cron
+		// schedules skip the runs missed while scanning
+		if e.cron != nil {
+			e.next = e.nextAfter(time.Now())
+		} else {
+			e.next = e.nextAfter(startedAt)
+			if !e.next.After(time.Now()) {
+				e.next = time.Now()
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the state of all schedules, soonest first
+func (s *Scheduler) Status() []Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		status := Status{
+			Schedule:  e.schedule,
+			NextRun:   e.next,
+			LastError: e.lastErr,
+			Running:   e.running,
+		}
+		if e.lastRun != nil {
+			lastRun := *e.lastRun
+			status.LastRun = &lastRun
+		}
+		statuses = append(statuses, status)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].NextRun.Before(statuses[j].NextRun)
+	})
+	return statuses
+}
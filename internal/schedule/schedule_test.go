@@ -0,0 +1,148 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/steezeburger/storage-shower/pkg/utils"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedules []Schedule
+		valid     bool
+	}{
+		{"cron", []Schedule{{Path: "/data", Cron: "0 3 * * *"}}, true},
+		{"interval", []Schedule{{Path: "/data", Interval: utils.Duration(6 * time.Hour)}}, true},
+		{"missing path", []Schedule{{Cron: "@daily"}}, false},
+		{"no timing", []Schedule{{Path: "/data"}}, false},
+		{"both", []Schedule{{Path: "/data", Cron: "@daily", Interval: utils.Duration(time.Hour)}}, false},
+		{"short interval", []Schedule{{Path: "/data", Interval: utils.Duration(time.Second)}}, false},
+		{"bad cron", []Schedule{{Path: "/data", Cron: "daily"}}, false},
+		{"cron never matching", []Schedule{{Path: "/data", Cron: "0 0 30 2 *"}}, false},
+		{"cron on leap days", []Schedule{{Path: "/data", Cron: "0 0 29 2 *"}}, true},
+		{"image and git history", []Schedule{{Path: "/data", Cron: "@daily", Image: true, GitHistory: true}}, false},
+		{"bad exclude", []Schedule{{Path: "/data", Cron: "@daily", Excludes: []string{"["}}}, false},
+		{"duplicate", []Schedule{{Path: "/data", Cron: "@daily"}, {Path: "/data", Cron: "@weekly"}}, false},
+		{"named", []Schedule{{Path: "/data", Cron: "@daily"}, {Name: "weekly", Path: "/data", Cron: "@weekly"}}, true},
+	}
+
+	for _, test := range tests {
+		if err := Validate(test.schedules); (err == nil) != test.valid {
+			t.Errorf("%s: Validate() error = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestScheduler_RunsDueSchedules(t *testing.T) {
+	runs := make(chan Schedule, 10)
+	scheduler := New(func(s Schedule) error {
+		runs <- s
+		return nil
+	})
+	scheduler.Update([]Schedule{{Path: "/data", Interval: utils.Duration(20 * time.Millisecond)}})
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-runs:
+			if s.Path != "/data" {
+				t.Errorf("Ran schedule for %s, want /data", s.Path)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Schedule ran %d times, want 2", i)
+		}
+	}
+
+	// Wait for the second run to be recorded
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := scheduler.Status()
+		if len(status) != 1 {
+			t.Fatalf("Status = %+v, want one schedule", status)
+		}
+		if !status[0].Running && status[0].LastRun != nil {
+			if status[0].LastError != "" {
+				t.Errorf("Last error = %q, want none", status[0].LastError)
+			}
+			if !status[0].NextRun.After(*status[0].LastRun) {
+				t.Errorf("Next run %v should follow last run %v", status[0].NextRun, *status[0].LastRun)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Run was not recorded: %+v", status[0])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestScheduler_Busy(t *testing.T) {
+	done := make(chan struct{})
+	scheduler := New(func(s Schedule) error {
+		defer close(done)
+		return ErrBusy
+	})
+	scheduler.Update([]Schedule{{Path: "/data", Interval: utils.Duration(time.Millisecond)}})
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Schedule did not run")
+	}
+
+	// A busy scanner postpones the run without counting it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := scheduler.Status()[0]
+		if !status.Running && status.LastError != "" {
+			if status.LastRun != nil {
+				t.Errorf("Postponed run recorded as last run %v", status.LastRun)
+			}
+			if until := time.Until(status.NextRun); until < busyRetryDelay/2 {
+				t.Errorf("Next run in %v, want a retry after about %v", until, busyRetryDelay)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Postponed run was not recorded: %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestScheduler_UpdateKeepsHistory(t *testing.T) {
+	scheduler := New(func(Schedule) error { return errors.New("unused") })
+	daily := Schedule{Name: "home", Path: "/home", Cron: "@daily"}
+	scheduler.Update([]Schedule{daily})
+
+	lastRun := time.Now().Add(-time.Hour)
+	scheduler.entries[0].lastRun = &lastRun
+	next := scheduler.Status()[0].NextRun
+
+	// Changing options other than the timing keeps the next run
+	daily.IgnoreHidden = true
+	scheduler.Update([]Schedule{daily, {Path: "/data", Cron: "@hourly"}})
+	status := scheduler.Status()
+	if len(status) != 2 {
+		t.Fatalf("Status = %+v, want two schedules", status)
+	}
+	for _, s := range status {
+		if s.Name != "home" {
+			continue
+		}
+		if !s.IgnoreHidden || !s.NextRun.Equal(next) || s.LastRun == nil || !s.LastRun.Equal(lastRun) {
+			t.Errorf("Updated schedule = %+v, want next run %v and last run %v kept", s, next, lastRun)
+		}
+	}
+
+	// Soonest first
+	if status[0].Path != "/data" {
+		t.Errorf("First schedule = %s, want the hourly /data", status[0].Path)
+	}
+}
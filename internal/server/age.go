@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+)
+
+// Defaults of the stale subtree report
+const (
+	defaultStaleDays    = 365
+	defaultStaleMinSize = 1 << 30
+	defaultStaleLimit   = 100
+	// Largest age accepted, well below where a duration in days overflows
+	maxStaleDays = 100000
+)
+
+// requestAgeField parses the field query parameter. It writes an error
+// response and returns false if the field is unknown.
+func requestAgeField(w http.ResponseWriter, r *http.Request) (fileinfo.AgeField, bool) {
+	switch field := fileinfo.AgeField(r.URL.Query().Get("field")); field {
+	case "", fileinfo.AgeModified:
+		return fileinfo.AgeModified, true
+	case fileinfo.AgeAccessed:
+		return field, true
+	default:
+		http.Error(w, "Invalid field, use modified or accessed", http.StatusBadRequest)
+		return "", false
+	}
+}
+
+// handleAge returns a histogram of the bytes under a node of a scan result
+// by file age
+func handleAge(w http.ResponseWriter, r *http.Request) {
+	result, err := loadResult(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	node := findRequestedNode(w, r, &result)
+	if node == nil {
+		return
+	}
+	field, ok := requestAgeField(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":    node.Path,
+		"field":   field,
+		"buckets": fileinfo.AgeHistogram(node, field, time.Now()),
+	})
+}
+
+// handleStale returns the largest directory trees under a node of a scan
+// result that nobody has touched for a while
+func handleStale(w http.ResponseWriter, r *http.Request) {
+	result, err := loadResult(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	node := findRequestedNode(w, r, &result)
+	if node == nil {
+		return
+	}
+	field, ok := requestAgeField(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := requestLimit(w, r, defaultStaleLimit)
+	if !ok {
+		return
+	}
+
+	days := defaultStaleDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 0 || days > maxStaleDays {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+	}
+	var minSize int64 = defaultStaleMinSize
+	if value := r.URL.Query().Get("minSize"); value != "" {
+		minSize, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || minSize < 0 {
+			http.Error(w, "Invalid minSize", http.StatusBadRequest)
+			return
+		}
+	}
+
+	stale := fileinfo.FindStaleSubtrees(node, field, time.Duration(days)*fileinfo.Day, minSize, time.Now())
+	var total int64
+	for _, subtree := range stale {
+		total += subtree.Size
+	}
+	if limit > 0 && len(stale) > limit {
+		stale = stale[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":       node.Path,
+		"field":      field,
+		"days":       days,
+		"minSize":    minSize,
+		"totalBytes": total,
+		"subtrees":   stale,
+	})
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/steezeburger/storage-shower/internal/alerts"
+	"github.com/steezeburger/storage-shower/internal/config"
+)
+
+// handleAlerts returns the alert rules and the latest violations of each
+// scanned root
+func handleAlerts(store *config.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules := store.Get().AlertRules
+		if rules == nil {
+			rules = []alerts.Rule{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rules":   rules,
+			"reports": alerts.Reports(),
+		})
+	}
+}
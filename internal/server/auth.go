@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/steezeburger/storage-shower/internal/agent"
+)
+
+// Name of the cookie holding the access token for the browser UI
+const tokenCookieName = "storage_shower_token"
+
+// generateToken returns a random hex-encoded access token
+func generateToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// isLoopback reports whether addr only accepts connections from this machine
+func isLoopback(addr string) bool {
+	if addr == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requestToken extracts the access token from a request, checking the
+// Authorization header, the token query parameter and the cookie in turn
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(tokenCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// tokenMatches compares tokens in constant time
+func tokenMatches(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// requireToken wraps next so every /api and /metrics request must carry the
+// access token, except uploads from agents, which carry the ingest token.
+// Page loads carrying a valid ?token= are handed a cookie and redirected to the
+// same URL without the token, so the browser UI authenticates transparently.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == agent.IngestPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/metrics" {
+			if !tokenMatches(requestToken(r), token) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Hand off a token from the URL to a cookie for the browser UI
+		query := r.URL.Query()
+		if queryToken := query.Get("token"); queryToken != "" && tokenMatches(queryToken, token) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			query.Del("token")
+			redirect := *r.URL
+			redirect.RawQuery = query.Encode()
+			http.Redirect(w, r, redirect.RequestURI(), http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	const token = "secret"
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := requireToken(token, next)
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		cookie   string
+		expected int
+	}{
+		{"api without token", "/api/results", "", "", http.StatusUnauthorized},
+		{"api with wrong token", "/api/results?token=nope", "", "", http.StatusUnauthorized},
+		{"api with query token", "/api/results?token=secret", "", "", http.StatusOK},
+		{"api with bearer token", "/api/results", "Bearer secret", "", http.StatusOK},
+		{"api with cookie", "/api/results", "", "secret", http.StatusOK},
+		{"metrics without token", "/metrics", "", "", http.StatusUnauthorized},
+		{"metrics with bearer token", "/metrics", "Bearer secret", "", http.StatusOK},
+		{"ingest checks its own token", "/api/ingest", "", "", http.StatusOK},
+		{"page without token", "/", "", "", http.StatusOK},
+		{"page with token", "/?token=secret", "", "", http.StatusSeeOther},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		if test.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: tokenCookieName, Value: test.cookie})
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.expected {
+			t.Errorf("%s: got status %d, want %d", test.name, rec.Code, test.expected)
+		}
+	}
+}
+
+func TestRequireToken_CookieHandoff(t *testing.T) {
+	handler := requireToken("secret", http.NotFoundHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/?token=secret", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if location := rec.Header().Get("Location"); location != "/" {
+		t.Errorf("Redirect location = %q, want %q", location, "/")
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != tokenCookieName || cookies[0].Value != "secret" {
+		t.Fatalf("Expected token cookie to be set, got %v", cookies)
+	}
+	if !cookies[0].HttpOnly {
+		t.Error("Token cookie should be HttpOnly")
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{"localhost", true},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"0.0.0.0", false},
+		{"", false},
+		{"192.168.1.10", false},
+	}
+
+	for _, test := range tests {
+		if result := isLoopback(test.addr); result != test.expected {
+			t.Errorf("isLoopback(%q) = %v, want %v", test.addr, result, test.expected)
+		}
+	}
+}
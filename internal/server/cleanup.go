@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+)
+
+// cleanupResponse is a cleanup report with its item counts
+type cleanupResponse struct {
+	Path string `json:"path"`
+	fileinfo.CleanupReport
+	EmptyDirCount   int `json:"emptyDirCount"`
+	EmptyFileCount  int `json:"emptyFileCount"`
+	BrokenLinkCount int `json:"brokenLinkCount"`
+	// Outcome of the removal, absent for reports and dry runs
+	Result *scan.CleanupResult `json:"result,omitempty"`
+}
+
+// handleCleanup reports the empty directories, zero-byte files and broken
+// symbolic links of a scan result on GET, and removes the selected kinds
+// on POST
+func handleCleanup(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ResultID    string `json:"id"`
+		EmptyDirs   bool   `json:"emptyDirs"`
+		EmptyFiles  bool   `json:"emptyFiles"`
+		BrokenLinks bool   `json:"brokenLinks"`
+		DryRun      bool   `json:"dryRun"`
+	}
+
+	var result fileinfo.FileInfo
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		result, err = loadResult(r)
+	case http.MethodPost:
+		// Browsers can't send JSON cross-origin without a preflight, so this
+		// keeps other web pages from triggering removals
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if scan.GetScanStatus().InProgress {
+			http.Error(w, "Cannot clean up while a scan is in progress", http.StatusConflict)
+			return
+		}
+		if request.ResultID != "" {
+			result, err = scan.GetScanResultByID(request.ResultID)
+		} else {
+			result, err = scan.GetLatestScanResult()
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	report := fileinfo.FindCleanupCandidates(&result)
+	var cleanupResult *scan.CleanupResult
+	if r.Method == http.MethodPost {
+		if reason := cleanupRefusal(request.ResultID, &result); reason != "" {
+			http.Error(w, reason, http.StatusBadRequest)
+			return
+		}
+		// Only keep the kinds selected for removal
+		if !request.EmptyDirs {
+			report.EmptyDirs = []string{}
+		}
+		if !request.EmptyFiles {
+			report.EmptyFiles = []string{}
+		}
+		if !request.BrokenLinks {
+			report.BrokenLinks = []fileinfo.BrokenLink{}
+		}
+		if !request.DryRun {
+			removed := scan.Cleanup(result.Path, report)
+			cleanupResult = &removed
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cleanupResponse{
+		Path:            result.Path,
+		CleanupReport:   report,
+		EmptyDirCount:   len(report.EmptyDirs),
+		EmptyFileCount:  len(report.EmptyFiles),
+		BrokenLinkCount: len(report.BrokenLinks),
+		Result:          cleanupResult,
+	})
+}
+
+// cleanupRefusal returns why the paths of a scan result mustn't be removed
+// from this machine, or "" if they can be. Results uploaded by agents hold
+// paths of other machines, and images and git histories hold paths that
+// don't exist on disk.
+func cleanupRefusal(resultID string, result *fileinfo.FileInfo) string {
+	if resultID != "" {
+		for _, record := range scan.History() {
+			if record.ResultID == resultID && record.Host != "" {
+				return "Cannot clean up a scan uploaded by " + record.Host
+			}
+		}
+	}
+	switch {
+	case result.Image != nil:
+		return "Cannot clean up a container image scan"
+	case result.Objects > 0:
+		return "Cannot clean up a git history scan"
+	}
+	return ""
+}
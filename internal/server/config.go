@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/steezeburger/storage-shower/internal/config"
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+	"github.com/steezeburger/storage-shower/internal/schedule"
+)
+
+// configResponse is the configuration as exposed through the API
+type configResponse struct {
+	config.Settings
+	// Where settings are saved
+	ConfigPath string `json:"configPath"`
+	// Listener options, read-only at runtime
+	Addr   string `json:"addr"`
+	Port   int    `json:"port"`
+	Socket string `json:"socket,omitempty"`
+}
+
+// applySettings pushes runtime settings into the packages that use them
+func applySettings(settings config.Settings) {
+	scan.SetHistoryRetention(settings.HistoryRetention)
+	scan.SetRetentionPolicies(settings.Retention)
+	if err := fileinfo.ConfigureCategories(settings.Categories, settings.FileTypes); err != nil {
+		log.Printf("Warning: Cannot apply file type categories: %v", err)
+	}
+}
+
+// handleFileTypes returns the active file type categories
+func handleFileTypes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fileinfo.Categories())
+}
+
+// handleConfig returns the configuration on GET and updates the runtime
+// settings on PUT
+func handleConfig(store *config.Store, scheduler *schedule.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var body map[string]json.RawMessage
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			// Start from the current settings so omitted fields are kept,
+			// replacing the sent ones whole. Decoding into fresh settings
+			// leaves the slices and maps of the live ones untouched.
+			current, err := json.Marshal(store.Get().Settings)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			merged := map[string]json.RawMessage{}
+			json.Unmarshal(current, &merged)
+			for key, value := range body {
+				merged[key] = value
+			}
+			data, _ := json.Marshal(merged)
+			var settings config.Settings
+			if err := json.Unmarshal(data, &settings); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := settings.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := store.UpdateSettings(settings); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			applySettings(settings)
+			scheduler.Update(settings.Schedules)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		cfg := store.Get()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(configResponse{
+			Settings:   cfg.Settings,
+			ConfigPath: store.Path(),
+			Addr:       cfg.Addr,
+			Port:       cfg.Port,
+			Socket:     cfg.Socket,
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/scan"
+)
+
+const (
+	// Minimum time between two progress events sent to a client
+	eventThrottleInterval = 250 * time.Millisecond
+
+	// Interval for keep-alive comments so proxies don't drop idle streams
+	eventKeepAliveInterval = 15 * time.Second
+)
+
+// scanEvent is the payload of a progress event on the scan event stream
+type scanEvent struct {
+	Progress scan.ScanStatus `json:"progress"`
+	// Search matches found since the previous event
+	NewSearchResults []scan.SearchResult `json:"newSearchResults,omitempty"`
+}
+
+// handleScanEvents streams scan status updates as Server-Sent Events
+func handleScanEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Streams stay open for the whole scan, so lift the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	updates, unsubscribe := scan.SubscribeStatus()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	throttle := time.NewTicker(eventThrottleInterval)
+	defer throttle.Stop()
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	sentResults := 0
+	send := func() error {
+		status := scan.GetScanStatus()
+
+		event := scanEvent{Progress: status}
+
+		// Only send matches the client hasn't seen yet
+		if len(status.SearchResults) < sentResults {
+			sentResults = 0
+		}
+		event.NewSearchResults = status.SearchResults[sentResults:]
+		sentResults = len(status.SearchResults)
+		event.Progress.SearchResults = nil
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	// Send the current state right away so the client doesn't wait for a change
+	if err := send(); err != nil {
+		return
+	}
+
+	pending := false
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-updates:
+			pending = true
+		case <-throttle.C:
+			if !pending {
+				continue
+			}
+			pending = false
+			if err := send(); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
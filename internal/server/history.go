@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/steezeburger/storage-shower/internal/scan"
+)
+
+// handlePreviousScans returns a list of previous scan records on GET, and
+// pins or labels a scan on PUT
+func handlePreviousScans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scan.History())
+	case http.MethodPut:
+		var request struct {
+			ResultID string  `json:"id"`
+			Pinned   *bool   `json:"pinned"`
+			Label    *string `json:"label"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ResultID == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		record, err := scan.UpdateScanRecord(request.ResultID, request.Pinned, request.Label)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(record)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCleanOrphanedResults removes scan result files that no previous scan
+// refers to
+func handleCleanOrphanedResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	removed, err := scan.CleanOrphanedResults()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"removed": removed,
+	})
+}
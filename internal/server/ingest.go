@@ -0,0 +1,81 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/agent"
+	"github.com/steezeburger/storage-shower/internal/scan"
+)
+
+// Most bytes an uploaded report may take up, compressed and once
+// decompressed
+const maxIngestBytes = 512 << 20
+
+// Time an agent may take to upload a report, replacing the server's read
+// timeout, which is too short for large reports over slow links
+const ingestTimeout = 10 * time.Minute
+
+// handleIngest stores scan results uploaded by agents in the history under
+// the host that sent them. Agents authenticate with the ingest token, which
+// is separate from the access token of the UI; without one ingest is off.
+func handleIngest(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token == "" {
+			http.Error(w, "Ingest is disabled; set an ingest token to accept agents", http.StatusForbidden)
+			return
+		}
+		if !tokenMatches(requestToken(r), token) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Only authenticated uploads get the longer deadlines
+		deadline := time.Now().Add(ingestTimeout)
+		controller := http.NewResponseController(w)
+		controller.SetReadDeadline(deadline)
+		controller.SetWriteDeadline(deadline.Add(writeTimeout))
+
+		var body io.ReadCloser = http.MaxBytesReader(w, r.Body, maxIngestBytes)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			body = http.MaxBytesReader(w, gz, maxIngestBytes)
+		}
+
+		var report agent.Report
+		if err := json.NewDecoder(body).Decode(&report); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		host := strings.TrimSpace(report.Host)
+		if host == "" || report.Result.Path == "" {
+			http.Error(w, "Host and result path are required", http.StatusBadRequest)
+			return
+		}
+
+		record := report.Record
+		record.Host = host
+		record, err := scan.StoreResult(report.Result, record)
+		if err != nil {
+			log.Printf("Error storing scan from %s: %v", host, err)
+			http.Error(w, "Failed to store scan result", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(record)
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/agent"
+	"github.com/steezeburger/storage-shower/internal/config"
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+)
+
+// postReport uploads a gzip compressed report like an agent does
+func postReport(t *testing.T, url, token string, report agent.Report) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	json.NewEncoder(gz).Encode(report)
+	gz.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, url+agent.IngestPath, &body)
+	req.Header.Set("Content-Encoding", "gzip")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", agent.IngestPath, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestHandleIngest(t *testing.T) {
+	isolateState(t)
+	store := config.NewStore("", config.Default())
+	mux, err := newMux(testWebFS, store, newScheduler(store), "agent-secret")
+	if err != nil {
+		t.Fatalf("newMux failed: %v", err)
+	}
+	// Agents don't know the access token of the UI
+	ts := httptest.NewServer(requireToken("ui-secret", mux))
+	defer ts.Close()
+
+	finished := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	report := agent.Report{
+		Host:   "build-7",
+		Record: scan.ScanRecord{Timestamp: finished, Items: 3},
+		Result: fileinfo.FileInfo{Name: "cache", Path: "/var/cache", IsDir: true, Size: 5000, FileCount: 2},
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		report   agent.Report
+		expected int
+	}{
+		{"no token", "", report, http.StatusUnauthorized},
+		{"access token", "ui-secret", report, http.StatusUnauthorized},
+		{"no host", "agent-secret", agent.Report{Result: report.Result}, http.StatusBadRequest},
+		{"stored", "agent-secret", report, http.StatusOK},
+	}
+	for _, test := range tests {
+		if resp := postReport(t, ts.URL, test.token, test.report); resp.StatusCode != test.expected {
+			t.Errorf("%s: got status %d, want %d", test.name, resp.StatusCode, test.expected)
+		}
+	}
+
+	// Uploads keep their own timestamp, so look the record up by host
+	var record scan.ScanRecord
+	for _, r := range scan.History() {
+		if r.Host == "build-7" {
+			record = r
+			break
+		}
+	}
+	if record.Host != "build-7" || record.Path != "/var/cache" || !record.Timestamp.Equal(finished) || record.Items != 3 {
+		t.Errorf("History record = %+v, want the scan of /var/cache on build-7", record)
+	}
+	result, err := scan.GetScanResultByID(record.ResultID)
+	if err != nil || result.Size != 5000 {
+		t.Errorf("Stored result = %d bytes, %v, want 5000", result.Size, err)
+	}
+
+	// Metrics tell the same root on different hosts apart
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+	req.Header.Set("Authorization", "Bearer ui-secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+	metrics, _ := io.ReadAll(resp.Body)
+	want := `storage_shower_directory_size_bytes{host="build-7",root="/var/cache",path="/var/cache"} 5000`
+	if !strings.Contains(string(metrics), want) {
+		t.Errorf("Metrics missing %s", want)
+	}
+}
+
+func TestHandleIngest_Disabled(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+
+	report := agent.Report{Host: "build-7", Result: fileinfo.FileInfo{Path: "/var/cache"}}
+	if resp := postReport(t, ts.URL, "anything", report); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Upload without an ingest token: got status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
+
+func TestHandleIngest_SlowUpload(t *testing.T) {
+	isolateState(t)
+	store := config.NewStore("", config.Default())
+	mux, err := newMux(testWebFS, store, newScheduler(store), "agent-secret")
+	if err != nil {
+		t.Fatalf("newMux failed: %v", err)
+	}
+	// Uploads outlast the server's read timeout
+	ts := httptest.NewUnstartedServer(mux)
+	ts.Config.ReadTimeout = 100 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	data, _ := json.Marshal(agent.Report{
+		Host:   "slow-link",
+		Result: fileinfo.FileInfo{Name: "cache", Path: "/var/cache", IsDir: true, Size: 5000},
+	})
+	body, writer := io.Pipe()
+	go func() {
+		writer.Write(data[:len(data)/2])
+		time.Sleep(300 * time.Millisecond)
+		writer.Write(data[len(data)/2:])
+		writer.Close()
+	}()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+agent.IngestPath, body)
+	req.Header.Set("Authorization", "Bearer agent-secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", agent.IngestPath, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Slow upload: got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
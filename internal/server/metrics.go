@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/steezeburger/storage-shower/internal/config"
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+)
+
+// directoryMetric is the size of one directory reported by /metrics
+type directoryMetric struct {
+	path  string
+	bytes int64
+	files int64
+}
+
+// Directory sizes of the latest scan of each root, by result ID and depth,
+// so scrapes don't reload unchanged results
+var (
+	metricsCache      = make(map[string][]directoryMetric)
+	metricsCacheMutex sync.Mutex
+)
+
+// metricFamily is the help text and type of a metric
+type metricFamily struct {
+	name, help, kind string
+}
+
+// metricsWriter writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+// family writes the help text and type of a metric
+func (m metricsWriter) family(f metricFamily) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+}
+
+// sample writes one value of a metric with label name and value pairs
+func (m metricsWriter) sample(name string, value float64, labels ...string) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			fmt.Fprintf(m.w, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		m.w.WriteByte('}')
+	}
+	m.w.WriteByte(' ')
+	m.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.w.WriteByte('\n')
+}
+
+// escapeLabel escapes a label value for the text exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Metric families exposed by /metrics
+var (
+	directorySizeMetric = metricFamily{"storage_shower_directory_size_bytes",
+		"Size of a directory in the latest scan of its root.", "gauge"}
+	directoryFilesMetric = metricFamily{"storage_shower_directory_files",
+		"Number of files below a directory in the latest scan of its root.", "gauge"}
+	scanTimestampMetric = metricFamily{"storage_shower_last_scan_timestamp_seconds",
+		"Time the latest scan of a root finished.", "gauge"}
+	scanDurationMetric = metricFamily{"storage_shower_last_scan_duration_seconds",
+		"Duration of the latest scan of a root.", "gauge"}
+	scanRateMetric = metricFamily{"storage_shower_last_scan_items_per_second",
+		"Items read per second by the latest scan of a root.", "gauge"}
+	scanErrorsMetric = metricFamily{"storage_shower_last_scan_errors",
+		"Entries the latest scan of a root couldn't read.", "gauge"}
+	scansTotalMetric = metricFamily{"storage_shower_scans_total",
+		"Scans completed since the server started.", "counter"}
+	scanFailuresMetric = metricFamily{"storage_shower_scan_failures_total",
+		"Scans that failed since the server started.", "counter"}
+	errorsTotalMetric = metricFamily{"storage_shower_scan_errors_total",
+		"Entries that couldn't be read since the server started.", "counter"}
+	stallsTotalMetric = metricFamily{"storage_shower_scan_stalls_total",
+		"Times a scan stalled since the server started.", "counter"}
+	inProgressMetric = metricFamily{"storage_shower_scan_in_progress",
+		"Whether a scan is running.", "gauge"}
+	currentRateMetric = metricFamily{"storage_shower_scan_items_per_second",
+		"Items read per second by the running scan.", "gauge"}
+)
+
+// handleMetrics reports directory sizes and scan statistics in the
+// Prometheus text exposition format
+func handleMetrics(store *config.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		depth := store.Get().MetricsDepth
+		latest := latestScans()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m := metricsWriter{bufio.NewWriter(w)}
+		defer m.w.Flush()
+
+		dirs := make(map[string][]directoryMetric, len(latest))
+		for _, record := range latest {
+			dirs[record.ResultID] = directoryMetrics(record, depth)
+		}
+		pruneMetricsCache(latest, depth)
+
+		m.family(directorySizeMetric)
+		for _, record := range latest {
+			for _, dir := range dirs[record.ResultID] {
+				m.sample(directorySizeMetric.name, float64(dir.bytes), append(rootLabels(record), "path", dir.path)...)
+			}
+		}
+		m.family(directoryFilesMetric)
+		for _, record := range latest {
+			for _, dir := range dirs[record.ResultID] {
+				m.sample(directoryFilesMetric.name, float64(dir.files), append(rootLabels(record), "path", dir.path)...)
+			}
+		}
+
+		m.family(scanTimestampMetric)
+		for _, record := range latest {
+			m.sample(scanTimestampMetric.name, float64(record.Timestamp.Unix()), rootLabels(record)...)
+		}
+		m.family(scanDurationMetric)
+		for _, record := range latest {
+			m.sample(scanDurationMetric.name, record.Duration, rootLabels(record)...)
+		}
+		m.family(scanRateMetric)
+		for _, record := range latest {
+			rate := 0.0
+			if record.Duration > 0 {
+				rate = float64(record.Items) / record.Duration
+			}
+			m.sample(scanRateMetric.name, rate, rootLabels(record)...)
+		}
+		m.family(scanErrorsMetric)
+		for _, record := range latest {
+			m.sample(scanErrorsMetric.name, float64(record.Errors), rootLabels(record)...)
+		}
+
+		counters := scan.GetCounters()
+		m.family(scansTotalMetric)
+		m.sample(scansTotalMetric.name, float64(counters.ScansCompleted))
+		m.family(scanFailuresMetric)
+		m.sample(scanFailuresMetric.name, float64(counters.ScansFailed))
+		m.family(errorsTotalMetric)
+		m.sample(errorsTotalMetric.name, float64(counters.Errors))
+		m.family(stallsTotalMetric)
+		m.sample(stallsTotalMetric.name, float64(counters.Stalls))
+
+		status := scan.GetScanStatus()
+		inProgress := 0.0
+		if status.InProgress {
+			inProgress = 1
+		}
+		m.family(inProgressMetric)
+		m.sample(inProgressMetric.name, inProgress)
+		m.family(currentRateMetric)
+		m.sample(currentRateMetric.name, status.ItemsPerSec)
+	}
+}
+
+// latestScans returns the newest scan of each root on each host, sorted by
+// host and root with this server's scans first
+func latestScans() []scan.ScanRecord {
+	type hostRoot struct{ host, path string }
+	seen := make(map[hostRoot]bool)
+	var latest []scan.ScanRecord
+	for _, record := range scan.History() {
+		key := hostRoot{record.Host, record.Path}
+		if !seen[key] {
+			seen[key] = true
+			latest = append(latest, record)
+		}
+	}
+	sort.Slice(latest, func(i, j int) bool {
+		if latest[i].Host != latest[j].Host {
+			return latest[i].Host < latest[j].Host
+		}
+		return latest[i].Path < latest[j].Path
+	})
+	return latest
+}
+
+// rootLabels returns the labels naming the root of a scan, with the host
+// for scans uploaded by agents
+func rootLabels(record scan.ScanRecord) []string {
+	if record.Host == "" {
+		return []string{"root", record.Path}
+	}
+	return []string{"host", record.Host, "root", record.Path}
+}
+
+// directoryMetrics returns the sizes of the directories of a scan result
+// down to depth, loading the result unless it's cached
+func directoryMetrics(record scan.ScanRecord, depth int) []directoryMetric {
+	key := metricsCacheKey(record.ResultID, depth)
+
+	metricsCacheMutex.Lock()
+	defer metricsCacheMutex.Unlock()
+	if dirs, ok := metricsCache[key]; ok {
+		return dirs
+	}
+
+	result, err := scan.GetScanResultByID(record.ResultID)
+	if err != nil {
+		log.Printf("Warning: Cannot load scan result for metrics: %v", err)
+		return nil
+	}
+
+	var dirs []directoryMetric
+	var walk func(node *fileinfo.FileInfo, level int)
+	walk = func(node *fileinfo.FileInfo, level int) {
+		if !node.IsDir {
+			return
+		}
+		dirs = append(dirs, directoryMetric{path: node.Path, bytes: node.Size, files: node.FileCount})
+		if level >= depth {
+			return
+		}
+		for i := range node.Children {
+			walk(&node.Children[i], level+1)
+		}
+	}
+	walk(&result, 0)
+
+	metricsCache[key] = dirs
+	return dirs
+}
+
+// metricsCacheKey identifies the directory sizes of a result down to depth
+func metricsCacheKey(resultID string, depth int) string {
+	return resultID + "/" + strconv.Itoa(depth)
+}
+
+// pruneMetricsCache drops cached directory sizes of results that are no
+// longer the latest of their root
+func pruneMetricsCache(latest []scan.ScanRecord, depth int) {
+	keep := make(map[string]bool, len(latest))
+	for _, record := range latest {
+		keep[metricsCacheKey(record.ResultID, depth)] = true
+	}
+
+	metricsCacheMutex.Lock()
+	defer metricsCacheMutex.Unlock()
+	for key := range metricsCache {
+		if !keep[key] {
+			delete(metricsCache, key)
+		}
+	}
+}
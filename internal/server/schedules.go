@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/config"
+	"github.com/steezeburger/storage-shower/internal/scan"
+	"github.com/steezeburger/storage-shower/internal/schedule"
+)
+
+// newScheduler creates a scheduler for the configured schedules that runs
+// scans like the ones started from the UI
+func newScheduler(store *config.Store) *schedule.Scheduler {
+	scheduler := schedule.New(func(s schedule.Schedule) error {
+		if !scan.TryBeginScan(s.Path) {
+			return schedule.ErrBusy
+		}
+		settings := store.Get().Settings
+		return runScan(store, s.Path, scan.Options{
+			IgnoreHidden:   s.IgnoreHidden,
+			Excludes:       append(append([]string{}, settings.Excludes...), s.Excludes...),
+			Workers:        settings.Workers,
+			SniffContent:   settings.SniffContent,
+			ReadTimeout:    time.Duration(settings.ReadTimeout),
+			ExpandArchives: settings.ExpandArchives,
+			Image:          s.Image,
+			GitHistory:     s.GitHistory,
+		})
+	})
+	scheduler.Update(store.Get().Schedules)
+	return scheduler
+}
+
+// handleSchedules returns the scheduled scans with their last and next runs
+func handleSchedules(scheduler *schedule.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scheduler.Status())
+	}
+}
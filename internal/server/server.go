@@ -1,65 +1,263 @@
 package server
 
 import (
-	"embed"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"os/exec"
 	"os/user"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/steezeburger/storage-shower/internal/agent"
+	"github.com/steezeburger/storage-shower/internal/alerts"
+	"github.com/steezeburger/storage-shower/internal/config"
 	"github.com/steezeburger/storage-shower/internal/fileinfo"
 	"github.com/steezeburger/storage-shower/internal/scan"
+	"github.com/steezeburger/storage-shower/internal/schedule"
 )
 
-// StartServer starts the HTTP server and returns the port it's listening on
-func StartServer(webFS embed.FS) int {
+// Options controls where the server listens and what happens on startup
+type Options struct {
+	// Addr is the interface to bind to, e.g. "localhost" or "0.0.0.0"
+	Addr string
+	// Port is the TCP port to listen on; 0 picks a free port
+	Port int
+	// Socket is a Unix domain socket path; when set it replaces Addr and Port
+	Socket string
+	// OpenBrowser opens the UI in the default browser once listening
+	OpenBrowser bool
+	// Token is the access token required on /api routes. When empty and the
+	// server binds to a non-loopback address, a random token is generated.
+	Token string
+	// IngestToken is the token agents upload scan results with; ingest is
+	// disabled when empty
+	IngestToken string
+	// Config holds the runtime settings; defaults are used when nil
+	Config *config.Store
+}
+
+// Server timeouts. Handlers that legitimately keep responses open longer than
+// the write timeout, like event streams and native dialogs, must extend or
+// clear their deadline with http.ResponseController.SetWriteDeadline.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 2 * time.Minute
+	idleTimeout       = 2 * time.Minute
+)
+
+// Number of extensions returned by /api/extensions unless a limit is given
+const defaultExtensionLimit = 20
+
+// Server is the storage-shower HTTP server
+type Server struct {
+	httpServer *http.Server
+	listener   net.Listener
+	url        string
+	scheduler  *schedule.Scheduler
+
+	// Cancels the base context of all requests so long-lived streams end
+	cancelRequests context.CancelFunc
+}
+
+// NewServer creates a server listening as described by opts and serving the
+// web UI from the "web" directory of webFS. Call Serve to start handling
+// requests and Shutdown to stop.
+func NewServer(webFS fs.FS, opts Options) (*Server, error) {
+	store := opts.Config
+	if store == nil {
+		store = config.NewStore("", config.Default())
+	}
+	applySettings(store.Get().Settings)
+	scheduler := newScheduler(store)
+
+	mux, err := newMux(webFS, store, scheduler, opts.IngestToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listen before serving so bind errors are reported to the caller and
+	// port 0 resolves to the actual port
+	listener, url, err := listen(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Require an access token when reachable from other machines
+	token := opts.Token
+	if token == "" && opts.Socket == "" && !isLoopback(opts.Addr) {
+		token, err = generateToken()
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to generate access token: %v", err)
+		}
+	}
+
+	var handler http.Handler = mux
+	if token != "" {
+		handler = requireToken(token, handler)
+		url += "/?token=" + token
+	}
+
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	s := &Server{
+		httpServer: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: readHeaderTimeout,
+			ReadTimeout:       readTimeout,
+			WriteTimeout:      writeTimeout,
+			IdleTimeout:       idleTimeout,
+			BaseContext: func(net.Listener) context.Context {
+				return baseCtx
+			},
+		},
+		listener:       listener,
+		url:            url,
+		scheduler:      scheduler,
+		cancelRequests: cancelRequests,
+	}
+
+	// Load previous scans and remove results they no longer refer to
+	scan.LoadPreviousScans()
+	if _, err := scan.CleanOrphanedResults(); err != nil {
+		log.Printf("Warning: Cannot clean up orphaned scan results: %v", err)
+	}
+
+	scheduler.Start()
+
+	if opts.OpenBrowser {
+		if opts.Socket != "" {
+			log.Printf("Not opening browser: server is listening on a Unix socket")
+		} else {
+			openBrowser(url)
+		}
+	}
+
+	return s, nil
+}
+
+// URL returns the address clients should use to reach the server
+func (s *Server) URL() string {
+	return s.url
+}
+
+// Serve handles requests until the server is shut down. It always returns a
+// non-nil error; after Shutdown the error is http.ErrServerClosed.
+func (s *Server) Serve() error {
+	log.Printf("Starting server on %s", s.listener.Addr())
+	return s.httpServer.Serve(s.listener)
+}
+
+// Shutdown stops accepting requests, cancels any scan in progress and waits
+// for it to save its partial results, then persists the scan history. It
+// returns early with the context's error if ctx expires first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	// Don't start scheduled scans while shutting down
+	s.scheduler.Stop()
+
+	// End event streams and other long-lived requests
+	s.cancelRequests()
+
+	err := s.httpServer.Shutdown(ctx)
+
+	if scan.CancelScan() == "stopping" {
+		log.Printf("Waiting for scan in progress to save partial results...")
+	}
+	if waitErr := scan.WaitForScan(ctx); waitErr != nil && err == nil {
+		err = waitErr
+	}
+
+	scan.SavePreviousScans()
+	return err
+}
+
+// newMux creates the request router for the API and web UI
+func newMux(webFS fs.FS, store *config.Store, scheduler *schedule.Scheduler, ingestToken string) (*http.ServeMux, error) {
+	mux := http.NewServeMux()
+
 	// Set up API routes
-	http.HandleFunc("/api/scan", handleScan)
-	http.HandleFunc("/api/scan/status", handleScanStatus)
-	http.HandleFunc("/api/scan/stop", handleScanStop)
-	http.HandleFunc("/api/home", handleHome)
-	http.HandleFunc("/api/browse", handleBrowse)
-	http.HandleFunc("/api/results", handleResults)
-	http.HandleFunc("/api/previous-scans", handlePreviousScans)
+	mux.HandleFunc("/api/scan", handleScan(store))
+	mux.HandleFunc("/api/scan/status", handleScanStatus)
+	mux.HandleFunc("/api/scan/events", handleScanEvents)
+	mux.HandleFunc("/api/scan/stop", handleScanStop)
+	mux.HandleFunc("/api/scan/skip", handleScanSkip)
+	mux.HandleFunc("/api/home", handleHome)
+	mux.HandleFunc("/api/browse", handleBrowse)
+	mux.HandleFunc("/api/results", handleResults)
+	mux.HandleFunc("/api/extensions", handleExtensions)
+	mux.HandleFunc("/api/owners", handleOwners)
+	mux.HandleFunc("/api/age", handleAge)
+	mux.HandleFunc("/api/stale", handleStale)
+	mux.HandleFunc("/api/cleanup", handleCleanup)
+	mux.HandleFunc("/api/alerts", handleAlerts(store))
+	mux.HandleFunc("/api/previous-scans", handlePreviousScans)
+	mux.HandleFunc("/api/previous-scans/cleanup", handleCleanOrphanedResults)
+	mux.HandleFunc("/api/schedules", handleSchedules(scheduler))
+	mux.HandleFunc("/api/config", handleConfig(store, scheduler))
+	mux.HandleFunc("/api/file-types", handleFileTypes)
+	mux.HandleFunc(agent.IngestPath, handleIngest(ingestToken))
+	mux.HandleFunc("/metrics", handleMetrics(store))
 
 	// Serve frontend files
-	setupWebHandlers(webFS)
+	if err := setupWebHandlers(mux, webFS); err != nil {
+		return nil, err
+	}
 
-	// Use port 8080
-	port := 8080
+	return mux, nil
+}
 
-	// Start the server in a goroutine
-	go func() {
-		log.Printf("Starting server on port %d", port)
-		if err := http.ListenAndServe(fmt.Sprintf("localhost:%d", port), nil); err != nil {
-			log.Fatalf("Server failed: %v", err)
+// listen opens the listener described by opts and returns it with the URL
+// clients should use to reach it
+func listen(opts Options) (net.Listener, string, error) {
+	if opts.Socket != "" {
+		// Remove a stale socket left behind by a previous run
+		if info, err := os.Stat(opts.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(opts.Socket)
 		}
-	}()
+		listener, err := net.Listen("unix", opts.Socket)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to listen on socket %s: %v", opts.Socket, err)
+		}
+		return listener, "unix:" + opts.Socket, nil
+	}
 
-	// Load previous scans
-	scan.LoadPreviousScans()
+	if opts.Port < 0 || opts.Port > 65535 {
+		return nil, "", fmt.Errorf("invalid port %d", opts.Port)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(opts.Addr, strconv.Itoa(opts.Port)))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen on %s:%d: %v", opts.Addr, opts.Port, err)
+	}
 
-	// Don't open browser automatically - let user navigate manually
-	// openBrowser(fmt.Sprintf("http://localhost:%d", port))
+	// Browsers can't connect to a wildcard address, so point them at loopback
+	host := opts.Addr
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
 
-	return port
+	return listener, fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(port))), nil
 }
 
 // setupWebHandlers configures handlers for serving the embedded web files
-func setupWebHandlers(webFS embed.FS) {
+func setupWebHandlers(mux *http.ServeMux, webFS fs.FS) error {
 	// Get the web subfolder
 	webSubFS, err := fs.Sub(webFS, "web")
 	if err != nil {
-		log.Fatalf("Failed to get web subfolder: %v", err)
+		return fmt.Errorf("failed to get web subfolder: %v", err)
 	}
 
 	// Serve the index.html file for the root path
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" {
 			content, err := fs.ReadFile(webSubFS, "index.html")
 			if err != nil {
@@ -84,7 +282,7 @@ func setupWebHandlers(webFS embed.FS) {
 	})
 
 	// Add explicit handlers for the main web assets
-	http.HandleFunc("/web/app.js", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/web/app.js", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/javascript")
 		content, err := fs.ReadFile(webSubFS, "app.js")
 		if err != nil {
@@ -94,7 +292,7 @@ func setupWebHandlers(webFS embed.FS) {
 		w.Write(content)
 	})
 
-	http.HandleFunc("/web/styles.css", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/web/styles.css", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/css")
 		content, err := fs.ReadFile(webSubFS, "styles.css")
 		if err != nil {
@@ -103,6 +301,8 @@ func setupWebHandlers(webFS embed.FS) {
 		}
 		w.Write(content)
 	})
+
+	return nil
 }
 
 // serveStaticFile serves a static file from the embedded filesystem with the correct MIME type
@@ -137,53 +337,99 @@ func serveStaticFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, path st
 }
 
 // handleScan initiates a new directory scan
-func handleScan(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+func handleScan(store *config.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Parse the request
+		var requestData struct {
+			Path           string   `json:"path"`
+			Image          bool     `json:"image"`
+			GitHistory     bool     `json:"gitHistory"`
+			IgnoreHidden   bool     `json:"ignoreHidden"`
+			SearchTerm     string   `json:"searchTerm"`
+			Excludes       []string `json:"excludes"`
+			SniffContent   *bool    `json:"sniffContent"`
+			ExpandArchives *bool    `json:"expandArchives"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&requestData)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Validate path
+		if requestData.Path == "" {
+			http.Error(w, "Path is required", http.StatusBadRequest)
+			return
+		}
+		if requestData.Image && requestData.GitHistory {
+			http.Error(w, "A scan can't read both a container image and a git history", http.StatusBadRequest)
+			return
+		}
+
+		// Combine configured excludes with the ones sent for this scan
+		settings := store.Get().Settings
+		opts := scan.Options{
+			IgnoreHidden:   requestData.IgnoreHidden,
+			SearchTerm:     requestData.SearchTerm,
+			Excludes:       append(append([]string{}, settings.Excludes...), requestData.Excludes...),
+			Workers:        settings.Workers,
+			SniffContent:   settings.SniffContent,
+			ReadTimeout:    time.Duration(settings.ReadTimeout),
+			ExpandArchives: settings.ExpandArchives,
+			Image:          requestData.Image,
+			GitHistory:     requestData.GitHistory,
+		}
+		if requestData.SniffContent != nil {
+			opts.SniffContent = *requestData.SniffContent
+		}
+		if requestData.ExpandArchives != nil {
+			opts.ExpandArchives = *requestData.ExpandArchives
+		}
+
+		// Claim the scanner so concurrent requests and status watchers see the
+		// scan as started before the goroutine runs
+		if !scan.TryBeginScan(requestData.Path) {
+			http.Error(w, "Another scan is already in progress", http.StatusConflict)
+			return
+		}
+
+		// Start scan in a goroutine
+		go runScan(store, requestData.Path, opts)
 
-	// Parse the request
-	var requestData struct {
-		Path         string `json:"path"`
-		IgnoreHidden bool   `json:"ignoreHidden"`
-		SearchTerm   string `json:"searchTerm"`
+		// Return success
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "started",
+		})
 	}
+}
 
-	err := json.NewDecoder(r.Body).Decode(&requestData)
+// runScan scans a directory and checks the alert rules against the result
+func runScan(store *config.Store, path string, opts scan.Options) error {
+	startedAt := time.Now()
+	root, err := scan.ScanDirectory(path, opts)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+		log.Printf("Scan error: %v", err)
+		return err
 	}
+	log.Printf("Scan completed: %s", path)
 
-	// Validate path
-	if requestData.Path == "" {
-		http.Error(w, "Path is required", http.StatusBadRequest)
-		return
+	cfg := store.Get()
+	if len(cfg.AlertRules) == 0 {
+		return nil
 	}
-
-	// Check if another scan is in progress
-	status := scan.GetScanStatus()
-	if status.InProgress {
-		http.Error(w, "Another scan is already in progress", http.StatusConflict)
-		return
+	report := alerts.Check(cfg.AlertRules, &root, startedAt)
+	for _, violation := range report.Violations {
+		log.Printf("Alert: %s", violation.Message)
 	}
-
-	// Start scan in a goroutine
-	go func() {
-		_, err := scan.ScanDirectory(requestData.Path, requestData.IgnoreHidden, requestData.SearchTerm)
-		if err != nil {
-			log.Printf("Scan error: %v", err)
-		} else {
-			log.Printf("Scan completed: %s", requestData.Path)
-		}
-	}()
-
-	// Return success
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "started",
-	})
+	alerts.Hooks{Webhook: cfg.AlertWebhook, Command: cfg.AlertCommand}.Notify(report)
+	return nil
 }
 
 // handleScanStatus returns the current scan status
@@ -217,6 +463,37 @@ func handleScanStop(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleScanSkip makes an in-progress scan stop waiting for a blocked
+// directory and continue without it. Without a path it skips the directory
+// the scan has waited on longest.
+func handleScanSkip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Path string `json:"path"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	skipped, err := scan.SkipPath(request.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "skipping",
+		"path":   skipped,
+	})
+}
+
 // handleHome returns the user's home directory path
 func handleHome(w http.ResponseWriter, r *http.Request) {
 	u, err := user.Current()
@@ -238,6 +515,9 @@ func handleBrowse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The dialog waits on the user, so lift the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
 	var selectedPath string
 	var err error
 
@@ -297,35 +577,125 @@ func handleBrowse(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// loadResult returns the scan result selected by the id query parameter,
+// or the most recent one
+func loadResult(r *http.Request) (fileinfo.FileInfo, error) {
+	// Check if a specific result ID is requested
+	if resultID := r.URL.Query().Get("id"); resultID != "" {
+		return scan.GetScanResultByID(resultID)
+	}
+	return scan.GetLatestScanResult()
+}
+
 // handleResults returns the scan results
 func handleResults(w http.ResponseWriter, r *http.Request) {
-	// Check if a specific result ID is requested
-	resultID := r.URL.Query().Get("id")
+	result, err := loadResult(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 
-	var result fileinfo.FileInfo
-	var err error
+	// Extension stats are served per node by /api/extensions
+	fileinfo.StripExtensionStats(&result)
 
-	if resultID != "" {
-		// Get a specific scan result by ID
-		result, err = scan.GetScanResultByID(resultID)
-	} else {
-		// Get the most recent scan result
-		result, err = scan.GetLatestScanResult()
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
 
+// handleExtensions returns the extensions using the most space under a
+// node of a scan result
+func handleExtensions(w http.ResponseWriter, r *http.Request) {
+	result, err := loadResult(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
+	node := findRequestedNode(w, r, &result)
+	if node == nil {
+		return
+	}
+	limit, ok := requestLimit(w, r, defaultExtensionLimit)
+	if !ok {
+		return
+	}
+
+	stats := node.Extensions
+	if !node.IsDir && node.Archive == "" {
+		stats = fileinfo.ExtensionStats{
+			strings.ToLower(node.Extension): {Bytes: node.Size, Files: 1},
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":       node.Path,
+		"extensions": stats.Top(limit),
+		"total":      len(stats),
+	})
 }
 
-// handlePreviousScans returns a list of previous scan records
-func handlePreviousScans(w http.ResponseWriter, r *http.Request) {
+// handleOwners returns the bytes owned by each user and group under a node
+// of a scan result
+func handleOwners(w http.ResponseWriter, r *http.Request) {
+	result, err := loadResult(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	node := findRequestedNode(w, r, &result)
+	if node == nil {
+		return
+	}
+	limit, ok := requestLimit(w, r, 0)
+	if !ok {
+		return
+	}
+
+	owners, groups := node.Owners, node.Groups
+	if !node.IsDir && node.Owner != "" {
+		owners = fileinfo.OwnerStats{node.Owner: node.Size}
+		groups = fileinfo.OwnerStats{node.Group: node.Size}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(scan.PreviousScans)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":   node.Path,
+		"size":   node.Size,
+		"owners": owners.Top(limit),
+		"groups": groups.Top(limit),
+	})
+}
+
+// findRequestedNode returns the node named by the path query parameter, or
+// the root when there's none. It writes an error response and returns nil
+// if the path isn't part of the result.
+func findRequestedNode(w http.ResponseWriter, r *http.Request, root *fileinfo.FileInfo) *fileinfo.FileInfo {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		return root
+	}
+	node := fileinfo.FindNode(root, path)
+	if node == nil {
+		http.Error(w, "Path not found in scan result", http.StatusNotFound)
+	}
+	return node
+}
+
+// requestLimit parses the limit query parameter. It writes an error
+// response and returns false if the limit isn't a number.
+func requestLimit(w http.ResponseWriter, r *http.Request, defaultLimit int) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLimit, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
 }
 
 // openBrowser opens the default browser to the specified URL
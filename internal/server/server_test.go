@@ -0,0 +1,834 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/steezeburger/storage-shower/internal/config"
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
+	"github.com/steezeburger/storage-shower/internal/scan"
+	"github.com/steezeburger/storage-shower/internal/schedule"
+)
+
+// testWebFS is a stand-in for the embedded web directory
+var testWebFS = fstest.MapFS{
+	"web/index.html": {Data: []byte("<html>index</html>")},
+	"web/app.js":     {Data: []byte("console.log('app');")},
+	"web/styles.css": {Data: []byte("body {}")},
+}
+
+// isolateState points history and result files at temporary directories
+func isolateState(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("TMPDIR", t.TempDir())
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	store := config.NewStore("", config.Default())
+	mux, err := newMux(testWebFS, store, newScheduler(store), "")
+	if err != nil {
+		t.Fatalf("newMux failed: %v", err)
+	}
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestWebHandlers(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/", http.StatusOK, "text/html"},
+		{"/web/app.js", http.StatusOK, "application/javascript"},
+		{"/web/styles.css", http.StatusOK, "text/css"},
+		{"/missing.js", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Get(ts.URL + test.path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", test.path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s: got status %d, want %d", test.path, resp.StatusCode, test.status)
+		}
+		if test.contentType != "" && !strings.HasPrefix(resp.Header.Get("Content-Type"), test.contentType) {
+			t.Errorf("GET %s: got content type %q, want %q",
+				test.path, resp.Header.Get("Content-Type"), test.contentType)
+		}
+	}
+}
+
+func TestHandleScan_Validation(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid body", http.MethodPost, "{", http.StatusBadRequest},
+		{"missing path", http.MethodPost, `{"path": ""}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, ts.URL+"/api/scan", strings.NewReader(test.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", test.name, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+	}
+}
+
+func TestHandleScan_ScansDirectory(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "file.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "file.txt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]string{"path": dir})
+	resp, err := http.Post(ts.URL+"/api/scan", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("POST /api/scan failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/scan: got status %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := scan.WaitForScan(ctx); err != nil {
+		t.Fatalf("Scan did not finish: %v", err)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/results")
+	if err != nil {
+		t.Fatalf("GET /api/results failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result fileinfo.FileInfo
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if result.Size != 100 {
+		t.Errorf("Result size = %d, want 100", result.Size)
+	}
+	if result.NewestModTime != modTime.Unix() {
+		t.Errorf("Newest modification = %d, want %d", result.NewestModTime, modTime.Unix())
+	}
+	if len(result.Children) != 1 {
+		t.Fatalf("Result has %d children, want 1", len(result.Children))
+	}
+	file := result.Children[0]
+	if file.ModTime != modTime.Unix() {
+		t.Errorf("File modification = %d, want %d", file.ModTime, modTime.Unix())
+	}
+	if file.Mode.Perm() != 0644 {
+		t.Errorf("File mode = %v, want -rw-r--r--", file.Mode)
+	}
+}
+
+// scanAndWait scans dir through the API and waits for the scan to finish
+func scanAndWait(t *testing.T, ts *httptest.Server, dir string) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"path": dir})
+	resp, err := http.Post(ts.URL+"/api/scan", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("POST /api/scan failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/scan: got status %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := scan.WaitForScan(ctx); err != nil {
+		t.Fatalf("Scan did not finish: %v", err)
+	}
+}
+
+func TestHandleExtensions(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+
+	dir := t.TempDir()
+	files := map[string]int{"a.mov": 300, "clips/b.MOV": 200, "clips/c.mp4": 50}
+	for name, size := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanAndWait(t, ts, dir)
+
+	tests := []struct {
+		path     string
+		expected []fileinfo.ExtensionCount
+	}{
+		{dir, []fileinfo.ExtensionCount{
+			{Extension: "mov", ExtensionStat: fileinfo.ExtensionStat{Bytes: 500, Files: 2}},
+			{Extension: "mp4", ExtensionStat: fileinfo.ExtensionStat{Bytes: 50, Files: 1}},
+		}},
+		{filepath.Join(dir, "clips"), []fileinfo.ExtensionCount{
+			{Extension: "mov", ExtensionStat: fileinfo.ExtensionStat{Bytes: 200, Files: 1}},
+			{Extension: "mp4", ExtensionStat: fileinfo.ExtensionStat{Bytes: 50, Files: 1}},
+		}},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Get(ts.URL + "/api/extensions?path=" + url.QueryEscape(test.path))
+		if err != nil {
+			t.Fatalf("GET /api/extensions failed: %v", err)
+		}
+		var result struct {
+			Extensions []fileinfo.ExtensionCount `json:"extensions"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode extensions: %v", err)
+		}
+		if !reflect.DeepEqual(result.Extensions, test.expected) {
+			t.Errorf("Extensions of %s = %v, want %v", test.path, result.Extensions, test.expected)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/api/extensions?path=" + url.QueryEscape(filepath.Join(dir, "missing")))
+	if err != nil {
+		t.Fatalf("GET /api/extensions failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Missing path: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestHandleOwners(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+
+	dir := t.TempDir()
+	for name, size := range map[string]int{"a": 300, "b": 200} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scanAndWait(t, ts, dir)
+
+	resp, err := http.Get(ts.URL + "/api/owners")
+	if err != nil {
+		t.Fatalf("GET /api/owners failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Owners []fileinfo.OwnerUsage `json:"owners"`
+		Groups []fileinfo.OwnerUsage `json:"groups"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode owners: %v", err)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// Everything in the temporary directory belongs to the current user
+	if len(result.Owners) != 1 || result.Owners[0].Bytes != 500 {
+		t.Errorf("Owners = %v, want one owner of 500 bytes", result.Owners)
+	}
+	if len(result.Groups) != 1 || result.Groups[0].Bytes != 500 {
+		t.Errorf("Groups = %v, want one group of 500 bytes", result.Groups)
+	}
+}
+
+func TestHandleStale(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+
+	dir := t.TempDir()
+	old := time.Now().AddDate(-2, 0, 0)
+	for _, name := range []string{"old/a", "new/b"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(dir, "old/a"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	scanAndWait(t, ts, dir)
+
+	resp, err := http.Get(ts.URL + "/api/stale?days=365&minSize=0")
+	if err != nil {
+		t.Fatalf("GET /api/stale failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var report struct {
+		Subtrees []fileinfo.StaleSubtree `json:"subtrees"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if len(report.Subtrees) != 1 || report.Subtrees[0].Path != filepath.Join(dir, "old") {
+		t.Errorf("Stale subtrees = %v, want only %s", report.Subtrees, filepath.Join(dir, "old"))
+	}
+
+	for _, query := range []string{"field=created", "days=-1", "days=10000000000"} {
+		resp, err = http.Get(ts.URL + "/api/stale?" + query)
+		if err != nil {
+			t.Fatalf("GET /api/stale failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", query, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandleCleanup(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+
+	dir := t.TempDir()
+	for _, sub := range []string{"empty/nested", "data"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data", "placeholder"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data", "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "gone"), filepath.Join(dir, "data", "link")); err != nil {
+		t.Skipf("Cannot create symlinks: %v", err)
+	}
+	scanAndWait(t, ts, dir)
+
+	cleanup := func(contentType, body string) (int, map[string]json.RawMessage) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/api/cleanup", contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /api/cleanup failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	all := `{"emptyDirs": true, "emptyFiles": true, "brokenLinks": true`
+	if status, _ := cleanup("text/plain", all+"}"); status != http.StatusUnsupportedMediaType {
+		t.Errorf("Plain text request: got status %d, want %d", status, http.StatusUnsupportedMediaType)
+	}
+
+	status, report := cleanup("application/json", all+`, "dryRun": true}`)
+	if status != http.StatusOK {
+		t.Fatalf("Dry run: got status %d", status)
+	}
+	for _, count := range []string{"emptyDirCount", "emptyFileCount", "brokenLinkCount"} {
+		if string(report[count]) != "1" {
+			t.Errorf("Dry run %s = %s, want 1", count, report[count])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "empty")); err != nil {
+		t.Errorf("Dry run removed the empty directory: %v", err)
+	}
+
+	if status, _ := cleanup("application/json", all+"}"); status != http.StatusOK {
+		t.Fatalf("Cleanup: got status %d", status)
+	}
+	for _, removed := range []string{"empty", "data/placeholder", "data/link"} {
+		if _, err := os.Lstat(filepath.Join(dir, removed)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed, got %v", removed, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", "file")); err != nil {
+		t.Errorf("Non-empty file should be kept: %v", err)
+	}
+}
+
+func TestHandleCleanup_Refused(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+
+	// An agent reports an empty directory that happens to exist here too
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	record, err := scan.StoreResult(fileinfo.FileInfo{
+		Name:     filepath.Base(dir),
+		Path:     dir,
+		IsDir:    true,
+		Children: []fileinfo.FileInfo{{Name: "empty", Path: empty, IsDir: true}},
+	}, scan.ScanRecord{Host: "ci-runner"})
+	if err != nil {
+		t.Fatalf("StoreResult failed: %v", err)
+	}
+
+	body := `{"id": "` + record.ResultID + `", "emptyDirs": true}`
+	resp, err := http.Post(ts.URL+"/api/cleanup", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/cleanup failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Cleanup of an uploaded scan: got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	if _, err := os.Stat(empty); err != nil {
+		t.Errorf("Directory of an uploaded scan was removed: %v", err)
+	}
+}
+
+func TestCleanupRefusal(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  fileinfo.FileInfo
+		refused bool
+	}{
+		{"directory", fileinfo.FileInfo{Path: "/data", IsDir: true}, false},
+		{"container image", fileinfo.FileInfo{Path: "/images/app.tar", Image: &fileinfo.ImageInfo{}}, true},
+		{"git history", fileinfo.FileInfo{Path: "/repo/.git", IsDir: true, Objects: 12}, true},
+	}
+	for _, test := range tests {
+		if reason := cleanupRefusal("", &test.result); (reason != "") != test.refused {
+			t.Errorf("%s: cleanupRefusal() = %q, want refused %v", test.name, reason, test.refused)
+		}
+	}
+}
+
+func TestHandleScanStatus(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/api/scan/status")
+	if err != nil {
+		t.Fatalf("GET /api/scan/status failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		InProgress bool            `json:"inProgress"`
+		Progress   scan.ScanStatus `json:"progress"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.InProgress {
+		t.Error("No scan should be in progress")
+	}
+}
+
+func TestHandleScanStop_NotRunning(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Post(ts.URL+"/api/scan/stop", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /api/scan/stop failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body["status"] != "not_running" {
+		t.Errorf("Stop status = %q, want %q", body["status"], "not_running")
+	}
+}
+
+func TestHandleScanSkip_NotRunning(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Post(ts.URL+"/api/scan/skip", "application/json", strings.NewReader(`{"path":"/mnt/nfs"}`))
+	if err != nil {
+		t.Fatalf("POST /api/scan/skip failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+}
+
+func TestHandleResults_UnknownID(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/api/results?id=does-not-exist")
+	if err != nil {
+		t.Fatalf("GET /api/results failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	isolateState(t)
+
+	srv, err := NewServer(testWebFS, Options{Addr: "127.0.0.1", Port: 0})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve()
+	}()
+
+	resp, err := http.Get(srv.URL() + "/api/previous-scans")
+	if err != nil {
+		t.Fatalf("GET /api/previous-scans failed: %v", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Serve returned %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestHandleConfig(t *testing.T) {
+	isolateState(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	store := config.NewStore(path, config.Default())
+	mux, err := newMux(testWebFS, store, newScheduler(store), "")
+	if err != nil {
+		t.Fatalf("newMux failed: %v", err)
+	}
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	body := `{"excludes": ["node_modules"], "workers": 2}`
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/config", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /api/config failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /api/config: got status %d", resp.StatusCode)
+	}
+
+	settings := store.Get().Settings
+	if len(settings.Excludes) != 1 || settings.Excludes[0] != "node_modules" {
+		t.Errorf("Excludes = %v, want [node_modules]", settings.Excludes)
+	}
+	if settings.HistoryRetention != config.Default().HistoryRetention {
+		t.Errorf("Omitted settings should be kept, got retention %d", settings.HistoryRetention)
+	}
+
+	// The settings should have been persisted
+	loaded := config.Default()
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if loaded.Workers != 2 {
+		t.Errorf("Saved workers = %d, want 2", loaded.Workers)
+	}
+
+	// Invalid settings are rejected
+	req, _ = http.NewRequest(http.MethodPut, ts.URL+"/api/config", strings.NewReader(`{"workers": 0}`))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /api/config failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Invalid settings: got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestHandleConfig_Rejected(t *testing.T) {
+	isolateState(t)
+	cfg := config.Default()
+	cfg.Excludes = []string{"*.tmp", "*.bak"}
+	cfg.Schedules = []schedule.Schedule{{Name: "nightly", Path: t.TempDir(), Cron: "0 3 * * *"}}
+	store := config.NewStore("", cfg)
+	mux, err := newMux(testWebFS, store, newScheduler(store), "")
+	if err != nil {
+		t.Fatalf("newMux failed: %v", err)
+	}
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Compare encoded settings, since a copy shares slices with the store
+	before, _ := json.Marshal(store.Get().Settings)
+	for _, body := range []string{
+		`{"excludes": ["[bad"]}`,
+		`{"schedules": [{"name": "broken", "path": "/data", "cron": "not cron"}]}`,
+	} {
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/config", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PUT /api/config failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", body, resp.StatusCode, http.StatusBadRequest)
+		}
+		if after, _ := json.Marshal(store.Get().Settings); string(after) != string(before) {
+			t.Errorf("%s: rejected update changed the settings to %s", body, after)
+		}
+	}
+}
+
+func TestHandleSchedules(t *testing.T) {
+	isolateState(t)
+	cfg := config.Default()
+	cfg.Schedules = []schedule.Schedule{{Name: "nightly", Path: t.TempDir(), Cron: "0 3 * * *"}}
+	store := config.NewStore("", cfg)
+	mux, err := newMux(testWebFS, store, newScheduler(store), "")
+	if err != nil {
+		t.Fatalf("newMux failed: %v", err)
+	}
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/schedules")
+	if err != nil {
+		t.Fatalf("GET /api/schedules failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var statuses []schedule.Status
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode schedules: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "nightly" {
+		t.Fatalf("Schedules = %+v, want the nightly schedule", statuses)
+	}
+	if next := statuses[0].NextRun; next.Hour() != 3 || next.Minute() != 0 || !next.After(time.Now()) {
+		t.Errorf("Next run = %v, want the next 3:00", next)
+	}
+	if statuses[0].LastRun != nil {
+		t.Errorf("Last run = %v, want none", statuses[0].LastRun)
+	}
+}
+
+func TestHandlePreviousScans(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+	scanAndWait(t, ts, t.TempDir())
+
+	resultID := scan.PreviousScans[0].ResultID
+	body := `{"id": "` + resultID + `", "pinned": true, "label": " baseline "}`
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/previous-scans", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /api/previous-scans failed: %v", err)
+	}
+	var record scan.ScanRecord
+	err = json.NewDecoder(resp.Body).Decode(&record)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode scan record: %v", err)
+	}
+	if !record.Pinned || record.Label != "baseline" || record.ResultID != resultID {
+		t.Errorf("Updated record = %+v, want it pinned and labeled", record)
+	}
+
+	// Unknown scans can't be updated
+	req, _ = http.NewRequest(http.MethodPut, ts.URL+"/api/previous-scans", strings.NewReader(`{"id": "missing", "pinned": true}`))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /api/previous-scans failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unknown scan: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	// Result files no scan refers to are removed, referenced ones are kept,
+	// and so are ones newer than the saved history, which another instance
+	// may have written
+	orphan := filepath.Join(os.TempDir(), "storage-shower-orphan.json")
+	if err := os.WriteFile(orphan, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(orphan, old, old); err != nil {
+		t.Fatal(err)
+	}
+	recent := filepath.Join(os.TempDir(), "storage-shower-other-instance.json")
+	if err := os.WriteFile(recent, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(ts.URL+"/api/previous-scans/cleanup", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /api/previous-scans/cleanup failed: %v", err)
+	}
+	var cleanup struct {
+		Removed []string `json:"removed"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&cleanup)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode cleanup response: %v", err)
+	}
+	if len(cleanup.Removed) != 1 || cleanup.Removed[0] != orphan {
+		t.Errorf("Removed %v, want only %s", cleanup.Removed, orphan)
+	}
+	if _, err := scan.GetScanResultByID(resultID); err != nil {
+		t.Errorf("Referenced result was removed: %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Result newer than the saved history was removed: %v", err)
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	isolateState(t)
+	ts := newTestServer(t)
+
+	dir := t.TempDir()
+	files := map[string]int{"a.txt": 100, "sub/b.txt": 200, "sub/deep/c.txt": 300}
+	for name, size := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scanAndWait(t, ts, dir)
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Content type = %q, want text/plain", resp.Header.Get("Content-Type"))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(data)
+
+	root := scan.PreviousScans[0].Path
+	expected := []string{
+		`storage_shower_directory_size_bytes{root="` + root + `",path="` + root + `"} 600`,
+		`storage_shower_directory_size_bytes{root="` + root + `",path="` + filepath.Join(root, "sub", "deep") + `"} 300`,
+		`storage_shower_directory_files{root="` + root + `",path="` + filepath.Join(root, "sub") + `"} 2`,
+		`storage_shower_last_scan_errors{root="` + root + `"} 0`,
+		"# TYPE storage_shower_scans_total counter",
+		"storage_shower_scan_in_progress 0",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Metrics are missing %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got, want := escapeLabel("a\\b\"c\nd"), `a\\b\"c\nd`; got != want {
+		t.Errorf("escapeLabel() = %s, want %s", got, want)
+	}
+}
+
+func TestHandleScan_RecordsErrors(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("Needs permissions that deny reading a directory")
+	}
+	isolateState(t)
+	ts := newTestServer(t)
+
+	dir := t.TempDir()
+	private := filepath.Join(dir, "private")
+	if err := os.MkdirAll(filepath.Join(private, "inner"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(private, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(private, 0755)
+	scanAndWait(t, ts, dir)
+
+	resp, err := http.Get(ts.URL + "/api/results")
+	if err != nil {
+		t.Fatalf("GET /api/results failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var result fileinfo.FileInfo
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+
+	if result.ErrorCount != 1 || len(result.Errors) != 1 {
+		t.Fatalf("Errors = %+v (count %d), want one", result.Errors, result.ErrorCount)
+	}
+	if scanErr := result.Errors[0]; filepath.Base(scanErr.Path) != "private" || scanErr.Op != "readdir" || scanErr.Errno == 0 {
+		t.Errorf("Error = %+v, want a readdir error for private", scanErr)
+	}
+	if !result.Incomplete {
+		t.Error("Root should be marked incomplete")
+	}
+	for _, child := range result.Children {
+		if child.Incomplete != (child.Name == "private") {
+			t.Errorf("%s incomplete = %v", child.Name, child.Incomplete)
+		}
+	}
+}
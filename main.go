@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/steezeburger/storage-shower/internal/alerts"
+	"github.com/steezeburger/storage-shower/internal/config"
+	"github.com/steezeburger/storage-shower/internal/fileinfo"
 	"github.com/steezeburger/storage-shower/internal/scan"
 	"github.com/steezeburger/storage-shower/internal/server"
+	"github.com/steezeburger/storage-shower/pkg/utils"
 )
 
 //go:embed web
@@ -17,13 +24,81 @@ var webFS embed.FS
 
 var debugMode = false
 
+// How long to wait for requests and scans to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// Exit codes of a scan run with --scan
+const (
+	exitScanFailed = 1
+	exitViolations = 2
+)
+
 // Debug flag to control verbose logging
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		os.Exit(runAgent(os.Args[2:]))
+	}
+
 	// Parse command line flags
+	defaults := config.Default()
+	flagConfig := defaults
+	var configPath, scanPath string
+	var readTimeout time.Duration
+	var scanImage, scanGitHistory bool
 	flag.BoolVar(&debugMode, "debug", false, "Enable debug mode")
+	flag.StringVar(&configPath, "config", os.Getenv("STORAGE_SHOWER_CONFIG"),
+		"Path to the config file (env STORAGE_SHOWER_CONFIG, default ~/.config/storage-shower/config.json)")
+	flag.StringVar(&flagConfig.Addr, "addr", defaults.Addr,
+		"Address to bind to (env STORAGE_SHOWER_ADDR)")
+	flag.IntVar(&flagConfig.Port, "port", defaults.Port,
+		"Port to listen on, 0 picks a free port (env STORAGE_SHOWER_PORT)")
+	flag.StringVar(&flagConfig.Socket, "socket", defaults.Socket,
+		"Listen on a Unix domain socket instead of TCP (env STORAGE_SHOWER_SOCKET)")
+	flag.BoolVar(&flagConfig.OpenBrowser, "open", defaults.OpenBrowser,
+		"Open the UI in the default browser (env STORAGE_SHOWER_OPEN)")
+	flag.StringVar(&flagConfig.Token, "token", defaults.Token,
+		"Access token required for the API; generated when binding to a non-loopback address (env STORAGE_SHOWER_TOKEN)")
+	flag.StringVar(&flagConfig.IngestToken, "ingest-token", defaults.IngestToken,
+		"Token agents upload scan results with; uploads are refused without one (env STORAGE_SHOWER_INGEST_TOKEN)")
+	flag.IntVar(&flagConfig.Workers, "workers", defaults.Workers,
+		"Number of directories read concurrently (env STORAGE_SHOWER_WORKERS)")
+	flag.DurationVar(&readTimeout, "read-timeout", time.Duration(defaults.ReadTimeout),
+		"Time a directory read may go without progress before it's skipped as timed out, 0 waits forever (env STORAGE_SHOWER_READ_TIMEOUT)")
+	flag.StringVar(&scanPath, "scan", "",
+		"Scan this directory, check the alert rules and exit instead of serving the UI; exits with 2 on violations")
+	flag.BoolVar(&scanImage, "image", false,
+		"Read the --scan path as a container image, an OCI image layout directory or a docker save tarball")
+	flag.BoolVar(&scanGitHistory, "git-history", false,
+		"Read the --scan path as a git repository and size its history by the paths that introduced each object")
 	flag.Parse()
 
+	// Resolve configuration: flags > environment > config file > defaults
+	cfg, configPath := loadConfig(configPath)
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr = flagConfig.Addr
+		case "port":
+			cfg.Port = flagConfig.Port
+		case "socket":
+			cfg.Socket = flagConfig.Socket
+		case "open":
+			cfg.OpenBrowser = flagConfig.OpenBrowser
+		case "token":
+			cfg.Token = flagConfig.Token
+		case "ingest-token":
+			cfg.IngestToken = flagConfig.IngestToken
+		case "workers":
+			cfg.Workers = flagConfig.Workers
+		case "read-timeout":
+			cfg.ReadTimeout = utils.Duration(readTimeout)
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Set debug mode for scan package
 	scan.DebugMode = debugMode
 
@@ -32,20 +107,129 @@ func main() {
 		log.Printf("Debug mode enabled")
 	}
 
-	// Start server with embedded web files
-	port := server.StartServer(webFS)
+	if scanPath != "" {
+		os.Exit(runScan(scanPath, scan.Options{Image: scanImage, GitHistory: scanGitHistory}, cfg))
+	}
 
-	// Log server information
-	log.Printf("Server started on port %d", port)
-	if debugMode {
-		log.Printf("Debug mode enabled")
+	// Create server with embedded web files
+	srv, err := server.NewServer(webFS, server.Options{
+		Addr:        cfg.Addr,
+		Port:        cfg.Port,
+		Socket:      cfg.Socket,
+		OpenBrowser: cfg.OpenBrowser,
+		Token:       cfg.Token,
+		IngestToken: cfg.IngestToken,
+		Config:      config.NewStore(configPath, cfg),
+	})
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
 	}
 
+	// Log server information
+	log.Printf("Server started at %s", srv.URL())
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve()
+	}()
+
 	// Set up signal handling for graceful shutdown
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Wait for termination signal
-	<-signalChan
-	log.Printf("Received termination signal, shutting down...")
+	// Wait for termination signal or a server failure
+	select {
+	case <-signalChan:
+		log.Printf("Received termination signal, shutting down...")
+	case err := <-serveErr:
+		log.Fatalf("Server failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown did not complete cleanly: %v", err)
+	}
+	log.Printf("Server stopped")
+}
+
+// loadConfig returns the configuration of the config file at configPath,
+// or at the default location if empty, with the environment applied, and
+// the path it was read from
+func loadConfig(configPath string) (config.Config, string) {
+	if configPath == "" {
+		path, err := config.DefaultPath()
+		if err != nil {
+			log.Printf("Warning: Cannot determine config file location: %v", err)
+		}
+		configPath = path
+	}
+	cfg := config.Default()
+	if configPath != "" {
+		if err := cfg.LoadFile(configPath); err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+	}
+	cfg.ApplyEnv(os.LookupEnv)
+	return cfg, configPath
+}
+
+// prepareScans loads the scan history and applies the retention and file
+// type settings for scans run without the server
+func prepareScans(cfg config.Config) {
+	scan.LoadPreviousScans()
+	scan.SetHistoryRetention(cfg.HistoryRetention)
+	scan.SetRetentionPolicies(cfg.Retention)
+	configureCategories(cfg)
+}
+
+// configureCategories applies the file type categories of cfg
+func configureCategories(cfg config.Config) {
+	if err := fileinfo.ConfigureCategories(cfg.Categories, cfg.FileTypes); err != nil {
+		log.Printf("Warning: Cannot apply file type categories: %v", err)
+	}
+}
+
+// runScan scans a directory, container image or git history from the
+// command line with what opts selects, prints its size and any alert rule
+// violations, and returns the process exit code
+func runScan(path string, opts scan.Options, cfg config.Config) int {
+	prepareScans(cfg)
+
+	startedAt := time.Now()
+	opts.Excludes = cfg.Excludes
+	opts.Workers = cfg.Workers
+	opts.SniffContent = cfg.SniffContent
+	opts.ReadTimeout = time.Duration(cfg.ReadTimeout)
+	opts.ExpandArchives = cfg.ExpandArchives
+	root, err := scan.ScanDirectory(path, opts)
+	if err != nil {
+		log.Printf("Scan failed: %v", err)
+		return exitScanFailed
+	}
+	fmt.Printf("%s: %s in %d files\n", root.Path, fileinfo.FormatBytes(root.Size), root.FileCount)
+	if opts.GitHistory {
+		fmt.Printf("  %d objects holding %s of content\n", root.Objects, fileinfo.FormatBytes(root.UncompressedSize))
+	}
+	if root.Image != nil {
+		for i, layer := range root.Image.Layers {
+			step := layer.CreatedBy
+			if step == "" {
+				step = layer.Digest
+			}
+			fmt.Printf("  layer %d: %s of %s still visible, %s\n", i+1, fileinfo.FormatBytes(layer.VisibleSize),
+				fileinfo.FormatBytes(layer.UncompressedSize), step)
+		}
+	}
+
+	report := alerts.Check(cfg.AlertRules, &root, startedAt)
+	for _, violation := range report.Violations {
+		fmt.Printf("ALERT [%s] %s\n", violation.Rule, violation.Message)
+	}
+	alerts.Hooks{Webhook: cfg.AlertWebhook, Command: cfg.AlertCommand}.Notify(report)
+
+	if len(report.Violations) > 0 {
+		return exitViolations
+	}
+	return 0
 }
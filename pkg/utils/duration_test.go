@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDuration_JSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		valid    bool
+	}{
+		{`"24h"`, 24 * time.Hour, true},
+		{`"1h30m"`, 90 * time.Minute, true},
+		{`90`, 90 * time.Second, true},
+		{`"soon"`, 0, false},
+		{`true`, 0, false},
+	}
+
+	for _, test := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(test.input), &d)
+		if test.valid != (err == nil) {
+			t.Errorf("Unmarshal(%s) error = %v, want valid %v", test.input, err, test.valid)
+			continue
+		}
+		if test.valid && time.Duration(d) != test.expected {
+			t.Errorf("Unmarshal(%s) = %v, want %v", test.input, time.Duration(d), test.expected)
+		}
+	}
+
+	data, err := json.Marshal(Duration(36 * time.Hour))
+	if err != nil || string(data) != `"36h0m0s"` {
+		t.Errorf("Marshal = %s, %v, want \"36h0m0s\"", data, err)
+	}
+}
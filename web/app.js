@@ -1,118 +1,363 @@
+// Render the top extensions table
+function renderExtensionStats(stats, totalSize) {
+  if (!stats.extensions || stats.extensions.length === 0) {
+    extensionStatsContainer.classList.add("hidden");
+    return;
+  }
+
+  renderTableRows(
+    extensionStatsBody,
+    stats.extensions.map((ext) => {
+      const share = totalSize > 0 ? ((ext.bytes / totalSize) * 100).toFixed(1) : "0.0";
+      return [
+        ext.extension ? `.${ext.extension}` : "(none)",
+        formatBytes(ext.bytes),
+        ext.files.toLocaleString(),
+        `${share}%`,
+      ];
+    })
+  );
+
+  extensionStatsContainer.classList.remove("hidden");
+}
+
+// Fetch and show the age histogram of a directory
+async function fetchAgeStats(item) {
+  if (!item.isDir) {
+    ageStatsContainer.classList.add("hidden");
+    return;
+  }
+
+  const path = item.path;
+  const params = new URLSearchParams({ path });
+  if (currentResultId) {
+    params.set("id", currentResultId);
+  }
+
+  try {
+    const response = await fetch(`/api/age?${params}`);
+    if (!response.ok) {
+      throw new Error(`Server responded with ${response.status}: ${response.statusText}`);
+    }
+    const histogram = await response.json();
+
+    // Ignore responses for items that are no longer selected
+    if (selectedPathText.textContent !== path) {
+      return;
+    }
+
+    const buckets = histogram.buckets.filter((bucket) => bucket.files > 0);
+    if (buckets.length === 0) {
+      ageStatsContainer.classList.add("hidden");
+      return;
+    }
+    renderTableRows(
+      ageStatsBody,
+      buckets.map((bucket) => [
+        bucket.label,
+        formatBytes(bucket.bytes),
+        bucket.files.toLocaleString(),
+      ])
+    );
+    ageStatsContainer.classList.remove("hidden");
+  } catch (error) {
+    console.error("Error fetching age stats:", error);
+    ageStatsContainer.classList.add("hidden");
+  }
+}
+
+// Find directory trees nobody has touched for a while in the current result
+async function findStaleData() {
+  const params = new URLSearchParams({
+    field: staleFieldSelect.value,
+    days: staleDaysInput.value || "0",
+    minSize: Math.round(parseFloat(staleMinSizeInput.value || "0") * 1024 ** 3),
+  });
+  if (currentResultId) {
+    params.set("id", currentResultId);
+  }
+
+  try {
+    const response = await fetch(`/api/stale?${params}`);
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    const report = await response.json();
+    const subtrees = report.subtrees || [];
+
+    staleSummary.textContent =
+      subtrees.length > 0
+        ? `${formatBytes(report.totalBytes)} in ${subtrees.length} stale directories`
+        : "No stale directories found";
+    renderTableRows(
+      staleTableBody,
+      subtrees.map((subtree) => [
+        subtree.path,
+        formatBytes(subtree.size),
+        subtree.files.toLocaleString(),
+        `${subtree.ageDays.toLocaleString()} days`,
+      ])
+    );
+    staleTable.classList.toggle("hidden", subtrees.length === 0);
+  } catch (error) {
+    alert("Error finding stale data: " + error.message);
+  }
+}
+
+// Find empty directories, zero-byte files and broken links in the current result
+async function findEmptyItems() {
+  const params = new URLSearchParams();
+  if (currentResultId) {
+    params.set("id", currentResultId);
+  }
+
+  try {
+    const response = await fetch(`/api/cleanup?${params}`);
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    renderCleanupReport(await response.json());
+  } catch (error) {
+    alert("Error finding empty items: " + error.message);
+  }
+}
+
+// Show a cleanup report, listing up to 100 items of each kind
+function renderCleanupReport(report) {
+  const lists = {
+    emptyDirs: report.emptyDirs,
+    emptyFiles: report.emptyFiles,
+    brokenLinks: report.brokenLinks.map((link) => `${link.path} -> ${link.target}`),
+  };
+
+  Object.entries(cleanupKinds).forEach(([kind, id]) => {
+    const items = lists[kind];
+    document.getElementById(`${id}-count`).textContent = items.length.toLocaleString();
+
+    const list = document.getElementById(`${id}-list`);
+    list.innerHTML = "";
+    items.slice(0, 100).forEach((text) => {
+      const item = document.createElement("li");
+      item.textContent = text;
+      list.appendChild(item);
+    });
+    if (items.length > 100) {
+      const more = document.createElement("li");
+      more.textContent = `... and ${items.length - 100} more`;
+      list.appendChild(more);
+    }
+  });
+
+  const total = report.emptyDirCount + report.emptyFileCount + report.brokenLinkCount;
+  cleanupSummary.textContent = `${total.toLocaleString()} empty items under ${report.path}`;
+  cleanupResults.classList.toggle("hidden", total === 0);
+}
+
+// Remove the selected kinds of empty items from disk
+async function removeEmptyItems() {
+  const request = { id: currentResultId || "" };
+  Object.entries(cleanupKinds).forEach(([kind, id]) => {
+    request[kind] = document.getElementById(id).checked;
+  });
+  if (!request.emptyDirs && !request.emptyFiles && !request.brokenLinks) {
+    alert("Select the kinds of items to remove");
+    return;
+  }
+  if (!confirm("Permanently remove the selected items from disk?")) {
+    return;
+  }
+
+  try {
+    const response = await fetch("/api/cleanup", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify(request),
+    });
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    const report = await response.json();
+    const { removed, errors } = report.result;
+    let message = `Removed ${removed.length} items.`;
+    if (errors.length > 0) {
+      message += ` ${errors.length} items were kept, e.g. ${errors[0].path}: ${errors[0].error}`;
+    }
+    alert(message + " Rescan to update the results.");
+  } catch (error) {
+    alert("Error removing empty items: " + error.message);
+  }
+}
+
+// Show the entries the scan couldn't read and the bytes they possibly hid
+function renderScanErrors(result) {
+  const errors = result.errors || [];
+  errorsPanel.classList.toggle("hidden", errors.length === 0);
+  if (errors.length === 0) {
+    return;
+  }
+
+  const count = result.errorCount || errors.length;
+  errorsCount.textContent = count.toLocaleString();
+  let summary = `${count.toLocaleString()} entries could not be read, so the totals may be too low.`;
+  if (result.missingBytes) {
+    summary += ` The previous scan found ${formatBytes(result.missingBytes)} in them.`;
+  }
+  if (count > errors.length) {
+    summary += ` Showing the first ${errors.length.toLocaleString()}.`;
+  }
+  errorsSummary.textContent = summary;
+
+  renderTableRows(
+    errorsTable.querySelector("tbody"),
+    errors.map((error) => [
+      error.path,
+      error.op,
+      error.message,
+      error.missingBytes ? formatBytes(error.missingBytes) : "unknown",
+    ]),
+  );
+}
+
+// Replace the rows of a table body with rows of text cells
+function renderTableRows(tbody, rows) {
+  tbody.innerHTML = "";
+  rows.forEach((cells) => {
+    const row = document.createElement("tr");
+    cells.forEach((text) => {
+      const cell = document.createElement("td");
+      cell.textContent = text;
+      row.appendChild(cell);
+    });
+    tbody.appendChild(row);
+  });
+}
+
 // DOM Elements
 const pathInput = document.getElementById("path-input");
+const errorsPanel = document.getElementById("errors-panel");
+const errorsCount = document.getElementById("errors-count");
+const errorsSummary = document.getElementById("errors-summary");
+const errorsTable = document.getElementById("errors-table");
 const searchInput = document.getElementById("search-input");
 const browseBtn = document.getElementById("browse-btn");
 const homeBtn = document.getElementById("home-btn");
 const scanBtn = document.getElementById("scan-btn");
 const stopBtn = document.getElementById("stop-btn");
 const ignoreHiddenCheckbox = document.getElementById("ignore-hidden");
+const sniffContentCheckbox = document.getElementById("sniff-content");
+const expandArchivesCheckbox = document.getElementById("expand-archives");
+const scanImageCheckbox = document.getElementById("scan-image");
+const scanGitHistoryCheckbox = document.getElementById("scan-git-history");
 const vizTypeRadios = document.querySelectorAll('input[name="viz-type"]');
+const sizeByRadios = document.querySelectorAll('input[name="size-by"]');
+const colorByRadios = document.querySelectorAll('input[name="color-by"]');
 const progressContainer = document.getElementById("progress-container");
 const progressBarFill = document.getElementById("progress-bar-fill");
 const scannedItemsText = document.getElementById("scanned-items");
 const totalItemsText = document.getElementById("total-items");
 const progressPercentText = document.getElementById("progress-percent");
+const scanRateText = document.getElementById("scan-rate");
 const currentPathText = document.getElementById("current-path");
 const visualizationContainer = document.getElementById("visualization");
 const selectedPathText = document.getElementById("selected-path");
 const selectedSizeText = document.getElementById("selected-size");
 const selectedTypeText = document.getElementById("selected-type");
+const selectedMetaText = document.getElementById("selected-meta");
+const extensionStatsContainer = document.getElementById("extension-stats");
+const extensionStatsBody = document.querySelector("#extension-stats-table tbody");
+const ageStatsContainer = document.getElementById("age-stats");
+const ageStatsBody = document.querySelector("#age-stats-table tbody");
+const staleFieldSelect = document.getElementById("stale-field");
+const staleDaysInput = document.getElementById("stale-days");
+const staleMinSizeInput = document.getElementById("stale-min-size");
+const staleFindBtn = document.getElementById("stale-find-btn");
+const staleSummary = document.getElementById("stale-summary");
+const staleTable = document.getElementById("stale-table");
+const staleTableBody = document.querySelector("#stale-table tbody");
+const cleanupFindBtn = document.getElementById("cleanup-find-btn");
+const cleanupRemoveBtn = document.getElementById("cleanup-remove-btn");
+const cleanupSummary = document.getElementById("cleanup-summary");
+const cleanupResults = document.getElementById("cleanup-results");
+
+// Kinds of empty items, keyed by the cleanup API's field names
+const cleanupKinds = {
+  emptyDirs: "cleanup-empty-dirs",
+  emptyFiles: "cleanup-empty-files",
+  brokenLinks: "cleanup-broken-links",
+};
 const breadcrumbTrail = document.getElementById("breadcrumb-trail");
 const previousScansContainer = document.getElementById("previous-scans-container");
 const previousScansList = document.getElementById("previous-scans-list");
+const hostSelect = document.getElementById("host-select");
 const searchResultsContainer = document.getElementById("search-results-container");
 const searchResultsCount = document.getElementById("search-results-count");
 const searchResultsList = document.getElementById("search-results-list");
 const legendItems = document.querySelector(".legend-items");
+const legendTitle = document.getElementById("color-legend-title");
 const zoomControls = document.getElementById("zoom-controls");
 const zoomInBtn = document.getElementById("zoom-in-btn");
 const zoomOutBtn = document.getElementById("zoom-out-btn");
 const zoomResetBtn = document.getElementById("zoom-reset-btn");
+const settingsScanRoots = document.getElementById("settings-scan-roots");
+const settingsExcludes = document.getElementById("settings-excludes");
+const settingsRetention = document.getElementById("settings-retention");
+const settingsWorkers = document.getElementById("settings-workers");
+const settingsReadTimeout = document.getElementById("settings-read-timeout");
+const settingsSaveBtn = document.getElementById("settings-save-btn");
+const settingsPathText = document.getElementById("settings-path");
 
 // Application state
 let currentData = null;
+let currentResultId = null;
+let extensionStatsRequest = 0;
 let currentPath = [];
 let vizType = "treemap";
+let sizeBy = "bytes";
+let colorBy = "type";
 // scanning state is managed by UI updates
 let progressInterval = null;
+let progressSource = null;
+let streamedSearchResults = [];
 let previousScans = [];
+// Host whose scans are listed: "*" for all, "" for this server
+let selectedHost = "*";
 let currentZoom = null;
+let currentConfig = null;
 
-// File type colors
+// File type colors, filled in from the server's category registry
 const typeColors = {
   directory: "#5b9bd5",
-  image: "#e74c3c",
-  video: "#9b59b6",
-  audio: "#2ecc71",
-  document: "#f39c12",
-  archive: "#f1c40f",
   other: "#95a5a6",
 };
 
-// Map file extensions to types
-const fileTypeMappings = {
-  // Images
-  jpg: "image",
-  jpeg: "image",
-  png: "image",
-  gif: "image",
-  webp: "image",
-  svg: "image",
-  bmp: "image",
-  tiff: "image",
-  ico: "image",
-  heic: "image",
-
-  // Videos
-  mp4: "video",
-  avi: "video",
-  mov: "video",
-  wmv: "video",
-  mkv: "video",
-  webm: "video",
-  flv: "video",
-  m4v: "video",
-  mpg: "video",
-  mpeg: "video",
-
-  // Audio
-  mp3: "audio",
-  wav: "audio",
-  ogg: "audio",
-  flac: "audio",
-  aac: "audio",
-  m4a: "audio",
-  wma: "audio",
-  opus: "audio",
-
-  // Documents
-  pdf: "document",
-  doc: "document",
-  docx: "document",
-  xls: "document",
-  xlsx: "document",
-  ppt: "document",
-  pptx: "document",
-  txt: "document",
-  rtf: "document",
-  md: "document",
-  csv: "document",
-  json: "document",
-  xml: "document",
-  html: "document",
-  htm: "document",
-
-  // Archives
-  zip: "archive",
-  rar: "archive",
-  "7z": "archive",
-  tar: "archive",
-  gz: "archive",
-  bz2: "archive",
-  xz: "archive",
-  iso: "archive",
-  dmg: "archive",
-};
+// File age buckets, matching the server's age histogram, youngest first
+const ageBuckets = [
+  { label: "< 1 week", maxDays: 7 },
+  { label: "< 1 month", maxDays: 30 },
+  { label: "< 3 months", maxDays: 90 },
+  { label: "< 6 months", maxDays: 180 },
+  { label: "< 1 year", maxDays: 365 },
+  { label: "< 2 years", maxDays: 730 },
+  { label: "< 5 years", maxDays: 1825 },
+  { label: "5+ years", maxDays: 0 },
+];
+const ageColors = d3.schemeRdYlGn[ageBuckets.length].slice().reverse();
+
+// Owner colors, assigned by usage when a scan result is loaded
+const ownerColors = {};
+let ownerOrder = [];
+
+// Layer colors by layer number, assigned when an image scan result is loaded
+const layerColors = {};
+let imageLayers = [];
+
+// Category names in registry order, used for legends and breakdowns
+let categoryOrder = ["other"];
+
+// Map file extensions to types, filled in from the server's category registry
+const fileTypeMappings = {};
 
 // Initialize the application
 function init() {
@@ -125,6 +370,24 @@ function init() {
   // Set up search input event listener
   searchInput.addEventListener("input", handleSearchInput);
 
+  // Filter previous scans by the machine that ran them
+  hostSelect.addEventListener("change", () => {
+    selectedHost = hostSelect.value;
+    displayPreviousScans();
+  });
+
+  // A path is read as a container image or a git history, not both
+  scanImageCheckbox.addEventListener("change", () => {
+    if (scanImageCheckbox.checked) {
+      scanGitHistoryCheckbox.checked = false;
+    }
+  });
+  scanGitHistoryCheckbox.addEventListener("change", () => {
+    if (scanGitHistoryCheckbox.checked) {
+      scanImageCheckbox.checked = false;
+    }
+  });
+
   // Listen for visualization type changes
   vizTypeRadios.forEach((radio) => {
     radio.addEventListener("change", (e) => {
@@ -143,6 +406,27 @@ function init() {
     });
   });
 
+  // Listen for changes between sizing by bytes and by item count
+  sizeByRadios.forEach((radio) => {
+    radio.addEventListener("change", (e) => {
+      sizeBy = e.target.value;
+      if (currentData) {
+        renderVisualization(currentData);
+      }
+    });
+  });
+
+  // Listen for changes between coloring by file type, owner, age and layer
+  colorByRadios.forEach((radio) => {
+    radio.addEventListener("change", (e) => {
+      colorBy = e.target.value;
+      initializeColorLegend();
+      if (currentData) {
+        renderVisualization(currentData);
+      }
+    });
+  });
+
   // Set up zoom control event listeners
   zoomInBtn.addEventListener("click", () => {
     if (currentZoom) {
@@ -168,14 +452,20 @@ function init() {
   // Set up click handler for path text to copy
   selectedPathText.addEventListener("click", copyPathToClipboard);
 
-  // Set initial home directory
-  setHomeDirectory();
+  // Set up settings
+  settingsSaveBtn.addEventListener("click", saveSettings);
+  staleFindBtn.addEventListener("click", findStaleData);
+  cleanupFindBtn.addEventListener("click", findEmptyItems);
+  cleanupRemoveBtn.addEventListener("click", removeEmptyItems);
+
+  // Load configuration, which also picks the initial scan path
+  fetchConfig();
 
   // Fetch previous scans
   fetchPreviousScans();
 
-  // Initialize color legend
-  initializeColorLegend();
+  // Load file type categories, which also builds the color legend
+  fetchFileTypes();
 
   // Set up keyboard shortcuts
   document.addEventListener("keydown", (e) => {
@@ -192,6 +482,114 @@ function init() {
   });
 }
 
+// Fetch the server configuration and apply it to the UI
+async function fetchConfig() {
+  try {
+    const response = await fetch("/api/config");
+    if (!response.ok) {
+      throw new Error(`Server responded with ${response.status}: ${response.statusText}`);
+    }
+
+    applyConfig(await response.json());
+  } catch (error) {
+    // Fall back to the home directory without configuration
+    setHomeDirectory();
+    return;
+  }
+
+  // Start from the first configured scan root, or the home directory
+  if (currentConfig.scanRoots && currentConfig.scanRoots.length > 0) {
+    pathInput.value = currentConfig.scanRoots[0];
+  } else {
+    setHomeDirectory();
+  }
+}
+
+// Apply configuration to the UI state and settings form
+function applyConfig(config) {
+  currentConfig = config;
+
+  settingsScanRoots.value = (config.scanRoots || []).join("\n");
+  settingsExcludes.value = (config.excludes || []).join("\n");
+  settingsRetention.value = config.historyRetention;
+  settingsWorkers.value = config.workers;
+  settingsReadTimeout.value = config.readTimeout || "0s";
+  sniffContentCheckbox.checked = !!config.sniffContent;
+  expandArchivesCheckbox.checked = !!config.expandArchives;
+  settingsPathText.textContent = config.configPath ? `Saved to ${config.configPath}` : "";
+}
+
+// Save the settings form to the server
+async function saveSettings() {
+  const lines = (text) =>
+    text
+      .split("\n")
+      .map((line) => line.trim())
+      .filter((line) => line !== "");
+
+  const settings = {
+    scanRoots: lines(settingsScanRoots.value),
+    excludes: lines(settingsExcludes.value),
+    historyRetention: parseInt(settingsRetention.value, 10),
+    workers: parseInt(settingsWorkers.value, 10),
+    readTimeout: settingsReadTimeout.value.trim() || "0s",
+  };
+
+  try {
+    const response = await fetch("/api/config", {
+      method: "PUT",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify(settings),
+    });
+
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+
+    applyConfig(await response.json());
+    settingsPathText.textContent = "Settings saved";
+
+    // Category mappings may have changed
+    fetchFileTypes();
+  } catch (error) {
+    alert("Error saving settings: " + error.message);
+  }
+}
+
+// Fetch the file type categories and rebuild colors and the legend
+async function fetchFileTypes() {
+  try {
+    const response = await fetch("/api/file-types");
+    if (!response.ok) {
+      throw new Error(`Server responded with ${response.status}: ${response.statusText}`);
+    }
+
+    const categories = await response.json();
+
+    categoryOrder = categories.map((category) => category.name);
+    Object.keys(fileTypeMappings).forEach((ext) => delete fileTypeMappings[ext]);
+    categories.forEach((category) => {
+      typeColors[category.name] = category.color;
+      (category.extensions || []).forEach((ext) => {
+        const key = ext.replace(/^\./, "").toLowerCase();
+        if (!fileTypeMappings[key]) {
+          fileTypeMappings[key] = category.name;
+        }
+      });
+    });
+  } catch (error) {
+    // Keep the built-in colors if categories can't be loaded
+  }
+
+  initializeColorLegend();
+
+  if (currentData) {
+    renderVisualization(currentData);
+  }
+}
+
 // Browse for a directory
 async function browseDirectory() {
   try {
@@ -239,6 +637,10 @@ async function startScan() {
   const requestData = {
     path: path,
     ignoreHidden: ignoreHiddenCheckbox.checked,
+    sniffContent: sniffContentCheckbox.checked,
+    expandArchives: expandArchivesCheckbox.checked,
+    image: scanImageCheckbox.checked,
+    gitHistory: scanGitHistoryCheckbox.checked,
     searchTerm: searchInput.value.trim(),
   };
 
@@ -261,8 +663,8 @@ async function startScan() {
 
     await response.json();
 
-    // Start polling for scan progress
-    progressInterval = setInterval(pollScanProgress, 500);
+    // Follow scan progress
+    watchScanProgress();
   } catch (error) {
     // Handle error when starting scan
     alert("Error starting scan: " + error.message);
@@ -271,60 +673,151 @@ async function startScan() {
   }
 }
 
+// Follow scan progress, preferring the event stream over polling
+function watchScanProgress() {
+  streamedSearchResults = [];
+
+  if (typeof EventSource === "undefined") {
+    startPolling();
+    return;
+  }
+
+  progressSource = new EventSource("/api/scan/events");
+
+  progressSource.addEventListener("status", (event) => {
+    const data = JSON.parse(event.data);
+
+    // The stream sends only matches found since the previous event
+    if (data.newSearchResults) {
+      streamedSearchResults = streamedSearchResults.concat(data.newSearchResults);
+    }
+    data.progress.searchResults = streamedSearchResults;
+
+    handleProgressUpdate(data);
+  });
+
+  progressSource.onerror = () => {
+    // Fall back to polling if the stream is unavailable or drops
+    stopWatchingProgress();
+    startPolling();
+  };
+}
+
+// Start polling for scan progress
+function startPolling() {
+  progressInterval = setInterval(pollScanProgress, 500);
+}
+
+// Stop following scan progress
+function stopWatchingProgress() {
+  if (progressSource) {
+    progressSource.close();
+    progressSource = null;
+  }
+  if (progressInterval) {
+    clearInterval(progressInterval);
+    progressInterval = null;
+  }
+}
+
 // Poll for scan progress
 async function pollScanProgress() {
   try {
     const response = await fetch("/api/scan/status");
     const data = await response.json();
+    handleProgressUpdate(data);
+  } catch (error) {
+    // Handle error when polling for scan progress
+  }
+}
 
-    if (!data.inProgress) {
-      // Scan is complete or was stopped
-      clearInterval(progressInterval);
-      progressInterval = null;
-      updateScanningUI(false);
+// Update the UI from a scan status update
+function handleProgressUpdate(data) {
+  if (!data.progress.inProgress) {
+    // Scan is complete or was stopped
+    stopWatchingProgress();
+    updateScanningUI(false);
 
-      // Wait a moment to ensure the data is ready, then fetch the result
-      setTimeout(fetchScanResult, 500);
-      return;
+    // Wait a moment to ensure the data is ready, then fetch the result
+    setTimeout(fetchScanResult, 500);
+    return;
+  }
+
+  // Update progress UI
+  const progress = data.progress;
+  scannedItemsText.textContent = progress.scannedItems;
+  totalItemsText.textContent = progress.totalItems;
+  const percentage = (progress.progress * 100).toFixed(1);
+  progressPercentText.textContent = percentage + "%";
+  progressBarFill.style.width = percentage + "%";
+  currentPathText.textContent = progress.currentPath;
+  scanRateText.textContent = `${formatBytes(progress.bytesScanned)} seen, ${Math.round(
+    progress.itemsPerSec || 0
+  )} items/s, ${formatBytes(Math.round(progress.bytesPerSec || 0))}/s`;
+
+  // Update search results if search term is provided
+  if (progress.searchTerm && progress.searchResults) {
+    updateSearchResults(progress.searchResults, progress.searchTerm);
+  }
+
+  // Check if scan is stalled
+  if (progress.stalled) {
+    // Alert user that scan appears to be stalled
+    const stalledPath = progress.stalledPath || progress.currentPath;
+    const stalledMsg = `STALLED: ${stalledPath}`;
+    currentPathText.innerHTML = "";
+    const styledMsg = document.createElement("span");
+    styledMsg.style.color = "orange";
+    styledMsg.style.fontWeight = "bold";
+    styledMsg.textContent = stalledMsg;
+    currentPathText.appendChild(styledMsg);
+
+    // Show options to skip the blocked directory or stop the scan
+    let warningEl = document.getElementById("stall-warning");
+    if (!warningEl) {
+      warningEl = document.createElement("div");
+      warningEl.id = "stall-warning";
+      warningEl.className = "stall-warning";
+      warningEl.innerHTML = `<p class="stall-message"></p>
+         <p><button id="skip-path-btn" class="btn btn-warning">Skip</button>
+         <button id="restart-scan-btn" class="btn btn-warning">Stop Scan</button> or wait</p>`;
+      progressContainer.appendChild(warningEl);
+      document.getElementById("skip-path-btn").addEventListener("click", () => {
+        skipPath(warningEl.dataset.path);
+      });
+      document.getElementById("restart-scan-btn").addEventListener("click", stopScan);
     }
 
-    // Update progress UI
-    const progress = data.progress;
-    scannedItemsText.textContent = progress.scannedItems;
-    totalItemsText.textContent = progress.totalItems;
-    const percentage = (progress.progress * 100).toFixed(1);
-    progressPercentText.textContent = percentage + "%";
-    progressBarFill.style.width = percentage + "%";
-    currentPathText.textContent = progress.currentPath;
-
-    // Update search results if search term is provided
-    if (progress.searchTerm && progress.searchResults) {
-      updateSearchResults(progress.searchResults, progress.searchTerm);
+    const message = warningEl.querySelector(".stall-message");
+    const skipButton = document.getElementById("skip-path-btn");
+    if (progress.stalledPath) {
+      warningEl.dataset.path = progress.stalledPath;
+      message.textContent = `Waiting on ${progress.stalledPath} for ${Math.round(progress.stalledFor || 0)} s.`;
+      skipButton.style.display = "";
+    } else {
+      delete warningEl.dataset.path;
+      message.textContent = "Scan stalled processing large files or directories.";
+      skipButton.style.display = "none";
     }
+  } else if (document.getElementById("stall-warning")) {
+    // Remove stall warning if scan is no longer stalled
+    document.getElementById("stall-warning").remove();
+  }
+}
 
-    // Check if scan is stalled
-    if (data.stalled) {
-      // Alert user that scan appears to be stalled
-      const stalledMsg = `STALLED: ${progress.currentPath}`;
-      const styledMsg = `<span style="color: orange; font-weight: bold;">${stalledMsg}</span>`;
-      currentPathText.innerHTML = styledMsg;
-
-      // Show option to stop scan if stalled
-      if (!document.getElementById("stall-warning")) {
-        const warningEl = document.createElement("div");
-        warningEl.id = "stall-warning";
-        warningEl.className = "stall-warning";
-        warningEl.innerHTML = `<p>Scan stalled processing large files or directories.</p>
-           <p><button id="restart-scan-btn" class="btn btn-warning">Stop Scan</button> or wait</p>`;
-        progressContainer.appendChild(warningEl);
-        document.getElementById("restart-scan-btn").addEventListener("click", stopScan);
-      }
-    } else if (document.getElementById("stall-warning")) {
-      // Remove stall warning if scan is no longer stalled
-      document.getElementById("stall-warning").remove();
+// Skip a directory the scan is blocked on and continue without it
+async function skipPath(path) {
+  try {
+    const response = await fetch("/api/scan/skip", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ path: path || "" }),
+    });
+    if (!response.ok) {
+      throw new Error(await response.text());
     }
   } catch (error) {
-    // Handle error when polling for scan progress
+    alert("Error skipping directory: " + error.message);
   }
 }
 
@@ -332,12 +825,6 @@ async function pollScanProgress() {
 async function stopScan() {
   try {
     await fetch("/api/scan/stop", { method: "POST" });
-
-    // Clear the progress interval
-    if (progressInterval) {
-      clearInterval(progressInterval);
-      progressInterval = null;
-    }
   } catch (error) {
     alert("Error stopping scan: " + error.message);
   }
@@ -369,6 +856,9 @@ async function fetchScanResult(resultId = null) {
 
     // Store the data
     currentData = result;
+    currentResultId = resultId;
+    assignLayerColors(result);
+    assignOwnerColors(result);
 
     // Render the visualization
     renderVisualization(result);
@@ -378,6 +868,7 @@ async function fetchScanResult(resultId = null) {
 
     // Update details panel with root directory
     updateDetailsPanel(result);
+    renderScanErrors(result);
 
     // Show the breadcrumb trail
     breadcrumbTrail.style.display = "block";
@@ -410,6 +901,7 @@ function updateScanningUI(isScanning) {
     scannedItemsText.textContent = "0";
     totalItemsText.textContent = "0";
     progressPercentText.textContent = "0.0%";
+    scanRateText.textContent = "";
     currentPathText.textContent = "Starting scan...";
 
     // Show search results container if search term is provided
@@ -457,6 +949,32 @@ function renderVisualization(data) {
   updateBreadcrumbs();
 }
 
+// Whether an item has children to navigate into: a directory, or an archive
+// whose members were listed
+function isContainer(item) {
+  return item.isDir || !!item.archive;
+}
+
+// Value of a node in the visualizations, depending on what they're sized by
+function nodeValue(d) {
+  if (sizeBy === "items") {
+    // Directories trimmed from the result stand in for everything below them
+    if (d.isDir && !(d.children && d.children.length > 0)) {
+      return 1 + (d.itemCount || 0);
+    }
+    return 1;
+  }
+  return d.size > 0 ? d.size : 0;
+}
+
+// Format a visualization value for display
+function formatValue(value) {
+  if (sizeBy === "items") {
+    return `${value.toLocaleString()} items`;
+  }
+  return formatBytes(value);
+}
+
 // Render treemap visualization
 function renderTreemap(data) {
   // Get dimensions
@@ -466,9 +984,7 @@ function renderTreemap(data) {
   // Create a hierarchy from the data
   const hierarchy = d3
     .hierarchy(data)
-    .sum(
-      (d) => (d.size > 0 ? d.size : 0) // Ensure we use all sizes, not just files
-    )
+    .sum((d) => nodeValue(d)) // Ensure we use all sizes, not just files
     .sort((a, b) => b.value - a.value);
 
   // Find the current node if navigating into a subdirectory
@@ -485,7 +1001,7 @@ function renderTreemap(data) {
     // Create a new hierarchy from the current node's data
     currentHierarchy = d3
       .hierarchy(currentNode.data)
-      .sum((d) => (d.size > 0 ? d.size : 0))
+      .sum((d) => nodeValue(d))
       .sort((a, b) => b.value - a.value);
   }
 
@@ -522,7 +1038,7 @@ function renderTreemap(data) {
     })
     .on("click", function (event, d) {
       // Navigate deeper on click if it's a directory
-      if (d.data.isDir && d.children && d.depth > 0) {
+      if (isContainer(d.data) && d.children && d.depth > 0) {
         // Create a new array with a copy of the current path plus the new item
         const newPath = [...currentPath];
         newPath.push(d.data.name);
@@ -548,6 +1064,9 @@ function renderTreemap(data) {
       return isNaN(height) || height < 0 ? 0 : height;
     })
     .attr("fill", (d) => {
+      if (colorBy !== "type") {
+        return getModeColor(d.data);
+      }
       if (d.data.isDir) {
         // For directories, use a standard color
         return typeColors.directory;
@@ -565,8 +1084,8 @@ function renderTreemap(data) {
         }
         return `url(#pattern-${d.data.name.replace(/\s+/g, "-")})`;
       } else {
-        // For files, color by extension
-        return getFileTypeColor(d.data.extension);
+        // For files, color by type
+        return getItemColor(d.data);
       }
     });
 
@@ -601,7 +1120,7 @@ function renderTreemap(data) {
     .append("text")
     .attr("x", 3)
     .attr("y", 30)
-    .text((d) => formatBytes(d.value))
+    .text((d) => formatValue(d.value))
     .attr("fill", "white")
     .attr("font-size", "10px")
     .attr("pointer-events", "none");
@@ -617,7 +1136,7 @@ function renderSunburst(data) {
   // Create a hierarchy from the data
   const hierarchy = d3
     .hierarchy(data)
-    .sum((d) => (d.isDir ? 0 : d.size))
+    .sum((d) => (isContainer(d) && sizeBy === "bytes" ? 0 : nodeValue(d)))
     .sort((a, b) => b.value - a.value);
 
   // If we're navigating to a subdirectory, filter the data
@@ -634,7 +1153,7 @@ function renderSunburst(data) {
     // Create a new hierarchy from the current node's data, making it the new root
     currentHierarchy = d3
       .hierarchy(currentNode.data)
-      .sum((d) => (d.size > 0 ? d.size : 0))
+      .sum((d) => nodeValue(d))
       .sort((a, b) => b.value - a.value);
   }
 
@@ -687,10 +1206,13 @@ function renderSunburst(data) {
     .append("path")
     .attr("class", "sunburst-path")
     .attr("fill", (d) => {
+      if (colorBy !== "type") {
+        return getModeColor(d.data);
+      }
       if (d.data.isDir) {
         return typeColors.directory;
       }
-      return getFileTypeColor(d.data.extension);
+      return getItemColor(d.data);
     })
     .attr("d", arc)
     .on("click", function (event, d) {
@@ -701,7 +1223,7 @@ function renderSunburst(data) {
       updateDetailsPanel(d.data);
 
       // Navigate deeper on click if it's a directory
-      if (d.data.isDir && d.children) {
+      if (isContainer(d.data) && d.children) {
         // Calculate the path based on ancestors
         const newPath = [];
         let current = d;
@@ -754,34 +1276,173 @@ function updateDetailsPanel(item) {
     let typeText = "Directory";
     if (item.fileTypes) {
       // Add breakdown of file types if available
-      const breakdown = [];
-      if (item.fileTypes.image > 0) {
-        breakdown.push(`Images: ${formatBytes(item.fileTypes.image)}`);
-      }
-      if (item.fileTypes.video > 0) {
-        breakdown.push(`Videos: ${formatBytes(item.fileTypes.video)}`);
-      }
-      if (item.fileTypes.audio > 0) {
-        breakdown.push(`Audio: ${formatBytes(item.fileTypes.audio)}`);
-      }
-      if (item.fileTypes.document > 0) {
-        breakdown.push(`Documents: ${formatBytes(item.fileTypes.document)}`);
-      }
-      if (item.fileTypes.archive > 0) {
-        breakdown.push(`Archives: ${formatBytes(item.fileTypes.archive)}`);
-      }
-      if (item.fileTypes.other > 0) {
-        breakdown.push(`Other: ${formatBytes(item.fileTypes.other)}`);
-      }
+      const breakdown = orderedFileTypes(item.fileTypes).map(
+        ([type, size]) => `${type}: ${formatBytes(size)}`
+      );
 
       if (breakdown.length > 0) {
         typeText += " - " + breakdown.join(", ");
       }
     }
+    const fileCount = (item.fileCount || 0).toLocaleString();
+    const dirCount = (item.dirCount || 0).toLocaleString();
+    typeText += ` (${fileCount} files, ${dirCount} directories)`;
     selectedTypeText.textContent = typeText;
   } else {
-    selectedTypeText.textContent = item.extension ? `File (.${item.extension})` : "File";
+    const typeName = item.type ? ` - ${item.type}` : "";
+    const mimeType = item.mimeType ? ` (${item.mimeType})` : "";
+    selectedTypeText.textContent =
+      (item.extension ? `File (.${item.extension})` : "File") + typeName + mimeType;
   }
+
+  selectedMetaText.textContent = metadataText(item);
+
+  fetchExtensionStats(item);
+  fetchAgeStats(item);
+}
+
+// Describe when an item was touched, who owns it and its permissions
+function metadataText(item) {
+  const formatTime = (seconds) => new Date(seconds * 1000).toLocaleString();
+  const lines = [];
+
+  if (item.modTime) {
+    lines.push(`Modified: ${formatTime(item.modTime)}`);
+  }
+  if (item.isDir && item.newestModTime) {
+    lines.push(`Newest file: ${formatTime(item.newestModTime)}`);
+  }
+  if (item.accessTime) {
+    lines.push(`Accessed: ${formatTime(item.accessTime)}`);
+  }
+  if (item.changeTime) {
+    lines.push(`Changed: ${formatTime(item.changeTime)}`);
+  }
+  if (!item.isDir && item.diskUsage && item.diskUsage !== item.size) {
+    lines.push(`On disk: ${formatBytes(item.diskUsage)}`);
+  }
+  if (item.owner) {
+    lines.push(`Owner: ${item.owner}:${item.group || item.gid}`);
+  }
+  if (item.mode !== undefined) {
+    lines.push(`Mode: ${formatPermissions(item.mode, item.isDir)}`);
+  }
+  if (item.archive) {
+    const files = (item.fileCount || 0).toLocaleString();
+    lines.push(
+      `Archive (${item.archive}): ${files} files, ${formatBytes(item.uncompressedSize || 0)} uncompressed`
+    );
+  } else if (item.uncompressedSize) {
+    lines.push(`Uncompressed: ${formatBytes(item.uncompressedSize)}`);
+  }
+  if (item.image) {
+    const tags = (item.image.tags || []).join(", ");
+    lines.push(`Image (${item.image.format}): ${tags || "untagged"}, ${item.image.layers.length} layers`);
+  }
+  if (item.objects) {
+    const objects = item.objects.toLocaleString();
+    lines.push(item.isDir ? `Git objects: ${objects}` : `Versions: ${objects}`);
+  }
+  if (!item.isDir && item.layer) {
+    lines.push(`Layer ${item.layer}: ${layerStep(item.layer)}`);
+  }
+  if (item.timedOut) {
+    const kind = item.isDir ? "directory" : "archive";
+    lines.push(`Timed out: reading this ${kind} took too long, some of its contents are missing`);
+  } else if (item.incomplete) {
+    lines.push("Incomplete: some entries could not be read");
+  }
+  if (item.isDir && item.owners) {
+    const owners = Object.entries(item.owners)
+      .sort((a, b) => b[1] - a[1])
+      .slice(0, 3)
+      .map(([owner, size]) => `${owner} ${formatBytes(size)}`);
+    if (owners.length > 0) {
+      lines.push(`Top owners: ${owners.join(", ")}`);
+    }
+  }
+  if (item.isDir && item.layerSizes) {
+    const layers = Object.entries(item.layerSizes)
+      .sort((a, b) => b[1] - a[1])
+      .slice(0, 3)
+      .map(([number, size]) => `${number} ${formatBytes(size)}`);
+    if (layers.length > 0) {
+      lines.push(`Top layers: ${layers.join(", ")}`);
+    }
+  }
+  return lines.join("\n");
+}
+
+// Format permission bits like ls, e.g. "drwxr-xr-x (755)"
+function formatPermissions(mode, isDir) {
+  const perm = mode & 0o777;
+  let text = isDir ? "d" : "-";
+  for (let shift = 6; shift >= 0; shift -= 3) {
+    const bits = (perm >> shift) & 7;
+    text += (bits & 4 ? "r" : "-") + (bits & 2 ? "w" : "-") + (bits & 1 ? "x" : "-");
+  }
+  return `${text} (${perm.toString(8)})`;
+}
+
+// Fetch and show the extensions using the most space under a directory
+async function fetchExtensionStats(item) {
+  const request = ++extensionStatsRequest;
+
+  if (!isContainer(item)) {
+    extensionStatsContainer.classList.add("hidden");
+    return;
+  }
+
+  const params = new URLSearchParams({ path: item.path });
+  if (currentResultId) {
+    params.set("id", currentResultId);
+  }
+
+  try {
+    const response = await fetch(`/api/extensions?${params}`);
+    if (!response.ok) {
+      throw new Error(`Server responded with ${response.status}: ${response.statusText}`);
+    }
+    const stats = await response.json();
+
+    // Ignore responses for items that are no longer selected
+    if (request !== extensionStatsRequest) {
+      return;
+    }
+    renderExtensionStats(stats, item.size);
+  } catch (error) {
+    console.error("Error fetching extension stats:", error);
+    extensionStatsContainer.classList.add("hidden");
+  }
+}
+
+// Render the top extensions table
+function renderExtensionStats(stats, totalSize) {
+  extensionStatsBody.innerHTML = "";
+
+  if (!stats.extensions || stats.extensions.length === 0) {
+    extensionStatsContainer.classList.add("hidden");
+    return;
+  }
+
+  stats.extensions.forEach((ext) => {
+    const row = document.createElement("tr");
+    const share = totalSize > 0 ? ((ext.bytes / totalSize) * 100).toFixed(1) : "0.0";
+    const cells = [
+      ext.extension ? `.${ext.extension}` : "(none)",
+      formatBytes(ext.bytes),
+      ext.files.toLocaleString(),
+      `${share}%`,
+    ];
+    cells.forEach((text) => {
+      const cell = document.createElement("td");
+      cell.textContent = text;
+      row.appendChild(cell);
+    });
+    extensionStatsBody.appendChild(row);
+  });
+
+  extensionStatsContainer.classList.remove("hidden");
 }
 
 // Update breadcrumb trail
@@ -826,6 +1487,104 @@ function updateBreadcrumbs() {
   });
 }
 
+// Get color for a file, preferring the type the server classified it as
+function getItemColor(item) {
+  if (item.type && typeColors[item.type]) {
+    return typeColors[item.type];
+  }
+  return getFileTypeColor(item.extension);
+}
+
+// Assign a color to each owner in a scan result, largest first
+function assignOwnerColors(data) {
+  const palette = d3.schemeTableau10;
+  ownerOrder = Object.entries(data.owners || {})
+    .sort((a, b) => b[1] - a[1])
+    .map(([owner]) => owner);
+
+  Object.keys(ownerColors).forEach((owner) => delete ownerColors[owner]);
+  ownerOrder.forEach((owner, i) => {
+    ownerColors[owner] = palette[i % palette.length];
+  });
+
+  initializeColorLegend();
+}
+
+// Assign a color to each layer of the container image a result was read from
+function assignLayerColors(data) {
+  const palette = d3.schemeTableau10;
+  imageLayers = data.image ? data.image.layers || [] : [];
+
+  Object.keys(layerColors).forEach((layer) => delete layerColors[layer]);
+  imageLayers.forEach((layer, i) => {
+    layerColors[i + 1] = palette[i % palette.length];
+  });
+}
+
+// Describe an image layer by the build step that created it
+function layerStep(number) {
+  const layer = imageLayers[number - 1];
+  if (!layer) {
+    return `layer ${number}`;
+  }
+  const step = layer.createdBy || layer.digest;
+  return step.length > 60 ? `${step.slice(0, 57)}...` : step;
+}
+
+// Get the color of an item in the owner, age and layer color modes
+function getModeColor(item) {
+  if (colorBy === "age") {
+    return getAgeColor(item);
+  }
+  if (colorBy === "layer") {
+    return getLayerColor(item);
+  }
+  return getOwnerColor(item);
+}
+
+// Get the color of the image layer that wrote a file, or that contributes
+// most of a directory
+function getLayerColor(item) {
+  let layer = item.layer;
+  if (item.isDir && item.layerSizes) {
+    let largest = -1;
+    Object.entries(item.layerSizes).forEach(([number, size]) => {
+      if (size > largest) {
+        layer = number;
+        largest = size;
+      }
+    });
+  }
+  return layerColors[layer] || typeColors.other;
+}
+
+// Get the color of the age bucket of a file, or a directory's newest file
+function getAgeColor(item) {
+  const timestamp = item.isDir ? item.newestModTime : item.modTime;
+  if (!timestamp) {
+    return typeColors.other;
+  }
+
+  const ageDays = (Date.now() / 1000 - timestamp) / 86400;
+  const bucket = ageBuckets.findIndex((b) => b.maxDays === 0 || ageDays < b.maxDays);
+  return ageColors[bucket];
+}
+
+// Get the color of the user owning a file, or owning most of a directory
+function getOwnerColor(item) {
+  let owner = item.owner;
+  if (item.isDir && item.owners) {
+    let largest = -1;
+    Object.entries(item.owners).forEach(([name, size]) => {
+      if (size > largest) {
+        owner = name;
+        largest = size;
+      }
+    });
+  }
+  return ownerColors[owner] || typeColors.other;
+}
+
 // Get color for file type based on extension
 function getFileTypeColor(extension) {
   if (!extension) {
@@ -842,85 +1601,40 @@ function getFileTypeColor(extension) {
   return typeColors.other;
 }
 
+// List non-empty file type stats as [type, size] pairs in registry order,
+// followed by any types the registry doesn't know about
+function orderedFileTypes(fileTypes) {
+  const types = [
+    ...categoryOrder,
+    ...Object.keys(fileTypes).filter((type) => !categoryOrder.includes(type)),
+  ];
+  return types.filter((type) => fileTypes[type] > 0).map((type) => [type, fileTypes[type]]);
+}
+
 // Render a multi-colored box representing file type distribution
 function renderMultiColoredBox(rectId, width, height, fileTypes) {
+  const entries = orderedFileTypes(fileTypes);
+
   // Calculate total size
-  const total =
-    fileTypes.image +
-    fileTypes.video +
-    fileTypes.audio +
-    fileTypes.document +
-    fileTypes.archive +
-    fileTypes.other;
+  const total = entries.reduce((sum, [, size]) => sum + size, 0);
 
   if (total === 0) {
     return;
   }
 
-  // Calculate proportions
-  const imageProp = fileTypes.image / total;
-  const videoProp = fileTypes.video / total;
-  const audioProp = fileTypes.audio / total;
-  const documentProp = fileTypes.document / total;
-  const archiveProp = fileTypes.archive / total;
-  const otherProp = fileTypes.other / total;
-
-  // Create segments
+  // Create segments proportional to each type's share
   const segments = [];
   let currentPosition = 0;
 
-  if (imageProp > 0) {
-    segments.push({
-      color: typeColors.image,
-      start: currentPosition,
-      end: currentPosition + imageProp,
-    });
-    currentPosition += imageProp;
-  }
-
-  if (videoProp > 0) {
-    segments.push({
-      color: typeColors.video,
-      start: currentPosition,
-      end: currentPosition + videoProp,
-    });
-    currentPosition += videoProp;
-  }
-
-  if (audioProp > 0) {
+  entries.forEach(([type, size]) => {
+    const proportion = size / total;
     segments.push({
-      color: typeColors.audio,
+      color: typeColors[type] || typeColors.other,
       start: currentPosition,
-      end: currentPosition + audioProp,
+      end: currentPosition + proportion,
     });
-    currentPosition += audioProp;
-  }
-
-  if (documentProp > 0) {
-    segments.push({
-      color: typeColors.document,
-      start: currentPosition,
-      end: currentPosition + documentProp,
-    });
-    currentPosition += documentProp;
-  }
-
-  if (archiveProp > 0) {
-    segments.push({
-      color: typeColors.archive,
-      start: currentPosition,
-      end: currentPosition + archiveProp,
-    });
-    currentPosition += archiveProp;
-  }
-
-  if (otherProp > 0) {
-    segments.push({
-      color: typeColors.other,
-      start: currentPosition,
-      end: 1,
-    });
-  }
+    currentPosition += proportion;
+  });
 
   // Create pattern definition with stripes
   const svg = d3.select("svg");
@@ -998,12 +1712,38 @@ async function fetchPreviousScans() {
     previousScans = scans;
 
     // Display the scans
+    updateHostOptions();
     displayPreviousScans();
   } catch (error) {
     // Handle error when fetching previous scans
   }
 }
 
+// List the hosts with scans in the host selector, which is only shown once
+// agents have uploaded scans
+function updateHostOptions() {
+  const remoteHosts = [...new Set(previousScans.map((scan) => scan.host).filter(Boolean))].sort();
+  const hasLocal = previousScans.some((scan) => !scan.host);
+  const hosts = [
+    ["*", "All hosts"],
+    ...(hasLocal ? [["", "This server"]] : []),
+    ...remoteHosts.map((host) => [host, host]),
+  ];
+  if (!hosts.some(([value]) => value === selectedHost)) {
+    selectedHost = "*";
+  }
+
+  hostSelect.innerHTML = "";
+  hosts.forEach(([value, text]) => {
+    const option = document.createElement("option");
+    option.value = value;
+    option.textContent = text;
+    hostSelect.appendChild(option);
+  });
+  hostSelect.value = selectedHost;
+  hostSelect.classList.toggle("hidden", remoteHosts.length === 0);
+}
+
 // Display previous scans in the UI
 function displayPreviousScans() {
   previousScansList.innerHTML = "";
@@ -1011,7 +1751,8 @@ function displayPreviousScans() {
   if (previousScans.length > 0) {
     previousScansContainer.classList.remove("hidden");
 
-    previousScans.forEach((scan) => {
+    const scans = previousScans.filter((scan) => selectedHost === "*" || (scan.host || "") === selectedHost);
+    scans.forEach((scan) => {
       const scanItem = document.createElement("div");
       scanItem.className = "previous-scan-item";
 
@@ -1022,11 +1763,41 @@ function displayPreviousScans() {
       scanItem.innerHTML = `
         <div class="scan-path">${scan.path}</div>
         <div class="scan-info">${formattedDate} - ${formatBytes(scan.size)}</div>
+        <div class="previous-scan-actions">
+          <button class="scan-label-button">Label</button>
+          <button class="scan-pin-button">${scan.pinned ? "Unpin" : "Pin"}</button>
+        </div>
       `;
+      if (scan.label) {
+        const label = document.createElement("span");
+        label.className = "previous-scan-label";
+        label.textContent = scan.label;
+        scanItem.querySelector(".scan-path").prepend(label);
+      }
+      if (scan.host) {
+        const host = document.createElement("span");
+        host.className = "previous-scan-host";
+        host.textContent = scan.host;
+        scanItem.querySelector(".scan-path").prepend(host);
+      }
+      if (scan.pinned) {
+        scanItem.classList.add("pinned");
+      }
 
       scanItem.addEventListener("click", () => {
         fetchScanResult(scan.resultId);
       });
+      scanItem.querySelector(".scan-pin-button").addEventListener("click", (event) => {
+        event.stopPropagation();
+        updatePreviousScan(scan.resultId, { pinned: !scan.pinned });
+      });
+      scanItem.querySelector(".scan-label-button").addEventListener("click", (event) => {
+        event.stopPropagation();
+        const label = prompt("Label for this scan:", scan.label || "");
+        if (label !== null) {
+          updatePreviousScan(scan.resultId, { label });
+        }
+      });
 
       previousScansList.appendChild(scanItem);
     });
@@ -1035,6 +1806,27 @@ function displayPreviousScans() {
   }
 }
 
+// Pin or label a previous scan; pinned scans are never removed by retention
+async function updatePreviousScan(resultId, changes) {
+  try {
+    const response = await fetch("/api/previous-scans", {
+      method: "PUT",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ id: resultId, ...changes }),
+    });
+
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+
+    fetchPreviousScans();
+  } catch (error) {
+    alert("Error updating scan: " + error.message);
+  }
+}
+
 // Handle search input changes
 function handleSearchInput() {
   const searchTerm = searchInput.value.trim();
@@ -1142,8 +1934,26 @@ function initializeColorLegend() {
   // Clear existing legend items
   legendItems.innerHTML = "";
 
-  // Create legend items for each file type
-  Object.entries(typeColors).forEach(([type, color]) => {
+  let entries;
+  if (colorBy === "owner") {
+    legendTitle.textContent = "Owner Colors";
+    entries = ownerOrder.map((owner) => [owner, ownerColors[owner]]);
+  } else if (colorBy === "age") {
+    legendTitle.textContent = "Last Modified";
+    entries = ageBuckets.map((bucket, i) => [bucket.label, ageColors[i]]);
+  } else if (colorBy === "layer") {
+    legendTitle.textContent = imageLayers.length > 0 ? "Image Layers" : "Image Layers (scan an image)";
+    entries = imageLayers.map((layer, i) => {
+      const visible = `${formatBytes(layer.visibleSize)} of ${formatBytes(layer.uncompressedSize)} visible`;
+      return [`${i + 1}: ${layerStep(i + 1)} (${visible})`, layerColors[i + 1]];
+    });
+  } else {
+    // Create legend items for directories and each file type category
+    legendTitle.textContent = "File Type Colors";
+    entries = ["directory", ...categoryOrder].map((type) => [type, typeColors[type]]);
+  }
+
+  entries.forEach(([name, color]) => {
     const legendItem = document.createElement("div");
     legendItem.className = "legend-item";
 
@@ -1152,8 +1962,9 @@ function initializeColorLegend() {
     colorBox.style.backgroundColor = color;
 
     const label = document.createElement("span");
-    label.className = "legend-label";
-    label.textContent = type;
+    // Keep user names as they are
+    label.className = colorBy === "type" ? "legend-label" : "legend-label legend-label-raw";
+    label.textContent = name;
 
     legendItem.appendChild(colorBox);
     legendItem.appendChild(label);